@@ -0,0 +1,32 @@
+package client
+
+import (
+	"proto_demo/pb"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorReason returns the reason of the ErrorInfo detail of err,
+// err can be wrapped by the client methods
+func ErrorReason(err error) pb.ErrorReason {
+	st, _ := status.FromError(err)
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return pb.ErrorReason(pb.ErrorReason_value[info.GetReason()])
+		}
+	}
+	return pb.ErrorReason_ERROR_REASON_UNSPECIFIED
+}
+
+// RetryDelay returns the delay of the RetryInfo detail of err, ok is false if the server didn't ask to retry
+func RetryDelay(err error) (delay time.Duration, ok bool) {
+	st, _ := status.FromError(err)
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
@@ -1,8 +1,8 @@
 package client
 
 import (
-	"bufio"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"log"
@@ -11,9 +11,21 @@ import (
 	"proto_demo/pb"
 	"time"
 
+	"github.com/google/uuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+const (
+	uploadChunkSize   = 64 << 10
+	uploadTimeout     = time.Minute
+	maxUploadAttempts = 5
+	uploadRetryDelay  = time.Second
+	// idempotencyKeyHeader is the metadata of the idempotency key read by the server
+	idempotencyKeyHeader = "idempotency-key"
 )
 
 type LaptopClient struct {
@@ -34,8 +46,7 @@ func (laptopClient *LaptopClient) CreateLaptop(laptop *pb.Laptop) {
 	res, err := laptopClient.service.CreateLaptop(ctx, req)
 	//res, err := laptopClient.CreateLaptop(context.Background(), req)
 	if err != nil {
-		st, ok := status.FromError(err)
-		if ok && st.Code() == codes.AlreadyExists {
+		if ErrorReason(err) == pb.ErrorReason_LAPTOP_ALREADY_EXISTS {
 			log.Print("laptop already exists")
 		} else {
 			log.Fatal("cannot create laptop: ", err)
@@ -47,6 +58,111 @@ func (laptopClient *LaptopClient) CreateLaptop(laptop *pb.Laptop) {
 
 }
 
+// UpdateLaptop overwrites the given fields of a saved laptop,all fields are replaced if paths is empty.
+// set laptop.Revision to the revision that was read to fail with codes.Aborted on concurrent changes
+func (laptopClient *LaptopClient) UpdateLaptop(laptop *pb.Laptop, paths ...string) (*pb.Laptop, error) {
+	req := &pb.UpdateLaptopRequest{
+		Laptop:     laptop,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: paths},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.UpdateLaptop(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot update laptop: %w", err)
+	}
+
+	log.Printf("updated laptop with id: %s ", res.GetLaptop().GetId())
+	return res.GetLaptop(), nil
+}
+
+// DeleteLaptop removes a laptop with its images and rating, a soft deleted laptop can be restored
+func (laptopClient *LaptopClient) DeleteLaptop(laptopID string, soft bool) error {
+	req := &pb.DeleteLaptopRequest{
+		Id:   laptopID,
+		Soft: soft,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := laptopClient.service.DeleteLaptop(ctx, req)
+	if err != nil {
+		return fmt.Errorf("cannot delete laptop: %w", err)
+	}
+
+	log.Printf("deleted laptop with id: %s ", laptopID)
+	return nil
+}
+func (laptopClient *LaptopClient) RestoreLaptop(laptopID string) (*pb.Laptop, error) {
+	req := &pb.RestoreLaptopRequest{
+		Id: laptopID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.RestoreLaptop(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot restore laptop: %w", err)
+	}
+
+	log.Printf("restored laptop with id: %s ", laptopID)
+	return res.GetLaptop(), nil
+}
+
+// GetLaptop returns a laptop with its rating summary and image IDs
+func (laptopClient *LaptopClient) GetLaptop(laptopID string) (*pb.GetLaptopResponse, error) {
+	req := &pb.GetLaptopRequest{
+		Id: laptopID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.GetLaptop(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get laptop: %w", err)
+	}
+	return res, nil
+}
+
+// BatchGetLaptops returns one result per ID, missing laptops have a NotFound code
+func (laptopClient *LaptopClient) BatchGetLaptops(laptopIDs []string) ([]*pb.LaptopResult, error) {
+	req := &pb.BatchGetLaptopsRequest{
+		Ids: laptopIDs,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.BatchGetLaptops(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot batch get laptops: %w", err)
+	}
+	return res.GetResults(), nil
+}
+
+// ListLaptops returns a page of laptops and the token of the next page, which is empty on the last page
+func (laptopClient *LaptopClient) ListLaptops(
+	orderBy pb.SortField,
+	descending bool,
+	pageSize uint32,
+	pageToken string,
+) ([]*pb.Laptop, string, error) {
+	req := &pb.ListLaptopsRequest{
+		PageSize:   pageSize,
+		PageToken:  pageToken,
+		OrderBy:    orderBy,
+		Descending: descending,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.ListLaptops(ctx, req)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot list laptops: %w", err)
+	}
+	return res.GetLaptops(), res.GetNextPageToken(), nil
+}
+
 func (laptopClient *LaptopClient) SearchLaptop(filter *pb.Filter) {
 	log.Print("search filter: ", filter)
 
@@ -79,65 +195,314 @@ func (laptopClient *LaptopClient) SearchLaptop(filter *pb.Filter) {
 
 	}
 }
-func (laptopClient *LaptopClient) UploadImage(laptopID string, imagePath string) {
-	file, err := os.Open(imagePath)
+
+// WatchLaptops calls found for each change of the laptops matching filter until ctx is done.
+// the resume token of the last event received can be used to continue a watch
+func (laptopClient *LaptopClient) WatchLaptops(
+	ctx context.Context,
+	filter *pb.Filter,
+	resumeToken string,
+	found func(event *pb.LaptopEvent) error,
+) error {
+	req := &pb.WatchLaptopsRequest{
+		Filter:      filter,
+		ResumeToken: resumeToken,
+	}
+	stream, err := laptopClient.service.WatchLaptops(ctx, req)
 	if err != nil {
-		log.Fatal("cannot open image file : ", err)
+		return fmt.Errorf("cannot watch laptops: %w", err)
+	}
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("cannot receive event: %w", err)
+		}
+		err = found(res.GetEvent())
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// AggregateLaptops counts the facets of the laptops matching filter
+func (laptopClient *LaptopClient) AggregateLaptops(
+	filter *pb.Filter,
+	histograms ...*pb.HistogramSpec,
+) (*pb.AggregateLaptopsResponse, error) {
+	req := &pb.AggregateLaptopsRequest{
+		Filter:     filter,
+		Histograms: histograms,
 	}
-	defer file.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	stream, err := laptopClient.service.UploadImage(ctx)
+	res, err := laptopClient.service.AggregateLaptops(ctx, req)
 	if err != nil {
-		log.Fatal("cannot upload image:", err)
+		return nil, fmt.Errorf("cannot aggregate laptops: %w", err)
 	}
+	return res, nil
+}
 
-	req := &pb.UploadImageRequest{
-		Data: &pb.UploadImageRequest_Info{
+// UploadImage uploads an image in chunks and returns its ID.
+// if the connection is lost, the upload resumes from the size committed by the server
+func (laptopClient *LaptopClient) UploadImage(laptopID string, imagePath string) (string, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("cannot open image file: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("cannot read image file: %w", err)
+	}
+
+	//同一个幂等键,重试时服务器返回同一个上传
+	key, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate idempotency key: %w", err)
+	}
+	var uploadID string
+	err = retryUpload(func(ctx context.Context) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, idempotencyKeyHeader, key.String())
+		req := &pb.StartUploadRequest{
 			Info: &pb.ImageInfo{
 				LaptopId:  laptopID,
 				ImageType: filepath.Ext(imagePath),
 			},
-		},
+		}
+		res, err := laptopClient.service.StartUpload(ctx, req)
+		uploadID = res.GetUploadId()
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot start upload: %w", err)
+	}
+
+	err = retryUpload(func(ctx context.Context) error {
+		return laptopClient.uploadChunks(ctx, uploadID, file, size)
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot upload image: %w", err)
 	}
 
-	err = stream.Send(req)
+	var res *pb.UploadImageResponse
+	err = retryUpload(func(ctx context.Context) error {
+		req := &pb.FinishUploadRequest{UploadId: uploadID, Checksum: hash.Sum(nil)}
+		res, err = laptopClient.service.FinishUpload(ctx, req)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot finish upload: %w", err)
+	}
+	log.Printf("image uploaded with id: %s , size: %d", res.GetId(), res.GetSize())
+	return res.GetId(), nil
+}
+
+// uploadChunks sends the part of file that the server doesn't have yet
+func (laptopClient *LaptopClient) uploadChunks(ctx context.Context, uploadID string, file *os.File, size int64) error {
+	res, err := laptopClient.service.QueryUpload(ctx, &pb.QueryUploadRequest{UploadId: uploadID})
+	if err != nil {
+		return err
+	}
+	offset := res.GetCommittedSize()
+	if offset == size {
+		return nil
+	}
+	_, err = file.Seek(offset, io.SeekStart)
 	if err != nil {
-		log.Fatal("cannot send image info :", err)
+		return fmt.Errorf("cannot seek image file: %w", err)
 	}
-	reader := bufio.NewReader(file)
-	buffer := make([]byte, 1024)
 
+	stream, err := laptopClient.service.UploadChunks(ctx)
+	if err != nil {
+		return err
+	}
+	buffer := make([]byte, uploadChunkSize)
 	for {
+		n, err := file.Read(buffer)
+		if n > 0 {
+			req := &pb.UploadChunkRequest{
+				UploadId:  uploadID,
+				Offset:    offset,
+				ChunkData: buffer[:n],
+			}
+			err := stream.Send(req)
+			if err == io.EOF {
+				//服务器已经结束了这个流,错误由CloseAndRecv返回
+				break
+			}
+			if err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read image file: %w", err)
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
 
-		n, err := reader.Read(buffer)
+// retryUpload calls upload until it succeeds, it's only called again after the errors that can be resumed
+func retryUpload(upload func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+		err := upload(ctx)
+		cancel()
+		if err == nil || attempt == maxUploadAttempts || !retryableUploadError(err) {
+			return err
+		}
+
+		delay, ok := RetryDelay(err)
+		if !ok {
+			delay = uploadRetryDelay
+		}
+		log.Printf("upload attempt %d failed, retry in %v: %v", attempt, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// retryableUploadError returns true if an upload can be resumed after err,
+// an error of the server is only retried if its reason is transient
+func retryableUploadError(err error) bool {
+	switch ErrorReason(err) {
+	case pb.ErrorReason_UPLOAD_OFFSET_MISMATCH, pb.ErrorReason_STREAM_FAILURE, pb.ErrorReason_STORE_UNAVAILABLE:
+		return true
+	case pb.ErrorReason_ERROR_REASON_UNSPECIFIED:
+		//没有ErrorInfo的错误来自连接而不是服务器
+		switch status.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+			return true
+		}
+	}
+	return false
+}
+
+// DownloadImage writes an image to imageFolder and returns the path of the file,
+// the file is only created if the whole image is received.
+// there's no timeout besides the one of ctx, a large image can take much longer than the other calls
+func (laptopClient *LaptopClient) DownloadImage(ctx context.Context, imageID string, imageFolder string) (string, error) {
+	stream, err := laptopClient.service.DownloadImage(ctx, &pb.DownloadImageRequest{ImageId: imageID})
+	if err != nil {
+		return "", fmt.Errorf("cannot download image: %w", err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		return "", fmt.Errorf("cannot receive image info: %w", err)
+	}
+	info := res.GetInfo()
+	if info == nil {
+		return "", fmt.Errorf("image info is missing")
+	}
+
+	file, err := os.CreateTemp(imageFolder, imageID+"-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("cannot create image file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	size := 0
+	for {
+		res, err := stream.Recv()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			log.Fatal("cannot read chunk to buffer : ", err)
+			return "", fmt.Errorf("cannot receive chunk data: %w", err)
 		}
+		n, err := file.Write(res.GetChunkData())
+		if err != nil {
+			return "", fmt.Errorf("cannot write image file: %w", err)
+		}
+		size += n
+	}
+	err = file.Close()
+	if err != nil {
+		return "", fmt.Errorf("cannot write image file: %w", err)
+	}
 
-		req := &pb.UploadImageRequest{
-			Data: &pb.UploadImageRequest_ChunkData{
-				ChunkData: buffer[:n],
-			},
+	imagePath := filepath.Join(imageFolder, imageID+filepath.Base(info.GetImageType()))
+	err = os.Rename(file.Name(), imagePath)
+	if err != nil {
+		return "", fmt.Errorf("cannot save image file: %w", err)
+	}
+	log.Printf("image downloaded to %s, size: %d", imagePath, size)
+	return imagePath, nil
+}
+
+// ListImages returns the images of a laptop, the primary image first
+func (laptopClient *LaptopClient) ListImages(laptopID string) ([]*pb.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.ListImages(ctx, &pb.ListImagesRequest{LaptopId: laptopID})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list images: %w", err)
+	}
+	return res.GetImages(), nil
+}
+
+func (laptopClient *LaptopClient) DeleteImage(imageID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := laptopClient.service.DeleteImage(ctx, &pb.DeleteImageRequest{ImageId: imageID})
+	if err != nil {
+		return fmt.Errorf("cannot delete image: %w", err)
+	}
+
+	log.Printf("deleted image with id: %s ", imageID)
+	return nil
+}
+
+// SetPrimaryImage makes an image the primary image of its laptop and returns the images of the laptop
+func (laptopClient *LaptopClient) SetPrimaryImage(imageID string) ([]*pb.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.SetPrimaryImage(ctx, &pb.SetPrimaryImageRequest{ImageId: imageID})
+	if err != nil {
+		return nil, fmt.Errorf("cannot set primary image: %w", err)
+	}
+	return res.GetImages(), nil
+}
+
+// ImportLaptops streams laptops to the server and returns the import summary
+func (laptopClient *LaptopClient) ImportLaptops(laptops []*pb.Laptop, transactional bool) (*pb.ImportLaptopsResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stream, err := laptopClient.service.ImportLaptops(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import laptops: %w", err)
+	}
+
+	for _, laptop := range laptops {
+		req := &pb.ImportLaptopsRequest{
+			Laptop:        laptop,
+			Transactional: transactional,
+		}
+		err := stream.Send(req)
+		if err == io.EOF {
+			//服务端已经返回错误,从CloseAndRecv里取
+			break
 		}
-		err = stream.Send(req)
 		if err != nil {
-			err2 := stream.RecvMsg(nil)
-			log.Fatal("cannot send chunk to  server:", err, err2)
+			return nil, fmt.Errorf("cannot send laptop: %w", err)
 		}
 	}
 
 	res, err := stream.CloseAndRecv()
 	if err != nil {
-		log.Fatal("cannot receive response:", err)
+		return nil, fmt.Errorf("cannot import laptops: %w", err)
 	}
-	log.Printf("image uploaded with id: %s , size: %d", res.GetId(), res.GetSize())
-
+	log.Printf("imported %d of %d laptops, %d failures", len(res.GetCreatedIds()), res.GetReceived(), len(res.GetFailures()))
+	return res, nil
 }
+
 func (laptopClient *LaptopClient) RateLaptop(laptopIDs []string, scores []float64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
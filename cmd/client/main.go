@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 )
 
 func testCreateLaptop(laptopClient *client.LaptopClient) {
@@ -21,7 +22,7 @@ func testSearchLaptop(laptopClient *client.LaptopClient) {
 		laptopClient.CreateLaptop(sample.NewLaptop())
 	}
 	filter := &pb.Filter{
-		MaxPriceUsd: 3000,
+		MaxPriceUsd: proto.Float64(3000),
 		MinCpuCores: 4,
 		MinCpuGhz:   2.5,
 		MinRam:      &pb.Memory{Value: 8, Unit: pb.Memory_GIGABYTE},
@@ -31,8 +32,10 @@ func testSearchLaptop(laptopClient *client.LaptopClient) {
 func testUploadImage(laptopClient *client.LaptopClient) {
 	laptop := sample.NewLaptop()
 	laptopClient.CreateLaptop(laptop)
-	laptopClient.UploadImage(laptop.GetId(), "tmp/laptop.jpg")
-
+	_, err := laptopClient.UploadImage(laptop.GetId(), "tmp/laptop.jpg")
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 func testRateLaptop(laptopClient *client.LaptopClient) {
 	n := 3
@@ -74,9 +77,19 @@ const (
 func authMethods() map[string]bool {
 	const laptopServicePath = "/techschool.pcbook.LaptopService/"
 	return map[string]bool{
-		laptopServicePath + "CreateLaptop": true,
-		laptopServicePath + "UploadImage":  true,
-		laptopServicePath + "RateLaptop":   true,
+		laptopServicePath + "CreateLaptop":    true,
+		laptopServicePath + "UpdateLaptop":    true,
+		laptopServicePath + "DeleteLaptop":    true,
+		laptopServicePath + "RestoreLaptop":   true,
+		laptopServicePath + "ImportLaptops":   true,
+		laptopServicePath + "DeleteImage":     true,
+		laptopServicePath + "SetPrimaryImage": true,
+		laptopServicePath + "UploadImage":     true,
+		laptopServicePath + "StartUpload":     true,
+		laptopServicePath + "UploadChunks":    true,
+		laptopServicePath + "QueryUpload":     true,
+		laptopServicePath + "FinishUpload":    true,
+		laptopServicePath + "RateLaptop":      true,
 	}
 }
 func main() {
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 	"proto_demo/pb"
 	"proto_demo/service"
 	"time"
@@ -25,7 +28,12 @@ func createUser(userstore service.UserStore, username, passwrod, role string) er
 	if err != nil {
 		return err
 	}
-	return userstore.Save(user)
+	err = userstore.Save(user)
+	//持久化的用户在重启后已经存在
+	if errors.Is(err, service.ErrAlreadyExists) {
+		return nil
+	}
+	return err
 }
 
 const (
@@ -36,29 +44,99 @@ const (
 func accessibleRoles() map[string][]string {
 	const laptopServicePath = "/techschool.pcbook.LaptopService/"
 	return map[string][]string{
-		laptopServicePath + "CreateLaptop": {"admin"},
-		laptopServicePath + "UploadImage":  {"admin"},
-		laptopServicePath + "RateLaptop":   {"admin", "user"},
+		laptopServicePath + "CreateLaptop":    {"admin"},
+		laptopServicePath + "UpdateLaptop":    {"admin"},
+		laptopServicePath + "DeleteLaptop":    {"admin"},
+		laptopServicePath + "RestoreLaptop":   {"admin"},
+		laptopServicePath + "ImportLaptops":   {"admin"},
+		laptopServicePath + "DeleteImage":     {"admin"},
+		laptopServicePath + "SetPrimaryImage": {"admin"},
+		laptopServicePath + "UploadImage":     {"admin"},
+		laptopServicePath + "StartUpload":     {"admin"},
+		laptopServicePath + "UploadChunks":    {"admin"},
+		laptopServicePath + "QueryUpload":     {"admin"},
+		laptopServicePath + "FinishUpload":    {"admin"},
+		laptopServicePath + "RateLaptop":      {"admin", "user"},
+	}
+}
+
+// stores holds the stores of the server
+type stores struct {
+	laptop service.LaptopStore
+	rating service.RatingStore
+	user   service.UserStore
+}
+
+// newStores creates the stores of storeType, the ratings and the users are kept in memory unless storeType is sql
+func newStores(storeType string, storePath string) (*stores, error) {
+	if storeType == "bolt" || storeType == "sql" {
+		err := os.MkdirAll(storePath, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &stores{
+		rating: service.NewInMemoryRatingStore(),
+		user:   service.NewInMemoryUserStore(),
 	}
+	var err error
+	switch storeType {
+	case "memory":
+		result.laptop = service.NewInMemoryLaptopStore()
+	case "file":
+		result.laptop, err = service.NewFileLaptopStore(storePath)
+	case "bolt":
+		result.laptop, err = service.NewBoltLaptopStore(filepath.Join(storePath, "laptops.db"))
+	case "sql":
+		var sqlStore *service.SQLStore
+		sqlStore, err = service.NewSQLStore(filepath.Join(storePath, "pcbook.sqlite"))
+		if err == nil {
+			result = &stores{laptop: sqlStore.Laptops, rating: sqlStore.Ratings, user: sqlStore.Users}
+		}
+	default:
+		err = fmt.Errorf("unknown store %q", storeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 func main() {
 	port := flag.Int("port", 0, "the server port")
+	storeType := flag.String("store", "memory", "the store: memory, file, bolt or sql")
+	storePath := flag.String("store-path", "data", "the folder of the file, bolt or sql store")
+	idempotencyWindow := flag.Duration("idempotency-window", time.Hour, "how long the idempotency keys are remembered, 0 to ignore them")
+	maxImageSize := flag.Int64("max-image-size", service.DefaultMaxImageSize, "the largest image that can be uploaded, in bytes")
 	flag.Parse()
 	fmt.Println(*port)
 	log.Printf("start server on port %d", *port)
-	userStore := service.NewInMemoryUserStore()
-	err := seedUsers(userStore)
+	stores, err := newStores(*storeType, *storePath)
+	if err != nil {
+		log.Fatal("cannot create stores: ", err)
+	}
+	err = seedUsers(stores.user)
 	if err != nil {
 		log.Fatal("cannot seed users")
 	}
 	jwtmanager := service.NewJwtManager(secreKey, tokenDuration)
-	authServer := service.NewAuthServer(userStore, jwtmanager)
+	authServer := service.NewAuthServer(stores.user, jwtmanager)
 
-	laptopStore := service.NewInMemoryLaptopStore()
-	imageStore := service.NewDiskImageStore("img")
-	ratingStore := service.NewInMemoryRatingStore()
-	laptopServer := service.NewLaptopService(laptopStore, imageStore, ratingStore)
+	//只把还存在的笔记本的图片加回manifest
+	imageStore, err := service.NewDiskImageStore("img", func(laptopID string) (bool, error) {
+		laptop, err := stores.laptop.Find(laptopID)
+		return laptop != nil, err
+	})
+	if err != nil {
+		log.Fatal("cannot create image store: ", err)
+	}
+	var idempotencyStore *service.IdempotencyStore
+	if *idempotencyWindow > 0 {
+		idempotencyStore = service.NewIdempotencyStore(*idempotencyWindow)
+	}
+	laptopServer := service.NewLaptopService(stores.laptop, imageStore, stores.rating, idempotencyStore)
+	laptopServer.MaxImageSize = *maxImageSize
 
 	interceptor := service.NewAuthInterceptor(jwtmanager, accessibleRoles())
 	grpcServer := grpc.NewServer(
@@ -0,0 +1,557 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.26.0
+// 	protoc        v4.23.0
+// source: aggregation_message.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Histogram_Field int32
+
+const (
+	Histogram_UNKNOWN          Histogram_Field = 0
+	Histogram_PRICE_USD        Histogram_Field = 1
+	Histogram_RAM_GB           Histogram_Field = 2
+	Histogram_CPU_CORES        Histogram_Field = 3
+	Histogram_CPU_GHZ          Histogram_Field = 4
+	Histogram_SSD_GB           Histogram_Field = 5
+	Histogram_SCREEN_SIZE_INCH Histogram_Field = 6
+	Histogram_WEIGHT_KG        Histogram_Field = 7
+	Histogram_RELEASE_YEAR     Histogram_Field = 8
+)
+
+// Enum value maps for Histogram_Field.
+var (
+	Histogram_Field_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "PRICE_USD",
+		2: "RAM_GB",
+		3: "CPU_CORES",
+		4: "CPU_GHZ",
+		5: "SSD_GB",
+		6: "SCREEN_SIZE_INCH",
+		7: "WEIGHT_KG",
+		8: "RELEASE_YEAR",
+	}
+	Histogram_Field_value = map[string]int32{
+		"UNKNOWN":          0,
+		"PRICE_USD":        1,
+		"RAM_GB":           2,
+		"CPU_CORES":        3,
+		"CPU_GHZ":          4,
+		"SSD_GB":           5,
+		"SCREEN_SIZE_INCH": 6,
+		"WEIGHT_KG":        7,
+		"RELEASE_YEAR":     8,
+	}
+)
+
+func (x Histogram_Field) Enum() *Histogram_Field {
+	p := new(Histogram_Field)
+	*p = x
+	return p
+}
+
+func (x Histogram_Field) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Histogram_Field) Descriptor() protoreflect.EnumDescriptor {
+	return file_aggregation_message_proto_enumTypes[0].Descriptor()
+}
+
+func (Histogram_Field) Type() protoreflect.EnumType {
+	return &file_aggregation_message_proto_enumTypes[0]
+}
+
+func (x Histogram_Field) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Histogram_Field.Descriptor instead.
+func (Histogram_Field) EnumDescriptor() ([]byte, []int) {
+	return file_aggregation_message_proto_rawDescGZIP(), []int{3, 0}
+}
+
+type FacetCount struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Value string `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Count uint32 `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+}
+
+func (x *FacetCount) Reset() {
+	*x = FacetCount{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_aggregation_message_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FacetCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FacetCount) ProtoMessage() {}
+
+func (x *FacetCount) ProtoReflect() protoreflect.Message {
+	mi := &file_aggregation_message_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FacetCount.ProtoReflect.Descriptor instead.
+func (*FacetCount) Descriptor() ([]byte, []int) {
+	return file_aggregation_message_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FacetCount) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *FacetCount) GetCount() uint32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type PriceStats struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	MinUsd float64 `protobuf:"fixed64,1,opt,name=min_usd,json=minUsd,proto3" json:"min_usd,omitempty"`
+	MaxUsd float64 `protobuf:"fixed64,2,opt,name=max_usd,json=maxUsd,proto3" json:"max_usd,omitempty"`
+	AvgUsd float64 `protobuf:"fixed64,3,opt,name=avg_usd,json=avgUsd,proto3" json:"avg_usd,omitempty"`
+}
+
+func (x *PriceStats) Reset() {
+	*x = PriceStats{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_aggregation_message_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PriceStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PriceStats) ProtoMessage() {}
+
+func (x *PriceStats) ProtoReflect() protoreflect.Message {
+	mi := &file_aggregation_message_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PriceStats.ProtoReflect.Descriptor instead.
+func (*PriceStats) Descriptor() ([]byte, []int) {
+	return file_aggregation_message_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PriceStats) GetMinUsd() float64 {
+	if x != nil {
+		return x.MinUsd
+	}
+	return 0
+}
+
+func (x *PriceStats) GetMaxUsd() float64 {
+	if x != nil {
+		return x.MaxUsd
+	}
+	return 0
+}
+
+func (x *PriceStats) GetAvgUsd() float64 {
+	if x != nil {
+		return x.AvgUsd
+	}
+	return 0
+}
+
+type HistogramSpec struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Field    Histogram_Field `protobuf:"varint,1,opt,name=field,proto3,enum=techschool.pcbook.Histogram_Field" json:"field,omitempty"`
+	Interval float64         `protobuf:"fixed64,2,opt,name=interval,proto3" json:"interval,omitempty"`
+}
+
+func (x *HistogramSpec) Reset() {
+	*x = HistogramSpec{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_aggregation_message_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HistogramSpec) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistogramSpec) ProtoMessage() {}
+
+func (x *HistogramSpec) ProtoReflect() protoreflect.Message {
+	mi := &file_aggregation_message_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistogramSpec.ProtoReflect.Descriptor instead.
+func (*HistogramSpec) Descriptor() ([]byte, []int) {
+	return file_aggregation_message_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *HistogramSpec) GetField() Histogram_Field {
+	if x != nil {
+		return x.Field
+	}
+	return Histogram_UNKNOWN
+}
+
+func (x *HistogramSpec) GetInterval() float64 {
+	if x != nil {
+		return x.Interval
+	}
+	return 0
+}
+
+type Histogram struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Field    Histogram_Field     `protobuf:"varint,1,opt,name=field,proto3,enum=techschool.pcbook.Histogram_Field" json:"field,omitempty"`
+	Interval float64             `protobuf:"fixed64,2,opt,name=interval,proto3" json:"interval,omitempty"`
+	Buckets  []*Histogram_Bucket `protobuf:"bytes,3,rep,name=buckets,proto3" json:"buckets,omitempty"`
+}
+
+func (x *Histogram) Reset() {
+	*x = Histogram{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_aggregation_message_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Histogram) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Histogram) ProtoMessage() {}
+
+func (x *Histogram) ProtoReflect() protoreflect.Message {
+	mi := &file_aggregation_message_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Histogram.ProtoReflect.Descriptor instead.
+func (*Histogram) Descriptor() ([]byte, []int) {
+	return file_aggregation_message_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Histogram) GetField() Histogram_Field {
+	if x != nil {
+		return x.Field
+	}
+	return Histogram_UNKNOWN
+}
+
+func (x *Histogram) GetInterval() float64 {
+	if x != nil {
+		return x.Interval
+	}
+	return 0
+}
+
+func (x *Histogram) GetBuckets() []*Histogram_Bucket {
+	if x != nil {
+		return x.Buckets
+	}
+	return nil
+}
+
+type Histogram_Bucket struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Min   float64 `protobuf:"fixed64,1,opt,name=min,proto3" json:"min,omitempty"`
+	Max   float64 `protobuf:"fixed64,2,opt,name=max,proto3" json:"max,omitempty"`
+	Count uint32  `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+}
+
+func (x *Histogram_Bucket) Reset() {
+	*x = Histogram_Bucket{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_aggregation_message_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Histogram_Bucket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Histogram_Bucket) ProtoMessage() {}
+
+func (x *Histogram_Bucket) ProtoReflect() protoreflect.Message {
+	mi := &file_aggregation_message_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Histogram_Bucket.ProtoReflect.Descriptor instead.
+func (*Histogram_Bucket) Descriptor() ([]byte, []int) {
+	return file_aggregation_message_proto_rawDescGZIP(), []int{3, 0}
+}
+
+func (x *Histogram_Bucket) GetMin() float64 {
+	if x != nil {
+		return x.Min
+	}
+	return 0
+}
+
+func (x *Histogram_Bucket) GetMax() float64 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+func (x *Histogram_Bucket) GetCount() uint32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+var File_aggregation_message_proto protoreflect.FileDescriptor
+
+var file_aggregation_message_proto_rawDesc = []byte{
+	0x0a, 0x19, 0x61, 0x67, 0x67, 0x72, 0x65, 0x67, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x11, 0x74, 0x65, 0x63,
+	0x68, 0x73, 0x63, 0x68, 0x6f, 0x6f, 0x6c, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x22, 0x38,
+	0x0a, 0x0a, 0x46, 0x61, 0x63, 0x65, 0x74, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c,
+	0x75, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x22, 0x57, 0x0a, 0x0a, 0x50, 0x72, 0x69, 0x63,
+	0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x17, 0x0a, 0x07, 0x6d, 0x69, 0x6e, 0x5f, 0x75, 0x73,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x06, 0x6d, 0x69, 0x6e, 0x55, 0x73, 0x64, 0x12,
+	0x17, 0x0a, 0x07, 0x6d, 0x61, 0x78, 0x5f, 0x75, 0x73, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x06, 0x6d, 0x61, 0x78, 0x55, 0x73, 0x64, 0x12, 0x17, 0x0a, 0x07, 0x61, 0x76, 0x67, 0x5f,
+	0x75, 0x73, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x06, 0x61, 0x76, 0x67, 0x55, 0x73,
+	0x64, 0x22, 0x65, 0x0a, 0x0d, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x53, 0x70,
+	0x65, 0x63, 0x12, 0x38, 0x0a, 0x05, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0e, 0x32, 0x22, 0x2e, 0x74, 0x65, 0x63, 0x68, 0x73, 0x63, 0x68, 0x6f, 0x6f, 0x6c, 0x2e, 0x70,
+	0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x2e,
+	0x46, 0x69, 0x65, 0x6c, 0x64, 0x52, 0x05, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x1a, 0x0a, 0x08,
+	0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x08,
+	0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x22, 0xf5, 0x02, 0x0a, 0x09, 0x48, 0x69, 0x73,
+	0x74, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x12, 0x38, 0x0a, 0x05, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x22, 0x2e, 0x74, 0x65, 0x63, 0x68, 0x73, 0x63, 0x68, 0x6f,
+	0x6f, 0x6c, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x67,
+	0x72, 0x61, 0x6d, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x52, 0x05, 0x66, 0x69, 0x65, 0x6c, 0x64,
+	0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x08, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x12, 0x3d, 0x0a, 0x07,
+	0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x23, 0x2e,
+	0x74, 0x65, 0x63, 0x68, 0x73, 0x63, 0x68, 0x6f, 0x6f, 0x6c, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f,
+	0x6b, 0x2e, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x2e, 0x42, 0x75, 0x63, 0x6b,
+	0x65, 0x74, 0x52, 0x07, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x1a, 0x42, 0x0a, 0x06, 0x42,
+	0x75, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x69, 0x6e, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x03, 0x6d, 0x69, 0x6e, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x61, 0x78, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x01, 0x52, 0x03, 0x6d, 0x61, 0x78, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x22,
+	0x8e, 0x01, 0x0a, 0x05, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b,
+	0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09, 0x50, 0x52, 0x49, 0x43, 0x45, 0x5f,
+	0x55, 0x53, 0x44, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x52, 0x41, 0x4d, 0x5f, 0x47, 0x42, 0x10,
+	0x02, 0x12, 0x0d, 0x0a, 0x09, 0x43, 0x50, 0x55, 0x5f, 0x43, 0x4f, 0x52, 0x45, 0x53, 0x10, 0x03,
+	0x12, 0x0b, 0x0a, 0x07, 0x43, 0x50, 0x55, 0x5f, 0x47, 0x48, 0x5a, 0x10, 0x04, 0x12, 0x0a, 0x0a,
+	0x06, 0x53, 0x53, 0x44, 0x5f, 0x47, 0x42, 0x10, 0x05, 0x12, 0x14, 0x0a, 0x10, 0x53, 0x43, 0x52,
+	0x45, 0x45, 0x4e, 0x5f, 0x53, 0x49, 0x5a, 0x45, 0x5f, 0x49, 0x4e, 0x43, 0x48, 0x10, 0x06, 0x12,
+	0x0d, 0x0a, 0x09, 0x57, 0x45, 0x49, 0x47, 0x48, 0x54, 0x5f, 0x4b, 0x47, 0x10, 0x07, 0x12, 0x10,
+	0x0a, 0x0c, 0x52, 0x45, 0x4c, 0x45, 0x41, 0x53, 0x45, 0x5f, 0x59, 0x45, 0x41, 0x52, 0x10, 0x08,
+	0x42, 0x07, 0x5a, 0x05, 0x2e, 0x2e, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
+}
+
+var (
+	file_aggregation_message_proto_rawDescOnce sync.Once
+	file_aggregation_message_proto_rawDescData = file_aggregation_message_proto_rawDesc
+)
+
+func file_aggregation_message_proto_rawDescGZIP() []byte {
+	file_aggregation_message_proto_rawDescOnce.Do(func() {
+		file_aggregation_message_proto_rawDescData = protoimpl.X.CompressGZIP(file_aggregation_message_proto_rawDescData)
+	})
+	return file_aggregation_message_proto_rawDescData
+}
+
+var file_aggregation_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_aggregation_message_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_aggregation_message_proto_goTypes = []interface{}{
+	(Histogram_Field)(0),     // 0: techschool.pcbook.Histogram.Field
+	(*FacetCount)(nil),       // 1: techschool.pcbook.FacetCount
+	(*PriceStats)(nil),       // 2: techschool.pcbook.PriceStats
+	(*HistogramSpec)(nil),    // 3: techschool.pcbook.HistogramSpec
+	(*Histogram)(nil),        // 4: techschool.pcbook.Histogram
+	(*Histogram_Bucket)(nil), // 5: techschool.pcbook.Histogram.Bucket
+}
+var file_aggregation_message_proto_depIdxs = []int32{
+	0, // 0: techschool.pcbook.HistogramSpec.field:type_name -> techschool.pcbook.Histogram.Field
+	0, // 1: techschool.pcbook.Histogram.field:type_name -> techschool.pcbook.Histogram.Field
+	5, // 2: techschool.pcbook.Histogram.buckets:type_name -> techschool.pcbook.Histogram.Bucket
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_aggregation_message_proto_init() }
+func file_aggregation_message_proto_init() {
+	if File_aggregation_message_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_aggregation_message_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FacetCount); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_aggregation_message_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PriceStats); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_aggregation_message_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HistogramSpec); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_aggregation_message_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Histogram); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_aggregation_message_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Histogram_Bucket); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_aggregation_message_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_aggregation_message_proto_goTypes,
+		DependencyIndexes: file_aggregation_message_proto_depIdxs,
+		EnumInfos:         file_aggregation_message_proto_enumTypes,
+		MessageInfos:      file_aggregation_message_proto_msgTypes,
+	}.Build()
+	File_aggregation_message_proto = out.File
+	file_aggregation_message_proto_rawDesc = nil
+	file_aggregation_message_proto_goTypes = nil
+	file_aggregation_message_proto_depIdxs = nil
+}
@@ -0,0 +1,224 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.26.0
+// 	protoc        v4.23.0
+// source: error_message.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ErrorReason is the reason of the google.rpc.ErrorInfo detail of the service errors
+type ErrorReason int32
+
+const (
+	ErrorReason_ERROR_REASON_UNSPECIFIED ErrorReason = 0
+	ErrorReason_INVALID_ARGUMENT         ErrorReason = 1
+	ErrorReason_INVALID_LAPTOP           ErrorReason = 2
+	ErrorReason_LAPTOP_NOT_FOUND         ErrorReason = 3
+	ErrorReason_LAPTOP_ALREADY_EXISTS    ErrorReason = 4
+	ErrorReason_STALE_REVISION           ErrorReason = 5
+	ErrorReason_RESUME_TOKEN_EXPIRED     ErrorReason = 6
+	ErrorReason_IMAGE_TOO_LARGE          ErrorReason = 7
+	ErrorReason_STORE_UNAVAILABLE        ErrorReason = 8
+	ErrorReason_INTERNAL_ERROR           ErrorReason = 9
+	ErrorReason_REQUEST_CANCELED         ErrorReason = 10
+	ErrorReason_DEADLINE_EXCEEDED        ErrorReason = 11
+	ErrorReason_STREAM_FAILURE           ErrorReason = 12
+	ErrorReason_INVALID_CREDENTIALS      ErrorReason = 13
+	ErrorReason_MISSING_ACCESS_TOKEN     ErrorReason = 14
+	ErrorReason_INVALID_ACCESS_TOKEN     ErrorReason = 15
+	ErrorReason_PERMISSION_DENIED        ErrorReason = 16
+	ErrorReason_IDEMPOTENCY_KEY_REUSED   ErrorReason = 17
+	ErrorReason_IMAGE_NOT_FOUND          ErrorReason = 18
+	ErrorReason_UPLOAD_NOT_FOUND         ErrorReason = 19
+	ErrorReason_UPLOAD_OFFSET_MISMATCH   ErrorReason = 20
+	ErrorReason_UPLOAD_CHECKSUM_MISMATCH ErrorReason = 21
+	ErrorReason_UPLOAD_FINISHED          ErrorReason = 22
+)
+
+// Enum value maps for ErrorReason.
+var (
+	ErrorReason_name = map[int32]string{
+		0:  "ERROR_REASON_UNSPECIFIED",
+		1:  "INVALID_ARGUMENT",
+		2:  "INVALID_LAPTOP",
+		3:  "LAPTOP_NOT_FOUND",
+		4:  "LAPTOP_ALREADY_EXISTS",
+		5:  "STALE_REVISION",
+		6:  "RESUME_TOKEN_EXPIRED",
+		7:  "IMAGE_TOO_LARGE",
+		8:  "STORE_UNAVAILABLE",
+		9:  "INTERNAL_ERROR",
+		10: "REQUEST_CANCELED",
+		11: "DEADLINE_EXCEEDED",
+		12: "STREAM_FAILURE",
+		13: "INVALID_CREDENTIALS",
+		14: "MISSING_ACCESS_TOKEN",
+		15: "INVALID_ACCESS_TOKEN",
+		16: "PERMISSION_DENIED",
+		17: "IDEMPOTENCY_KEY_REUSED",
+		18: "IMAGE_NOT_FOUND",
+		19: "UPLOAD_NOT_FOUND",
+		20: "UPLOAD_OFFSET_MISMATCH",
+		21: "UPLOAD_CHECKSUM_MISMATCH",
+		22: "UPLOAD_FINISHED",
+	}
+	ErrorReason_value = map[string]int32{
+		"ERROR_REASON_UNSPECIFIED": 0,
+		"INVALID_ARGUMENT":         1,
+		"INVALID_LAPTOP":           2,
+		"LAPTOP_NOT_FOUND":         3,
+		"LAPTOP_ALREADY_EXISTS":    4,
+		"STALE_REVISION":           5,
+		"RESUME_TOKEN_EXPIRED":     6,
+		"IMAGE_TOO_LARGE":          7,
+		"STORE_UNAVAILABLE":        8,
+		"INTERNAL_ERROR":           9,
+		"REQUEST_CANCELED":         10,
+		"DEADLINE_EXCEEDED":        11,
+		"STREAM_FAILURE":           12,
+		"INVALID_CREDENTIALS":      13,
+		"MISSING_ACCESS_TOKEN":     14,
+		"INVALID_ACCESS_TOKEN":     15,
+		"PERMISSION_DENIED":        16,
+		"IDEMPOTENCY_KEY_REUSED":   17,
+		"IMAGE_NOT_FOUND":          18,
+		"UPLOAD_NOT_FOUND":         19,
+		"UPLOAD_OFFSET_MISMATCH":   20,
+		"UPLOAD_CHECKSUM_MISMATCH": 21,
+		"UPLOAD_FINISHED":          22,
+	}
+)
+
+func (x ErrorReason) Enum() *ErrorReason {
+	p := new(ErrorReason)
+	*p = x
+	return p
+}
+
+func (x ErrorReason) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ErrorReason) Descriptor() protoreflect.EnumDescriptor {
+	return file_error_message_proto_enumTypes[0].Descriptor()
+}
+
+func (ErrorReason) Type() protoreflect.EnumType {
+	return &file_error_message_proto_enumTypes[0]
+}
+
+func (x ErrorReason) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ErrorReason.Descriptor instead.
+func (ErrorReason) EnumDescriptor() ([]byte, []int) {
+	return file_error_message_proto_rawDescGZIP(), []int{0}
+}
+
+var File_error_message_proto protoreflect.FileDescriptor
+
+var file_error_message_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x11, 0x74, 0x65, 0x63, 0x68, 0x73, 0x63, 0x68, 0x6f, 0x6f,
+	0x6c, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2a, 0xaf, 0x04, 0x0a, 0x0b, 0x45, 0x72, 0x72,
+	0x6f, 0x72, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x1c, 0x0a, 0x18, 0x45, 0x52, 0x52, 0x4f,
+	0x52, 0x5f, 0x52, 0x45, 0x41, 0x53, 0x4f, 0x4e, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49,
+	0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x14, 0x0a, 0x10, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49,
+	0x44, 0x5f, 0x41, 0x52, 0x47, 0x55, 0x4d, 0x45, 0x4e, 0x54, 0x10, 0x01, 0x12, 0x12, 0x0a, 0x0e,
+	0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x4c, 0x41, 0x50, 0x54, 0x4f, 0x50, 0x10, 0x02,
+	0x12, 0x14, 0x0a, 0x10, 0x4c, 0x41, 0x50, 0x54, 0x4f, 0x50, 0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x46,
+	0x4f, 0x55, 0x4e, 0x44, 0x10, 0x03, 0x12, 0x19, 0x0a, 0x15, 0x4c, 0x41, 0x50, 0x54, 0x4f, 0x50,
+	0x5f, 0x41, 0x4c, 0x52, 0x45, 0x41, 0x44, 0x59, 0x5f, 0x45, 0x58, 0x49, 0x53, 0x54, 0x53, 0x10,
+	0x04, 0x12, 0x12, 0x0a, 0x0e, 0x53, 0x54, 0x41, 0x4c, 0x45, 0x5f, 0x52, 0x45, 0x56, 0x49, 0x53,
+	0x49, 0x4f, 0x4e, 0x10, 0x05, 0x12, 0x18, 0x0a, 0x14, 0x52, 0x45, 0x53, 0x55, 0x4d, 0x45, 0x5f,
+	0x54, 0x4f, 0x4b, 0x45, 0x4e, 0x5f, 0x45, 0x58, 0x50, 0x49, 0x52, 0x45, 0x44, 0x10, 0x06, 0x12,
+	0x13, 0x0a, 0x0f, 0x49, 0x4d, 0x41, 0x47, 0x45, 0x5f, 0x54, 0x4f, 0x4f, 0x5f, 0x4c, 0x41, 0x52,
+	0x47, 0x45, 0x10, 0x07, 0x12, 0x15, 0x0a, 0x11, 0x53, 0x54, 0x4f, 0x52, 0x45, 0x5f, 0x55, 0x4e,
+	0x41, 0x56, 0x41, 0x49, 0x4c, 0x41, 0x42, 0x4c, 0x45, 0x10, 0x08, 0x12, 0x12, 0x0a, 0x0e, 0x49,
+	0x4e, 0x54, 0x45, 0x52, 0x4e, 0x41, 0x4c, 0x5f, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x10, 0x09, 0x12,
+	0x14, 0x0a, 0x10, 0x52, 0x45, 0x51, 0x55, 0x45, 0x53, 0x54, 0x5f, 0x43, 0x41, 0x4e, 0x43, 0x45,
+	0x4c, 0x45, 0x44, 0x10, 0x0a, 0x12, 0x15, 0x0a, 0x11, 0x44, 0x45, 0x41, 0x44, 0x4c, 0x49, 0x4e,
+	0x45, 0x5f, 0x45, 0x58, 0x43, 0x45, 0x45, 0x44, 0x45, 0x44, 0x10, 0x0b, 0x12, 0x12, 0x0a, 0x0e,
+	0x53, 0x54, 0x52, 0x45, 0x41, 0x4d, 0x5f, 0x46, 0x41, 0x49, 0x4c, 0x55, 0x52, 0x45, 0x10, 0x0c,
+	0x12, 0x17, 0x0a, 0x13, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x43, 0x52, 0x45, 0x44,
+	0x45, 0x4e, 0x54, 0x49, 0x41, 0x4c, 0x53, 0x10, 0x0d, 0x12, 0x18, 0x0a, 0x14, 0x4d, 0x49, 0x53,
+	0x53, 0x49, 0x4e, 0x47, 0x5f, 0x41, 0x43, 0x43, 0x45, 0x53, 0x53, 0x5f, 0x54, 0x4f, 0x4b, 0x45,
+	0x4e, 0x10, 0x0e, 0x12, 0x18, 0x0a, 0x14, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x41,
+	0x43, 0x43, 0x45, 0x53, 0x53, 0x5f, 0x54, 0x4f, 0x4b, 0x45, 0x4e, 0x10, 0x0f, 0x12, 0x15, 0x0a,
+	0x11, 0x50, 0x45, 0x52, 0x4d, 0x49, 0x53, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x44, 0x45, 0x4e, 0x49,
+	0x45, 0x44, 0x10, 0x10, 0x12, 0x1a, 0x0a, 0x16, 0x49, 0x44, 0x45, 0x4d, 0x50, 0x4f, 0x54, 0x45,
+	0x4e, 0x43, 0x59, 0x5f, 0x4b, 0x45, 0x59, 0x5f, 0x52, 0x45, 0x55, 0x53, 0x45, 0x44, 0x10, 0x11,
+	0x12, 0x13, 0x0a, 0x0f, 0x49, 0x4d, 0x41, 0x47, 0x45, 0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x46, 0x4f,
+	0x55, 0x4e, 0x44, 0x10, 0x12, 0x12, 0x14, 0x0a, 0x10, 0x55, 0x50, 0x4c, 0x4f, 0x41, 0x44, 0x5f,
+	0x4e, 0x4f, 0x54, 0x5f, 0x46, 0x4f, 0x55, 0x4e, 0x44, 0x10, 0x13, 0x12, 0x1a, 0x0a, 0x16, 0x55,
+	0x50, 0x4c, 0x4f, 0x41, 0x44, 0x5f, 0x4f, 0x46, 0x46, 0x53, 0x45, 0x54, 0x5f, 0x4d, 0x49, 0x53,
+	0x4d, 0x41, 0x54, 0x43, 0x48, 0x10, 0x14, 0x12, 0x1c, 0x0a, 0x18, 0x55, 0x50, 0x4c, 0x4f, 0x41,
+	0x44, 0x5f, 0x43, 0x48, 0x45, 0x43, 0x4b, 0x53, 0x55, 0x4d, 0x5f, 0x4d, 0x49, 0x53, 0x4d, 0x41,
+	0x54, 0x43, 0x48, 0x10, 0x15, 0x12, 0x13, 0x0a, 0x0f, 0x55, 0x50, 0x4c, 0x4f, 0x41, 0x44, 0x5f,
+	0x46, 0x49, 0x4e, 0x49, 0x53, 0x48, 0x45, 0x44, 0x10, 0x16, 0x42, 0x07, 0x5a, 0x05, 0x2e, 0x2e,
+	0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_error_message_proto_rawDescOnce sync.Once
+	file_error_message_proto_rawDescData = file_error_message_proto_rawDesc
+)
+
+func file_error_message_proto_rawDescGZIP() []byte {
+	file_error_message_proto_rawDescOnce.Do(func() {
+		file_error_message_proto_rawDescData = protoimpl.X.CompressGZIP(file_error_message_proto_rawDescData)
+	})
+	return file_error_message_proto_rawDescData
+}
+
+var file_error_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_error_message_proto_goTypes = []interface{}{
+	(ErrorReason)(0), // 0: techschool.pcbook.ErrorReason
+}
+var file_error_message_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_error_message_proto_init() }
+func file_error_message_proto_init() {
+	if File_error_message_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_error_message_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   0,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_error_message_proto_goTypes,
+		DependencyIndexes: file_error_message_proto_depIdxs,
+		EnumInfos:         file_error_message_proto_enumTypes,
+	}.Build()
+	File_error_message_proto = out.File
+	file_error_message_proto_rawDesc = nil
+	file_error_message_proto_goTypes = nil
+	file_error_message_proto_depIdxs = nil
+}
@@ -0,0 +1,143 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.26.0
+// 	protoc        v4.23.0
+// source: sort_message.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SortField int32
+
+const (
+	SortField_ID             SortField = 0
+	SortField_PRICE          SortField = 1
+	SortField_RELEASE_YEAR   SortField = 2
+	SortField_UPDATE_AT      SortField = 3
+	SortField_AVERAGE_RATING SortField = 4
+	SortField_RELEVANCE      SortField = 5
+)
+
+// Enum value maps for SortField.
+var (
+	SortField_name = map[int32]string{
+		0: "ID",
+		1: "PRICE",
+		2: "RELEASE_YEAR",
+		3: "UPDATE_AT",
+		4: "AVERAGE_RATING",
+		5: "RELEVANCE",
+	}
+	SortField_value = map[string]int32{
+		"ID":             0,
+		"PRICE":          1,
+		"RELEASE_YEAR":   2,
+		"UPDATE_AT":      3,
+		"AVERAGE_RATING": 4,
+		"RELEVANCE":      5,
+	}
+)
+
+func (x SortField) Enum() *SortField {
+	p := new(SortField)
+	*p = x
+	return p
+}
+
+func (x SortField) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SortField) Descriptor() protoreflect.EnumDescriptor {
+	return file_sort_message_proto_enumTypes[0].Descriptor()
+}
+
+func (SortField) Type() protoreflect.EnumType {
+	return &file_sort_message_proto_enumTypes[0]
+}
+
+func (x SortField) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SortField.Descriptor instead.
+func (SortField) EnumDescriptor() ([]byte, []int) {
+	return file_sort_message_proto_rawDescGZIP(), []int{0}
+}
+
+var File_sort_message_proto protoreflect.FileDescriptor
+
+var file_sort_message_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x73, 0x6f, 0x72, 0x74, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x11, 0x74, 0x65, 0x63, 0x68, 0x73, 0x63, 0x68, 0x6f, 0x6f, 0x6c,
+	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2a, 0x62, 0x0a, 0x09, 0x53, 0x6f, 0x72, 0x74, 0x46,
+	0x69, 0x65, 0x6c, 0x64, 0x12, 0x06, 0x0a, 0x02, 0x49, 0x44, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05,
+	0x50, 0x52, 0x49, 0x43, 0x45, 0x10, 0x01, 0x12, 0x10, 0x0a, 0x0c, 0x52, 0x45, 0x4c, 0x45, 0x41,
+	0x53, 0x45, 0x5f, 0x59, 0x45, 0x41, 0x52, 0x10, 0x02, 0x12, 0x0d, 0x0a, 0x09, 0x55, 0x50, 0x44,
+	0x41, 0x54, 0x45, 0x5f, 0x41, 0x54, 0x10, 0x03, 0x12, 0x12, 0x0a, 0x0e, 0x41, 0x56, 0x45, 0x52,
+	0x41, 0x47, 0x45, 0x5f, 0x52, 0x41, 0x54, 0x49, 0x4e, 0x47, 0x10, 0x04, 0x12, 0x0d, 0x0a, 0x09,
+	0x52, 0x45, 0x4c, 0x45, 0x56, 0x41, 0x4e, 0x43, 0x45, 0x10, 0x05, 0x42, 0x07, 0x5a, 0x05, 0x2e,
+	0x2e, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_sort_message_proto_rawDescOnce sync.Once
+	file_sort_message_proto_rawDescData = file_sort_message_proto_rawDesc
+)
+
+func file_sort_message_proto_rawDescGZIP() []byte {
+	file_sort_message_proto_rawDescOnce.Do(func() {
+		file_sort_message_proto_rawDescData = protoimpl.X.CompressGZIP(file_sort_message_proto_rawDescData)
+	})
+	return file_sort_message_proto_rawDescData
+}
+
+var file_sort_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_sort_message_proto_goTypes = []interface{}{
+	(SortField)(0), // 0: techschool.pcbook.SortField
+}
+var file_sort_message_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_sort_message_proto_init() }
+func file_sort_message_proto_init() {
+	if File_sort_message_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_sort_message_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   0,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_sort_message_proto_goTypes,
+		DependencyIndexes: file_sort_message_proto_depIdxs,
+		EnumInfos:         file_sort_message_proto_enumTypes,
+	}.Build()
+	File_sort_message_proto = out.File
+	file_sort_message_proto_rawDesc = nil
+	file_sort_message_proto_goTypes = nil
+	file_sort_message_proto_depIdxs = nil
+}
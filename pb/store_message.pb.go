@@ -0,0 +1,493 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.26.0
+// 	protoc        v4.23.0
+// source: store_message.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LaptopRecord_Op int32
+
+const (
+	LaptopRecord_UNKNOWN     LaptopRecord_Op = 0
+	LaptopRecord_PUT         LaptopRecord_Op = 1
+	LaptopRecord_DELETE      LaptopRecord_Op = 2
+	LaptopRecord_SOFT_DELETE LaptopRecord_Op = 3
+)
+
+// Enum value maps for LaptopRecord_Op.
+var (
+	LaptopRecord_Op_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "PUT",
+		2: "DELETE",
+		3: "SOFT_DELETE",
+	}
+	LaptopRecord_Op_value = map[string]int32{
+		"UNKNOWN":     0,
+		"PUT":         1,
+		"DELETE":      2,
+		"SOFT_DELETE": 3,
+	}
+)
+
+func (x LaptopRecord_Op) Enum() *LaptopRecord_Op {
+	p := new(LaptopRecord_Op)
+	*p = x
+	return p
+}
+
+func (x LaptopRecord_Op) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (LaptopRecord_Op) Descriptor() protoreflect.EnumDescriptor {
+	return file_store_message_proto_enumTypes[0].Descriptor()
+}
+
+func (LaptopRecord_Op) Type() protoreflect.EnumType {
+	return &file_store_message_proto_enumTypes[0]
+}
+
+func (x LaptopRecord_Op) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use LaptopRecord_Op.Descriptor instead.
+func (LaptopRecord_Op) EnumDescriptor() ([]byte, []int) {
+	return file_store_message_proto_rawDescGZIP(), []int{0, 0}
+}
+
+// LaptopRecord is a mutation appended to the write-ahead log of a laptop store
+type LaptopRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Op     LaptopRecord_Op `protobuf:"varint,1,opt,name=op,proto3,enum=techschool.pcbook.LaptopRecord_Op" json:"op,omitempty"`
+	Laptop *Laptop         `protobuf:"bytes,2,opt,name=laptop,proto3" json:"laptop,omitempty"`
+	Id     string          `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *LaptopRecord) Reset() {
+	*x = LaptopRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_store_message_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LaptopRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LaptopRecord) ProtoMessage() {}
+
+func (x *LaptopRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_store_message_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LaptopRecord.ProtoReflect.Descriptor instead.
+func (*LaptopRecord) Descriptor() ([]byte, []int) {
+	return file_store_message_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LaptopRecord) GetOp() LaptopRecord_Op {
+	if x != nil {
+		return x.Op
+	}
+	return LaptopRecord_UNKNOWN
+}
+
+func (x *LaptopRecord) GetLaptop() *Laptop {
+	if x != nil {
+		return x.Laptop
+	}
+	return nil
+}
+
+func (x *LaptopRecord) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// LaptopSnapshot is the whole content of a laptop store
+type LaptopSnapshot struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Laptops []*Laptop `protobuf:"bytes,1,rep,name=laptops,proto3" json:"laptops,omitempty"`
+	Deleted []*Laptop `protobuf:"bytes,2,rep,name=deleted,proto3" json:"deleted,omitempty"`
+}
+
+func (x *LaptopSnapshot) Reset() {
+	*x = LaptopSnapshot{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_store_message_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LaptopSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LaptopSnapshot) ProtoMessage() {}
+
+func (x *LaptopSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_store_message_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LaptopSnapshot.ProtoReflect.Descriptor instead.
+func (*LaptopSnapshot) Descriptor() ([]byte, []int) {
+	return file_store_message_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LaptopSnapshot) GetLaptops() []*Laptop {
+	if x != nil {
+		return x.Laptops
+	}
+	return nil
+}
+
+func (x *LaptopSnapshot) GetDeleted() []*Laptop {
+	if x != nil {
+		return x.Deleted
+	}
+	return nil
+}
+
+// ImageRecord is the metadata of an image saved by a disk image store
+type ImageRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id         string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	LaptopId   string                 `protobuf:"bytes,2,opt,name=laptop_id,json=laptopId,proto3" json:"laptop_id,omitempty"`
+	ImageType  string                 `protobuf:"bytes,3,opt,name=image_type,json=imageType,proto3" json:"image_type,omitempty"`
+	Size       int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	Checksum   []byte                 `protobuf:"bytes,5,opt,name=checksum,proto3" json:"checksum,omitempty"` //SHA-256
+	UploadedAt *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=uploaded_at,json=uploadedAt,proto3" json:"uploaded_at,omitempty"`
+}
+
+func (x *ImageRecord) Reset() {
+	*x = ImageRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_store_message_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ImageRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageRecord) ProtoMessage() {}
+
+func (x *ImageRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_store_message_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageRecord.ProtoReflect.Descriptor instead.
+func (*ImageRecord) Descriptor() ([]byte, []int) {
+	return file_store_message_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ImageRecord) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ImageRecord) GetLaptopId() string {
+	if x != nil {
+		return x.LaptopId
+	}
+	return ""
+}
+
+func (x *ImageRecord) GetImageType() string {
+	if x != nil {
+		return x.ImageType
+	}
+	return ""
+}
+
+func (x *ImageRecord) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *ImageRecord) GetChecksum() []byte {
+	if x != nil {
+		return x.Checksum
+	}
+	return nil
+}
+
+func (x *ImageRecord) GetUploadedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UploadedAt
+	}
+	return nil
+}
+
+// ImageManifest is the index of a disk image store, the images of each laptop are in FindByLaptop order
+type ImageManifest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Images []*ImageRecord `protobuf:"bytes,1,rep,name=images,proto3" json:"images,omitempty"`
+}
+
+func (x *ImageManifest) Reset() {
+	*x = ImageManifest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_store_message_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ImageManifest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageManifest) ProtoMessage() {}
+
+func (x *ImageManifest) ProtoReflect() protoreflect.Message {
+	mi := &file_store_message_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageManifest.ProtoReflect.Descriptor instead.
+func (*ImageManifest) Descriptor() ([]byte, []int) {
+	return file_store_message_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ImageManifest) GetImages() []*ImageRecord {
+	if x != nil {
+		return x.Images
+	}
+	return nil
+}
+
+var File_store_message_proto protoreflect.FileDescriptor
+
+var file_store_message_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x73, 0x74, 0x6f, 0x72, 0x65, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x11, 0x74, 0x65, 0x63, 0x68, 0x73, 0x63, 0x68, 0x6f, 0x6f,
+	0x6c, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x1a, 0x14, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70,
+	0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1f,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f,
+	0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22,
+	0xbe, 0x01, 0x0a, 0x0c, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64,
+	0x12, 0x32, 0x0a, 0x02, 0x6f, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x22, 0x2e, 0x74,
+	0x65, 0x63, 0x68, 0x73, 0x63, 0x68, 0x6f, 0x6f, 0x6c, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b,
+	0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x2e, 0x4f, 0x70,
+	0x52, 0x02, 0x6f, 0x70, 0x12, 0x31, 0x0a, 0x06, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x74, 0x65, 0x63, 0x68, 0x73, 0x63, 0x68, 0x6f, 0x6f,
+	0x6c, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52,
+	0x06, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x22, 0x37, 0x0a, 0x02, 0x4f, 0x70, 0x12, 0x0b, 0x0a,
+	0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x07, 0x0a, 0x03, 0x50, 0x55,
+	0x54, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x44, 0x45, 0x4c, 0x45, 0x54, 0x45, 0x10, 0x02, 0x12,
+	0x0f, 0x0a, 0x0b, 0x53, 0x4f, 0x46, 0x54, 0x5f, 0x44, 0x45, 0x4c, 0x45, 0x54, 0x45, 0x10, 0x03,
+	0x22, 0x7a, 0x0a, 0x0e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68,
+	0x6f, 0x74, 0x12, 0x33, 0x0a, 0x07, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x73, 0x18, 0x01, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x74, 0x65, 0x63, 0x68, 0x73, 0x63, 0x68, 0x6f, 0x6f, 0x6c,
+	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x07,
+	0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x73, 0x12, 0x33, 0x0a, 0x07, 0x64, 0x65, 0x6c, 0x65, 0x74,
+	0x65, 0x64, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x74, 0x65, 0x63, 0x68, 0x73,
+	0x63, 0x68, 0x6f, 0x6f, 0x6c, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70,
+	0x74, 0x6f, 0x70, 0x52, 0x07, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64, 0x22, 0xc6, 0x01, 0x0a,
+	0x0b, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x0e, 0x0a, 0x02,
+	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1b, 0x0a, 0x09,
+	0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x49, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x69, 0x6d, 0x61,
+	0x67, 0x65, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69,
+	0x6d, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69, 0x7a, 0x65,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x12, 0x1a, 0x0a, 0x08,
+	0x63, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08,
+	0x63, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x12, 0x3b, 0x0a, 0x0b, 0x75, 0x70, 0x6c, 0x6f,
+	0x61, 0x64, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0a, 0x75, 0x70, 0x6c, 0x6f, 0x61,
+	0x64, 0x65, 0x64, 0x41, 0x74, 0x22, 0x47, 0x0a, 0x0d, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x4d, 0x61,
+	0x6e, 0x69, 0x66, 0x65, 0x73, 0x74, 0x12, 0x36, 0x0a, 0x06, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x73,
+	0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x74, 0x65, 0x63, 0x68, 0x73, 0x63, 0x68,
+	0x6f, 0x6f, 0x6c, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65,
+	0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x06, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x73, 0x42, 0x07,
+	0x5a, 0x05, 0x2e, 0x2e, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_store_message_proto_rawDescOnce sync.Once
+	file_store_message_proto_rawDescData = file_store_message_proto_rawDesc
+)
+
+func file_store_message_proto_rawDescGZIP() []byte {
+	file_store_message_proto_rawDescOnce.Do(func() {
+		file_store_message_proto_rawDescData = protoimpl.X.CompressGZIP(file_store_message_proto_rawDescData)
+	})
+	return file_store_message_proto_rawDescData
+}
+
+var file_store_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_store_message_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_store_message_proto_goTypes = []interface{}{
+	(LaptopRecord_Op)(0),          // 0: techschool.pcbook.LaptopRecord.Op
+	(*LaptopRecord)(nil),          // 1: techschool.pcbook.LaptopRecord
+	(*LaptopSnapshot)(nil),        // 2: techschool.pcbook.LaptopSnapshot
+	(*ImageRecord)(nil),           // 3: techschool.pcbook.ImageRecord
+	(*ImageManifest)(nil),         // 4: techschool.pcbook.ImageManifest
+	(*Laptop)(nil),                // 5: techschool.pcbook.Laptop
+	(*timestamppb.Timestamp)(nil), // 6: google.protobuf.Timestamp
+}
+var file_store_message_proto_depIdxs = []int32{
+	0, // 0: techschool.pcbook.LaptopRecord.op:type_name -> techschool.pcbook.LaptopRecord.Op
+	5, // 1: techschool.pcbook.LaptopRecord.laptop:type_name -> techschool.pcbook.Laptop
+	5, // 2: techschool.pcbook.LaptopSnapshot.laptops:type_name -> techschool.pcbook.Laptop
+	5, // 3: techschool.pcbook.LaptopSnapshot.deleted:type_name -> techschool.pcbook.Laptop
+	6, // 4: techschool.pcbook.ImageRecord.uploaded_at:type_name -> google.protobuf.Timestamp
+	3, // 5: techschool.pcbook.ImageManifest.images:type_name -> techschool.pcbook.ImageRecord
+	6, // [6:6] is the sub-list for method output_type
+	6, // [6:6] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_store_message_proto_init() }
+func file_store_message_proto_init() {
+	if File_store_message_proto != nil {
+		return
+	}
+	file_laptop_message_proto_init()
+	if !protoimpl.UnsafeEnabled {
+		file_store_message_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LaptopRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_store_message_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LaptopSnapshot); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_store_message_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ImageRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_store_message_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ImageManifest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_store_message_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_store_message_proto_goTypes,
+		DependencyIndexes: file_store_message_proto_depIdxs,
+		EnumInfos:         file_store_message_proto_enumTypes,
+		MessageInfos:      file_store_message_proto_msgTypes,
+	}.Build()
+	File_store_message_proto = out.File
+	file_store_message_proto_rawDesc = nil
+	file_store_message_proto_goTypes = nil
+	file_store_message_proto_depIdxs = nil
+}
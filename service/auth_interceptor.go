@@ -2,12 +2,13 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"proto_demo/pb"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 type AuthInterceptor struct {
@@ -62,18 +63,18 @@ func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string
 
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return status.Errorf(codes.Unauthenticated, "metadata is not provided")
+		return statusError(codes.Unauthenticated, pb.ErrorReason_MISSING_ACCESS_TOKEN, "metadata is not provided")
 	}
 
 	value := md["authorization"]
 	if len(value) == 0 {
-		return status.Errorf(codes.Unauthenticated, "authorization token is not provided")
+		return statusError(codes.Unauthenticated, pb.ErrorReason_MISSING_ACCESS_TOKEN, "authorization token is not provided")
 	}
 
 	accessToken := value[0]
 	claims, err := interceptor.jwtManager.Verify(accessToken)
 	if err != nil {
-		return status.Errorf(codes.Unauthenticated, "access token is invalid:%v", err)
+		return statusError(codes.Unauthenticated, pb.ErrorReason_INVALID_ACCESS_TOKEN, fmt.Sprintf("access token is invalid:%v", err))
 	}
 
 	for _, role := range accessibleRoles {
@@ -81,6 +82,11 @@ func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string
 			return nil
 		}
 	}
-	return status.Errorf(codes.PermissionDenied, "no permission to access this RPC")
+	return newStatus(
+		codes.PermissionDenied,
+		pb.ErrorReason_PERMISSION_DENIED,
+		"no permission to access this RPC",
+		map[string]string{"method": method, "role": claims.Role},
+	).Err()
 
 }
@@ -5,7 +5,6 @@ import (
 	"proto_demo/pb"
 
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 type AuthServer struct {
@@ -19,14 +18,14 @@ func NewAuthServer(userstore UserStore, jwtManager *JwtManager) *AuthServer {
 func (server *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
 	user, err := server.userStore.Find(req.GetUsername())
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "cannot find user :%v", err)
+		return nil, storeError("cannot find user", err)
 	}
 	if user == nil || !user.IsCorrectPassword(req.GetPassword()) {
-		return nil, status.Errorf(codes.NotFound, "incorrect username/password")
+		return nil, statusError(codes.Unauthenticated, pb.ErrorReason_INVALID_CREDENTIALS, "incorrect username/password")
 	}
 	token, err := server.jwtManager.Generate(user)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "cannot generate access token")
+		return nil, internalError("cannot generate access token", err)
 	}
 	res := &pb.LoginResponse{
 		AccessToken: token,
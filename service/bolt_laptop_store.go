@@ -0,0 +1,569 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"proto_demo/pb"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	laptopBucket        = []byte("laptops")
+	deletedLaptopBucket = []byte("deleted_laptops")
+)
+
+// indexBucket is the bucket of a numeric field, its keys are the value followed by the laptop ID
+func indexBucket(field numericField) []byte {
+	return []byte("index_" + field.name)
+}
+
+// BoltLaptopStore stores laptops as protobuf bytes in a bolt database file,
+// with an index bucket for each numeric filter field
+type BoltLaptopStore struct {
+	// mutex serializes the changes so that the events have the same order as the database
+	mutex sync.Mutex
+	db    *bolt.DB
+	feed  *changeFeed
+}
+
+func NewBoltLaptopStore(path string) (*BoltLaptopStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open laptop database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		buckets := [][]byte{laptopBucket, deletedLaptopBucket}
+		for _, field := range numericFields {
+			buckets = append(buckets, indexBucket(field))
+		}
+		for _, name := range buckets {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot create laptop buckets: %w", err)
+	}
+
+	return &BoltLaptopStore{
+		db:   db,
+		feed: newChangeFeed(eventLogSize),
+	}, nil
+}
+
+// Close closes the database file
+func (store *BoltLaptopStore) Close() error {
+	return store.db.Close()
+}
+
+// floatKey encodes value so that the byte order of keys is the numeric order
+func floatKey(value float64) []byte {
+	bits := math.Float64bits(value)
+	if value >= 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, bits)
+	return key
+}
+
+func indexKey(field numericField, laptop *pb.Laptop) []byte {
+	return append(floatKey(field.value(laptop)), laptop.GetId()...)
+}
+
+func getLaptop(bucket *bolt.Bucket, id string) (*pb.Laptop, error) {
+	data := bucket.Get([]byte(id))
+	if data == nil {
+		return nil, nil
+	}
+	laptop := &pb.Laptop{}
+	err := proto.Unmarshal(data, laptop)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode laptop %s: %w", id, err)
+	}
+	return laptop, nil
+}
+
+func putLaptop(bucket *bolt.Bucket, laptop *pb.Laptop) error {
+	data, err := proto.Marshal(laptop)
+	if err != nil {
+		return fmt.Errorf("cannot encode laptop %s: %w", laptop.GetId(), err)
+	}
+	return bucket.Put([]byte(laptop.GetId()), data)
+}
+
+// addIndexes stores laptop in the laptops bucket and in the index buckets
+func addIndexes(tx *bolt.Tx, laptop *pb.Laptop) error {
+	err := putLaptop(tx.Bucket(laptopBucket), laptop)
+	if err != nil {
+		return err
+	}
+	for _, field := range numericFields {
+		err := tx.Bucket(indexBucket(field)).Put(indexKey(field, laptop), nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeIndexes removes laptop from the laptops bucket and from the index buckets
+func removeIndexes(tx *bolt.Tx, laptop *pb.Laptop) error {
+	err := tx.Bucket(laptopBucket).Delete([]byte(laptop.GetId()))
+	if err != nil {
+		return err
+	}
+	for _, field := range numericFields {
+		err := tx.Bucket(indexBucket(field)).Delete(indexKey(field, laptop))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *BoltLaptopStore) Save(laptop *pb.Laptop) error {
+	other, err := deepCopy(laptop)
+	if err != nil {
+		return err
+	}
+	other.Revision = 1
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		id := []byte(other.GetId())
+		if tx.Bucket(laptopBucket).Get(id) != nil || tx.Bucket(deletedLaptopBucket).Get(id) != nil {
+			return ErrAlreadyExists
+		}
+		return addIndexes(tx, other)
+	})
+	if err != nil {
+		return err
+	}
+	store.feed.Publish(pb.LaptopEvent_CREATED, other)
+	return nil
+}
+
+func (store *BoltLaptopStore) SaveAll(laptops []*pb.Laptop) error {
+	others := make([]*pb.Laptop, len(laptops))
+	for i, laptop := range laptops {
+		other, err := deepCopy(laptop)
+		if err != nil {
+			return &BatchError{Index: i, Err: err}
+		}
+		other.Revision = 1
+		others[i] = other
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		for i, other := range others {
+			id := []byte(other.GetId())
+			if tx.Bucket(laptopBucket).Get(id) != nil || tx.Bucket(deletedLaptopBucket).Get(id) != nil {
+				return &BatchError{Index: i, Err: ErrAlreadyExists}
+			}
+			err := addIndexes(tx, other)
+			if err != nil {
+				return &BatchError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		store.feed.Publish(pb.LaptopEvent_CREATED, other)
+	}
+	return nil
+}
+
+func (store *BoltLaptopStore) Find(id string) (*pb.Laptop, error) {
+	var laptop *pb.Laptop
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		laptop, err = getLaptop(tx.Bucket(laptopBucket), id)
+		return err
+	})
+	return laptop, err
+}
+
+func (store *BoltLaptopStore) Update(laptop *pb.Laptop, mask *fieldmaskpb.FieldMask) (*pb.Laptop, error) {
+	err := ValidateUpdateMask(mask)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var old, updated *pb.Laptop
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		old, err = getLaptop(tx.Bucket(laptopBucket), laptop.GetId())
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return ErrNotFound
+		}
+		updated, err = updateLaptop(old, laptop, mask)
+		if err != nil {
+			return err
+		}
+		err = removeIndexes(tx, old)
+		if err != nil {
+			return err
+		}
+		return addIndexes(tx, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	store.feed.PublishUpdate(old, updated)
+	return deepCopy(updated)
+}
+
+func (store *BoltLaptopStore) Delete(id string, soft bool) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var deleted *pb.Laptop
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		laptop, err := getLaptop(tx.Bucket(laptopBucket), id)
+		if err != nil {
+			return err
+		}
+		if laptop == nil {
+			//硬删除可以清除已经软删除的laptop
+			if soft || tx.Bucket(deletedLaptopBucket).Get([]byte(id)) == nil {
+				return ErrNotFound
+			}
+			return tx.Bucket(deletedLaptopBucket).Delete([]byte(id))
+		}
+
+		deleted = laptop
+		err = removeIndexes(tx, laptop)
+		if err != nil {
+			return err
+		}
+		if soft {
+			return putLaptop(tx.Bucket(deletedLaptopBucket), laptop)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if deleted != nil {
+		store.feed.Publish(pb.LaptopEvent_DELETED, deleted)
+	}
+	return nil
+}
+
+func (store *BoltLaptopStore) Restore(id string) (*pb.Laptop, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var restored *pb.Laptop
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		laptop, err := getLaptop(tx.Bucket(deletedLaptopBucket), id)
+		if err != nil {
+			return err
+		}
+		if laptop == nil {
+			return ErrNotFound
+		}
+		laptop.UpdateAt = timestamppb.Now()
+		laptop.Revision++
+
+		err = tx.Bucket(deletedLaptopBucket).Delete([]byte(id))
+		if err != nil {
+			return err
+		}
+		restored = laptop
+		return addIndexes(tx, laptop)
+	})
+	if err != nil {
+		return nil, err
+	}
+	store.feed.Publish(pb.LaptopEvent_CREATED, restored)
+	return deepCopy(restored)
+}
+
+// scanBatchSize is the number of laptops read per read transaction when scanning a bucket,
+// so a slow client doesn't keep a transaction open and memory doesn't grow with the database
+const scanBatchSize = 100
+
+// boltRange is a range of keys of the laptops bucket or of an index bucket
+type boltRange struct {
+	bucket []byte
+	// after is the key the scan starts after, nil for the first key (the last one if descending)
+	after      []byte
+	descending bool
+	// last is the prefix of the last key of an ascending scan, nil for the end of the bucket
+	last []byte
+}
+
+// indexRange returns the range of the index bucket of field between low and high included
+func indexRange(field numericField, low float64, high float64) boltRange {
+	return boltRange{
+		bucket: indexBucket(field),
+		//索引键是值加上ID,ID不会为空所以这个键排在值为low的所有键之前
+		after: floatKey(low),
+		last:  floatKey(high),
+	}
+}
+
+// seek positions cursor on the first key of r after key
+func (r boltRange) seek(cursor *bolt.Cursor, key []byte) []byte {
+	if key == nil {
+		if r.descending {
+			k, _ := cursor.Last()
+			return k
+		}
+		k, _ := cursor.First()
+		return k
+	}
+
+	k, _ := cursor.Seek(key)
+	if r.descending {
+		//Seek停在第一个>=key的键,前一个就是<key的最后一个
+		if k == nil {
+			k, _ = cursor.Last()
+		} else {
+			k, _ = cursor.Prev()
+		}
+		return k
+	}
+	if k != nil && bytes.Equal(k, key) {
+		k, _ = cursor.Next()
+	}
+	return k
+}
+
+// readBatch reads the laptops of at most scanBatchSize keys of r after key in one transaction,
+// it returns the last key read, which is nil at the end of r
+func (store *BoltLaptopStore) readBatch(r boltRange, key []byte) (laptops []*pb.Laptop, last []byte, err error) {
+	err = store.db.View(func(tx *bolt.Tx) error {
+		laptopsBucket := tx.Bucket(laptopBucket)
+		cursor := tx.Bucket(r.bucket).Cursor()
+		k := r.seek(cursor, key)
+		for n := 0; k != nil && n < scanBatchSize; n++ {
+			if r.last != nil && bytes.Compare(k[:len(r.last)], r.last) > 0 {
+				return nil
+			}
+
+			id := k
+			if !bytes.Equal(r.bucket, laptopBucket) {
+				id = k[8:]
+			}
+			laptop, err := getLaptop(laptopsBucket, string(id))
+			if err != nil {
+				return err
+			}
+			if laptop != nil {
+				laptops = append(laptops, laptop)
+			}
+			last = append([]byte(nil), k...)
+
+			if r.descending {
+				k, _ = cursor.Prev()
+			} else {
+				k, _ = cursor.Next()
+			}
+		}
+		if k == nil {
+			last = nil
+		}
+		return nil
+	})
+	return laptops, last, err
+}
+
+// scan calls visit for the laptops of r in key order until it returns false.
+// each batch is read in its own transaction, so visit runs outside of any transaction
+// and may see the changes made during the scan like a paginated read
+func (store *BoltLaptopStore) scan(ctx context.Context, r boltRange, visit func(laptop *pb.Laptop) (bool, error)) error {
+	key := r.after
+	for {
+		laptops, last, err := store.readBatch(r, key)
+		if err != nil {
+			return err
+		}
+		for _, laptop := range laptops {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			more, err := visit(laptop)
+			if err != nil || !more {
+				return err
+			}
+		}
+		if last == nil {
+			return nil
+		}
+		key = last
+	}
+}
+
+// List seeks to the page token in the laptops bucket for the ID order and in the price index for the price order,
+// so it reads at most limit laptops. the other orders scan every laptop and keep the first limit ones
+func (store *BoltLaptopStore) List(
+	ctx context.Context,
+	order LaptopOrder,
+	after *LaptopCursor,
+	limit int,
+) ([]*pb.Laptop, error) {
+	r := boltRange{bucket: laptopBucket, descending: order.Descending}
+	seekable := true
+	switch order.Field {
+	case pb.SortField_ID:
+		if after != nil {
+			r.after = []byte(after.ID)
+		}
+	case pb.SortField_PRICE:
+		//numericFields[0]是价格
+		r.bucket = indexBucket(numericFields[0])
+		if after != nil {
+			r.after = append(floatKey(after.Value), after.ID...)
+		}
+	default:
+		seekable = false
+	}
+
+	selector := newLaptopSelector(order, limit)
+	laptops := []*pb.Laptop{}
+	err := store.scan(ctx, r, func(laptop *pb.Laptop) (bool, error) {
+		if seekable {
+			laptops = append(laptops, laptop)
+			return limit <= 0 || len(laptops) < limit, nil
+		}
+		if after == nil || order.Less(after, order.Cursor(laptop)) {
+			selector.Add(laptop)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if seekable {
+		return laptops, nil
+	}
+	return selector.Laptops(), nil
+}
+
+// filterRange returns the smallest range of the index buckets matching filter, or the laptops bucket
+// if filter has no indexed condition. the ranges are compared by counting their keys without decoding the laptops
+func (store *BoltLaptopStore) filterRange(filter *pb.Filter) (boltRange, error) {
+	r := boltRange{bucket: laptopBucket}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		smallest := -1
+		for _, field := range numericFields {
+			low, high, indexed := field.bounds(filter)
+			if !indexed {
+				continue
+			}
+
+			other := indexRange(field, low, high)
+			count := 0
+			cursor := tx.Bucket(other.bucket).Cursor()
+			for k := other.seek(cursor, other.after); k != nil && bytes.Compare(k[:8], other.last) <= 0; k, _ = cursor.Next() {
+				count++
+				if smallest >= 0 && count >= smallest {
+					break
+				}
+			}
+			if smallest < 0 || count < smallest {
+				r = other
+				smallest = count
+			}
+		}
+		return nil
+	})
+	return r, err
+}
+
+// Search scans the smallest index range of the filter, a text search is matched on the laptops of that range too.
+// unsorted results are sent while scanning, sorted results keep at most query.Limit laptops
+// except without a limit, where every match must be sorted
+func (store *BoltLaptopStore) Search(
+	ctx context.Context,
+	query *SearchQuery,
+	found func(laptop *pb.Laptop, score float64) error,
+) error {
+	r, err := store.filterRange(query.Filter)
+	if err != nil {
+		return err
+	}
+
+	if !query.sorted() {
+		return store.scan(ctx, r, func(laptop *pb.Laptop) (bool, error) {
+			if !query.match(laptop) {
+				return true, nil
+			}
+			return true, found(laptop, 0)
+		})
+	}
+
+	results := newSearchResults(query)
+	err = store.scan(ctx, r, func(laptop *pb.Laptop) (bool, error) {
+		results.Add(laptop)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	return results.Send(ctx, found)
+}
+
+func (store *BoltLaptopStore) Aggregate(
+	ctx context.Context,
+	filter *pb.Filter,
+	histograms []*pb.HistogramSpec,
+) (*pb.AggregateLaptopsResponse, error) {
+	r, err := store.filterRange(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregator := newLaptopAggregator(histograms)
+	err = store.scan(ctx, r, func(laptop *pb.Laptop) (bool, error) {
+		if isQualified(filter, laptop) {
+			aggregator.Add(laptop)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return aggregator.Result()
+}
+
+func (store *BoltLaptopStore) Watch(
+	ctx context.Context,
+	resumeToken string,
+	found func(event *pb.LaptopEvent) error,
+) error {
+	return store.feed.Watch(ctx, resumeToken, found)
+}
@@ -0,0 +1,100 @@
+package service_test
+
+import (
+	"context"
+	"path/filepath"
+	"proto_demo/pb"
+	"proto_demo/sample"
+	"proto_demo/service"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestBoltLaptopStoreReopen(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "laptops.db")
+	store, err := service.NewBoltLaptopStore(path)
+	require.NoError(t, err)
+
+	laptop := sample.NewLaptop()
+	err = store.Save(laptop)
+	require.NoError(t, err)
+	laptop.PriceUsd = 1234
+	updated, err := store.Update(laptop, &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), updated.GetRevision())
+
+	deleted := sample.NewLaptop()
+	err = store.Save(deleted)
+	require.NoError(t, err)
+	err = store.Delete(deleted.GetId(), true)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = service.NewBoltLaptopStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	other, err := store.Find(laptop.GetId())
+	require.NoError(t, err)
+	requireSameLaptop(t, updated, other)
+	other, err = store.Find(deleted.GetId())
+	require.NoError(t, err)
+	require.Nil(t, other)
+
+	restored, err := store.Restore(deleted.GetId())
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), restored.GetRevision())
+
+	laptops, err := store.List(context.Background(), service.LaptopOrder{Field: pb.SortField_PRICE}, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, laptops, 2)
+
+	err = store.Save(deleted)
+	require.ErrorIs(t, err, service.ErrAlreadyExists)
+}
+
+func TestBoltLaptopStoreSearchBatches(t *testing.T) {
+	t.Parallel()
+
+	store, err := service.NewBoltLaptopStore(filepath.Join(t.TempDir(), "laptops.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	laptops := make([]*pb.Laptop, 250)
+	saved := map[string]bool{}
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+		laptops[i].PriceUsd = float64(i)
+		saved[laptops[i].GetId()] = true
+	}
+	require.NoError(t, store.SaveAll(laptops))
+
+	testCases := []struct {
+		name     string
+		filter   *pb.Filter
+		expected int
+	}{
+		{"all", nil, 250},
+		{"indexed", &pb.Filter{MinPriceUsd: 20, MaxPriceUsd: proto.Float64(229)}, 210},
+	}
+	for _, tc := range testCases {
+		found := map[string]bool{}
+		count := 0
+		err := store.Search(context.Background(), &service.SearchQuery{Filter: tc.filter}, func(laptop *pb.Laptop, score float64) error {
+			require.False(t, found[laptop.GetId()], "%s: laptop sent twice", tc.name)
+			found[laptop.GetId()] = true
+			if saved[laptop.GetId()] {
+				count++
+			}
+			// the store can be changed while the results are sent, the scan may see the new laptops
+			return store.Save(sample.NewLaptop())
+		})
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, count, tc.name)
+	}
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"proto_demo/pb"
+	"strconv"
+	"syscall"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrorDomain is the domain of the ErrorInfo details returned by the services
+const ErrorDomain = "pcbook.techschool.guru"
+
+const laptopResourceType = "techschool.pcbook.Laptop"
+const imageResourceType = "techschool.pcbook.Image"
+const uploadResourceType = "techschool.pcbook.Upload"
+
+// storeRetryDelay is the delay sent to the clients when a store fails
+const storeRetryDelay = time.Second
+
+// newStatus returns a status with an ErrorInfo detail followed by details.
+// metadata are key/value pairs of the ErrorInfo
+func newStatus(
+	code codes.Code,
+	reason pb.ErrorReason,
+	message string,
+	metadata map[string]string,
+	details ...protoiface.MessageV1,
+) *status.Status {
+	info := &errdetails.ErrorInfo{
+		Reason:   reason.String(),
+		Domain:   ErrorDomain,
+		Metadata: metadata,
+	}
+	st := status.New(code, message)
+	detailed, err := st.WithDetails(append([]protoiface.MessageV1{info}, details...)...)
+	if err != nil {
+		return st
+	}
+	return detailed
+}
+
+func statusError(code codes.Code, reason pb.ErrorReason, message string, details ...protoiface.MessageV1) error {
+	return newStatus(code, reason, message, nil, details...).Err()
+}
+
+// invalidArgumentError is an InvalidArgument error with a BadRequest violation of field
+func invalidArgumentError(field string, format string, args ...any) error {
+	message := fmt.Sprintf(format, args...)
+	return statusError(codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT, message, &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: message}},
+	})
+}
+
+func laptopNotFoundError(laptopID string) error {
+	message := fmt.Sprintf("laptop %s is not found", laptopID)
+	return newStatus(
+		codes.NotFound,
+		pb.ErrorReason_LAPTOP_NOT_FOUND,
+		message,
+		map[string]string{"laptop_id": laptopID},
+		&errdetails.ResourceInfo{
+			ResourceType: laptopResourceType,
+			ResourceName: laptopID,
+			Description:  message,
+		},
+	).Err()
+}
+
+func imageNotFoundError(imageID string) error {
+	message := fmt.Sprintf("image %s is not found", imageID)
+	return newStatus(
+		codes.NotFound,
+		pb.ErrorReason_IMAGE_NOT_FOUND,
+		message,
+		map[string]string{"image_id": imageID},
+		&errdetails.ResourceInfo{
+			ResourceType: imageResourceType,
+			ResourceName: imageID,
+			Description:  message,
+		},
+	).Err()
+}
+
+func uploadNotFoundError(uploadID string) error {
+	message := fmt.Sprintf("upload %s is not found", uploadID)
+	return newStatus(
+		codes.NotFound,
+		pb.ErrorReason_UPLOAD_NOT_FOUND,
+		message,
+		map[string]string{"upload_id": uploadID},
+		&errdetails.ResourceInfo{
+			ResourceType: uploadResourceType,
+			ResourceName: uploadID,
+			Description:  message,
+		},
+	).Err()
+}
+
+// uploadOffsetError is a FailedPrecondition error for a chunk which doesn't start at the committed size,
+// the client should query the upload and resume from there
+func uploadOffsetError(uploadID string, offset int64, committedSize int64) error {
+	message := fmt.Sprintf("chunk offset %d is not the committed size %d", offset, committedSize)
+	return newStatus(
+		codes.FailedPrecondition,
+		pb.ErrorReason_UPLOAD_OFFSET_MISMATCH,
+		message,
+		map[string]string{"upload_id": uploadID, "committed_size": strconv.FormatInt(committedSize, 10)},
+		&errdetails.PreconditionFailure{
+			Violations: []*errdetails.PreconditionFailure_Violation{{
+				Type:        "OFFSET",
+				Subject:     uploadID,
+				Description: message,
+			}},
+		},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(0)},
+	).Err()
+}
+
+// uploadFinishedError is a FailedPrecondition error for a chunk sent after the upload is finished
+func uploadFinishedError(uploadID string) error {
+	return newStatus(
+		codes.FailedPrecondition,
+		pb.ErrorReason_UPLOAD_FINISHED,
+		fmt.Sprintf("upload %s is finished", uploadID),
+		map[string]string{"upload_id": uploadID},
+	).Err()
+}
+
+func uploadChecksumError(uploadID string) error {
+	return newStatus(
+		codes.InvalidArgument,
+		pb.ErrorReason_UPLOAD_CHECKSUM_MISMATCH,
+		"checksum doesn't match the uploaded data",
+		map[string]string{"upload_id": uploadID},
+		&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       "checksum",
+				Description: "doesn't match the SHA-256 of the uploaded data",
+			}},
+		},
+	).Err()
+}
+
+// imageTooLargeError is a ResourceExhausted error with the image size quota of the laptop
+func imageTooLargeError(laptopID string, imageSize int64, maxImageSize int64) error {
+	message := fmt.Sprintf("image is too large: %d > %d", imageSize, maxImageSize)
+	return newStatus(
+		codes.ResourceExhausted,
+		pb.ErrorReason_IMAGE_TOO_LARGE,
+		message,
+		map[string]string{"laptop_id": laptopID, "max_image_size": strconv.FormatInt(maxImageSize, 10)},
+		&errdetails.QuotaFailure{
+			Violations: []*errdetails.QuotaFailure_Violation{{
+				Subject:     "laptop:" + laptopID,
+				Description: message,
+			}},
+		},
+	).Err()
+}
+
+// idempotencyKeyReusedError is a FailedPrecondition error for an idempotency key sent with another request
+func idempotencyKeyReusedError(key string) error {
+	return statusError(
+		codes.FailedPrecondition,
+		pb.ErrorReason_IDEMPOTENCY_KEY_REUSED,
+		ErrIdempotencyKeyReused.Error(),
+		&errdetails.PreconditionFailure{
+			Violations: []*errdetails.PreconditionFailure_Violation{{
+				Type:        "IDEMPOTENCY_KEY",
+				Subject:     key,
+				Description: "the key was used with a different request",
+			}},
+		},
+	)
+}
+
+// storeError converts a failure of a store, it's an Unavailable error telling the client to retry later
+// if the failure is transient, an Internal error otherwise. it's logged
+func storeError(message string, err error) error {
+	if !transientError(err) {
+		return internalError(message, err)
+	}
+	return logError(statusError(
+		codes.Unavailable,
+		pb.ErrorReason_STORE_UNAVAILABLE,
+		fmt.Sprintf("%s: %v", message, err),
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(storeRetryDelay)},
+	))
+}
+
+// transientError reports whether a store may succeed if the operation is retried later:
+// the store is busy or closed, the disk is full or an operation timed out
+func transientError(err error) bool {
+	var timeout interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, os.ErrClosed), errors.Is(err, syscall.ENOSPC):
+		return true
+	case errors.Is(err, bolt.ErrDatabaseNotOpen), errors.Is(err, bolt.ErrTimeout):
+		return true
+	case errors.As(err, &timeout):
+		return timeout.Timeout()
+	}
+	return transientSQLError(err)
+}
+
+// internalError is for the failures that retrying won't fix, it's logged
+func internalError(message string, err error) error {
+	return logError(statusError(codes.Internal, pb.ErrorReason_INTERNAL_ERROR, fmt.Sprintf("%s: %v", message, err)))
+}
+
+// streamError is for the failures to receive from or send to a stream, it's logged
+func streamError(message string, err error) error {
+	return logError(statusError(codes.Unknown, pb.ErrorReason_STREAM_FAILURE, fmt.Sprintf("%s: %v", message, err)))
+}
+
+// laptopStoreError converts an error of the laptop store about laptopID
+func laptopStoreError(laptopID string, message string, err error) error {
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return validationErr.GRPCStatus().Err()
+	case errors.Is(err, ErrNotFound):
+		return laptopNotFoundError(laptopID)
+	case errors.Is(err, ErrAlreadyExists):
+		return newStatus(
+			codes.AlreadyExists,
+			pb.ErrorReason_LAPTOP_ALREADY_EXISTS,
+			fmt.Sprintf("%s: %v", message, err),
+			map[string]string{"laptop_id": laptopID},
+			&errdetails.ResourceInfo{ResourceType: laptopResourceType, ResourceName: laptopID},
+		).Err()
+	case errors.Is(err, ErrStaleRevision):
+		//重新读取laptop之后可以马上重试
+		return newStatus(
+			codes.Aborted,
+			pb.ErrorReason_STALE_REVISION,
+			fmt.Sprintf("%s: %v", message, err),
+			map[string]string{"laptop_id": laptopID},
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(0)},
+		).Err()
+	default:
+		return storeError(message, err)
+	}
+}
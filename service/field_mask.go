@@ -0,0 +1,40 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// applyFieldMask copies the fields named by paths from src into dst.
+// a field that is not set in src is cleared in dst.
+func applyFieldMask(dst proto.Message, src proto.Message, paths []string) error {
+	for _, path := range paths {
+		err := applyFieldPath(dst.ProtoReflect(), src.ProtoReflect(), strings.Split(path, "."))
+		if err != nil {
+			return fmt.Errorf("cannot apply field path %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func applyFieldPath(dst protoreflect.Message, src protoreflect.Message, names []string) error {
+	field := dst.Descriptor().Fields().ByName(protoreflect.Name(names[0]))
+	if field == nil {
+		return fmt.Errorf("unknown field %s", names[0])
+	}
+	if len(names) == 1 {
+		if src.Has(field) {
+			dst.Set(field, src.Get(field))
+		} else {
+			dst.Clear(field)
+		}
+		return nil
+	}
+	if field.Kind() != protoreflect.MessageKind || field.IsList() || field.IsMap() {
+		return fmt.Errorf("field %s is not a message", names[0])
+	}
+	return applyFieldPath(dst.Mutable(field).Message(), src.Get(field).Message(), names[1:])
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"proto_demo/pb"
+	"proto_demo/serializer"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+const (
+	laptopSnapshotFile = "laptops.snapshot"
+	laptopLogFile      = "laptops.wal"
+	// compactionThreshold is the number of log records that triggers a new snapshot
+	compactionThreshold = 1000
+	// a log record is its length and CRC-32 followed by a protobuf encoded pb.LaptopRecord
+	recordHeaderSize = 8
+)
+
+var ErrCorruptedLog = errors.New("corrupted write-ahead log")
+
+// FileLaptopStore is an InMemoryLaptopStore persisted in a folder.
+// every change is appended to a write-ahead log, which is compacted into a snapshot from time to time
+type FileLaptopStore struct {
+	*InMemoryLaptopStore
+	// mutex serializes the changes so that the log has the same order as the store
+	mutex   sync.Mutex
+	folder  string
+	wal     *os.File
+	size    int64
+	records int
+}
+
+// NewFileLaptopStore loads the laptops saved in folder, a torn record at the end of the log is discarded
+func NewFileLaptopStore(folder string) (*FileLaptopStore, error) {
+	err := os.MkdirAll(folder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create laptop store folder: %w", err)
+	}
+
+	store := &FileLaptopStore{
+		InMemoryLaptopStore: NewInMemoryLaptopStore(),
+		folder:              folder,
+	}
+	err = store.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	err = store.replayLog()
+	if err != nil {
+		return nil, err
+	}
+
+	store.wal, err = os.OpenFile(store.path(laptopLogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open write-ahead log: %w", err)
+	}
+	store.writeAhead = store.append
+	return store, nil
+}
+
+func (store *FileLaptopStore) path(name string) string {
+	return filepath.Join(store.folder, name)
+}
+
+func (store *FileLaptopStore) loadSnapshot() error {
+	snapshot := &pb.LaptopSnapshot{}
+	err := serializer.ReadProtobufToBinaryFile(store.path(laptopSnapshotFile), snapshot)
+	if err != nil {
+		if _, statErr := os.Stat(store.path(laptopSnapshotFile)); os.IsNotExist(statErr) {
+			return nil
+		}
+		return fmt.Errorf("cannot read snapshot: %w", err)
+	}
+
+	for _, laptop := range snapshot.GetLaptops() {
+		store.put(laptop)
+	}
+	for _, laptop := range snapshot.GetDeleted() {
+		store.put(laptop)
+		store.remove(laptop.GetId(), true)
+	}
+	return nil
+}
+
+// replayLog applies the records of the log, it's truncated after the last complete record
+func (store *FileLaptopStore) replayLog() error {
+	data, err := os.ReadFile(store.path(laptopLogFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read write-ahead log: %w", err)
+	}
+
+	offset := 0
+	for offset < len(data) {
+		record, n, err := decodeRecord(data[offset:])
+		if err == errTornRecord {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		err = store.apply(record)
+		if err != nil {
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		offset += n
+		store.records++
+	}
+
+	if offset < len(data) {
+		err = os.Truncate(store.path(laptopLogFile), int64(offset))
+		if err != nil {
+			return fmt.Errorf("cannot truncate write-ahead log: %w", err)
+		}
+	}
+	store.size = int64(offset)
+	return nil
+}
+
+var errTornRecord = errors.New("torn record")
+
+// decodeRecord returns the first record of data and its encoded size.
+// an incomplete or invalid record which ends the data is torn, it wasn't fully written
+func decodeRecord(data []byte) (*pb.LaptopRecord, int, error) {
+	if len(data) < recordHeaderSize {
+		return nil, 0, errTornRecord
+	}
+	length := int(binary.BigEndian.Uint32(data))
+	checksum := binary.BigEndian.Uint32(data[4:])
+	n := recordHeaderSize + length
+	if len(data) < n {
+		return nil, 0, errTornRecord
+	}
+
+	payload := data[recordHeaderSize:n]
+	record := &pb.LaptopRecord{}
+	if crc32.ChecksumIEEE(payload) != checksum || proto.Unmarshal(payload, record) != nil {
+		if len(data) == n {
+			return nil, 0, errTornRecord
+		}
+		return nil, 0, ErrCorruptedLog
+	}
+	return record, n, nil
+}
+
+func encodeRecord(record *pb.LaptopRecord) ([]byte, error) {
+	payload, err := proto.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(data, uint32(len(payload)))
+	binary.BigEndian.PutUint32(data[4:], crc32.ChecksumIEEE(payload))
+	copy(data[recordHeaderSize:], payload)
+	return data, nil
+}
+
+func (store *FileLaptopStore) apply(record *pb.LaptopRecord) error {
+	switch record.GetOp() {
+	case pb.LaptopRecord_PUT:
+		store.put(record.GetLaptop())
+	case pb.LaptopRecord_DELETE:
+		store.remove(record.GetId(), false)
+	case pb.LaptopRecord_SOFT_DELETE:
+		store.remove(record.GetId(), true)
+	default:
+		return fmt.Errorf("%w: unknown operation %v", ErrCorruptedLog, record.GetOp())
+	}
+	return nil
+}
+
+// append writes records to the log and waits until they're on disk,
+// it's the writeAhead of the in-memory store so a change that can't be logged isn't applied.
+// store.mutex must be held, the log is compacted by change once the records are applied
+func (store *FileLaptopStore) append(records ...*pb.LaptopRecord) error {
+	data := []byte{}
+	for _, record := range records {
+		encoded, err := encodeRecord(record)
+		if err != nil {
+			return fmt.Errorf("cannot encode record: %w", err)
+		}
+		data = append(data, encoded...)
+	}
+
+	_, err := store.wal.Write(data)
+	if err == nil {
+		err = store.wal.Sync()
+	}
+	if err != nil {
+		//删掉写了一半的记录
+		store.wal.Truncate(store.size)
+		return fmt.Errorf("cannot write to write-ahead log: %w", err)
+	}
+	store.size += int64(len(data))
+	store.records += len(records)
+	return nil
+}
+
+// Compact writes a snapshot of the store and empties the log
+func (store *FileLaptopStore) Compact() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.compact()
+}
+
+func (store *FileLaptopStore) compact() error {
+	err := replaceProtobufFile(store.snapshot(), store.path(laptopSnapshotFile))
+	if err != nil {
+		return fmt.Errorf("cannot write snapshot: %w", err)
+	}
+
+	//快照之后的日志重放是幂等的,截断失败也不会丢数据
+	err = store.wal.Truncate(0)
+	if err != nil {
+		return fmt.Errorf("cannot truncate write-ahead log: %w", err)
+	}
+	store.size = 0
+	store.records = 0
+	return nil
+}
+
+// replaceProtobufFile writes message to a temporary file which is renamed to path,
+// so that path has either the old or the new content after a crash
+func replaceProtobufFile(message protoiface.MessageV1, path string) error {
+	temp := path + ".tmp"
+	err := serializer.WriteProtobufToBinaryFile(message, temp)
+	if err != nil {
+		return err
+	}
+	err = syncFile(temp)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+func syncFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// Close closes the write-ahead log, the store can't be changed anymore
+func (store *FileLaptopStore) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.wal.Close()
+}
+
+// change runs a change of the in-memory store, which appends its records to the log before applying it,
+// then compacts the log once it's long enough
+func (store *FileLaptopStore) change(apply func() error) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err := apply()
+	if err != nil {
+		return err
+	}
+	if store.records >= compactionThreshold {
+		//记录已经写入日志,压缩失败下次再试
+		err = store.compact()
+		if err != nil {
+			log.Printf("cannot compact laptop store: %v", err)
+		}
+	}
+	return nil
+}
+
+func (store *FileLaptopStore) Save(laptop *pb.Laptop) error {
+	return store.change(func() error {
+		return store.InMemoryLaptopStore.Save(laptop)
+	})
+}
+
+func (store *FileLaptopStore) SaveAll(laptops []*pb.Laptop) error {
+	return store.change(func() error {
+		return store.InMemoryLaptopStore.SaveAll(laptops)
+	})
+}
+
+func (store *FileLaptopStore) Update(laptop *pb.Laptop, mask *fieldmaskpb.FieldMask) (*pb.Laptop, error) {
+	var updated *pb.Laptop
+	err := store.change(func() (err error) {
+		updated, err = store.InMemoryLaptopStore.Update(laptop, mask)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (store *FileLaptopStore) Delete(id string, soft bool) error {
+	return store.change(func() error {
+		return store.InMemoryLaptopStore.Delete(id, soft)
+	})
+}
+
+func (store *FileLaptopStore) Restore(id string) (*pb.Laptop, error) {
+	var restored *pb.Laptop
+	err := store.change(func() (err error) {
+		restored, err = store.InMemoryLaptopStore.Restore(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
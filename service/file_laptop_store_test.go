@@ -0,0 +1,141 @@
+package service_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"proto_demo/pb"
+	"proto_demo/sample"
+	"proto_demo/service"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestFileLaptopStoreRecover(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	store, err := service.NewFileLaptopStore(folder)
+	require.NoError(t, err)
+
+	saved := sample.NewLaptop()
+	err = store.Save(saved)
+	require.NoError(t, err)
+
+	updated := sample.NewLaptop()
+	err = store.Save(updated)
+	require.NoError(t, err)
+	updated.PriceUsd = 1234
+	updated, err = store.Update(updated, &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}})
+	require.NoError(t, err)
+
+	softDeleted := sample.NewLaptop()
+	err = store.Save(softDeleted)
+	require.NoError(t, err)
+	err = store.Delete(softDeleted.GetId(), true)
+	require.NoError(t, err)
+
+	hardDeleted := sample.NewLaptop()
+	err = store.Save(hardDeleted)
+	require.NoError(t, err)
+	err = store.Delete(hardDeleted.GetId(), false)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// a record interrupted by a crash is ignored
+	wal, err := os.OpenFile(filepath.Join(folder, "laptops.wal"), os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = wal.Write([]byte{0, 0, 1, 0, 42, 42})
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+
+	store, err = service.NewFileLaptopStore(folder)
+	require.NoError(t, err)
+	requireFileStoreContent(t, store, saved, updated, softDeleted, hardDeleted)
+
+	// the store can be changed after the torn record is discarded
+	err = store.Compact()
+	require.NoError(t, err)
+	restored, err := store.Restore(softDeleted.GetId())
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), restored.GetRevision())
+	require.NoError(t, store.Close())
+
+	store, err = service.NewFileLaptopStore(folder)
+	require.NoError(t, err)
+	defer store.Close()
+	other, err := store.Find(softDeleted.GetId())
+	require.NoError(t, err)
+	requireSameLaptop(t, restored, other)
+}
+
+func TestFileLaptopStoreLogFailure(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	store, err := service.NewFileLaptopStore(folder)
+	require.NoError(t, err)
+	saved := sample.NewLaptop()
+	require.NoError(t, store.Save(saved))
+
+	// a change that can't be written to the log isn't applied
+	require.NoError(t, store.Close())
+	other := sample.NewLaptop()
+	require.Error(t, store.Save(other))
+	require.Error(t, store.SaveAll([]*pb.Laptop{other}))
+	_, err = store.Update(&pb.Laptop{Id: saved.GetId(), PriceUsd: 1}, &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}})
+	require.Error(t, err)
+	require.Error(t, store.Delete(saved.GetId(), true))
+
+	found, err := store.Find(other.GetId())
+	require.NoError(t, err)
+	require.Nil(t, found)
+	found, err = store.Find(saved.GetId())
+	require.NoError(t, err)
+	saved.Revision = 1
+	requireSameLaptop(t, saved, found)
+
+	store, err = service.NewFileLaptopStore(folder)
+	require.NoError(t, err)
+	defer store.Close()
+	found, err = store.Find(saved.GetId())
+	require.NoError(t, err)
+	requireSameLaptop(t, saved, found)
+	require.NoError(t, store.Save(other))
+}
+
+func requireFileStoreContent(t *testing.T, store *service.FileLaptopStore, saved, updated, softDeleted, hardDeleted *pb.Laptop) {
+	other, err := store.Find(saved.GetId())
+	require.NoError(t, err)
+	saved.Revision = 1
+	requireSameLaptop(t, saved, other)
+
+	other, err = store.Find(updated.GetId())
+	require.NoError(t, err)
+	requireSameLaptop(t, updated, other)
+
+	other, err = store.Find(softDeleted.GetId())
+	require.NoError(t, err)
+	require.Nil(t, other)
+	other, err = store.Find(hardDeleted.GetId())
+	require.NoError(t, err)
+	require.Nil(t, other)
+
+	// the indexes are rebuilt
+	found := []string{}
+	query := &service.SearchQuery{Filter: &pb.Filter{MinPriceUsd: 1234, MaxPriceUsd: proto.Float64(1234)}}
+	err = store.Search(context.Background(), query, func(laptop *pb.Laptop, score float64) error {
+		found = append(found, laptop.GetId())
+		return nil
+	})
+	require.NoError(t, err)
+	require.Contains(t, found, updated.GetId())
+
+	err = store.Save(hardDeleted)
+	require.NoError(t, err, "a hard deleted laptop can be saved again")
+	err = store.Save(softDeleted)
+	require.ErrorIs(t, err, service.ErrAlreadyExists)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// IdempotencyKeyHeader is the request metadata holding the idempotency key of a request
+const IdempotencyKeyHeader = "idempotency-key"
+
+const maxIdempotencyKeySize = 255
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request
+var ErrIdempotencyKeyReused = errors.New("idempotency key is reused with a different request")
+
+// IdempotencyStore remembers the responses of the requests with an idempotency key for a window of time
+type IdempotencyStore struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	entries map[string]*idempotencyEntry
+	// expiries are in the order of the expiration times
+	expiries []idempotencyExpiry
+}
+
+type idempotencyEntry struct {
+	digest []byte
+	// done is closed when the first request is finished
+	done     chan struct{}
+	response proto.Message
+	expireAt time.Time
+}
+
+type idempotencyExpiry struct {
+	key string
+	at  time.Time
+}
+
+func NewIdempotencyStore(window time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		window:  window,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// Do runs create for the first request with key, the next requests with key get a copy of its response.
+// digest identifies the payload of the request, Do fails with ErrIdempotencyKeyReused if it isn't the same.
+// the response is only kept if create succeeds, so a failed request can be retried with the same key
+func (store *IdempotencyStore) Do(
+	ctx context.Context,
+	key string,
+	digest []byte,
+	create func() (proto.Message, error),
+) (proto.Message, error) {
+	for {
+		store.mutex.Lock()
+		store.expire(time.Now())
+		entry := store.entries[key]
+		if entry == nil {
+			entry = &idempotencyEntry{digest: digest, done: make(chan struct{})}
+			store.entries[key] = entry
+			store.mutex.Unlock()
+			return store.run(key, entry, create)
+		}
+		store.mutex.Unlock()
+
+		if !bytes.Equal(entry.digest, digest) {
+			return nil, ErrIdempotencyKeyReused
+		}
+		//第一个请求还没结束就等它
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if entry.response != nil {
+			return proto.Clone(entry.response), nil
+		}
+	}
+}
+
+func (store *IdempotencyStore) run(key string, entry *idempotencyEntry, create func() (proto.Message, error)) (proto.Message, error) {
+	response, err := create()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	defer close(entry.done)
+
+	if err != nil {
+		delete(store.entries, key)
+		return nil, err
+	}
+	entry.response = proto.Clone(response)
+	entry.expireAt = time.Now().Add(store.window)
+	store.expiries = append(store.expiries, idempotencyExpiry{key: key, at: entry.expireAt})
+	return response, nil
+}
+
+// expire removes the responses that are older than the window
+func (store *IdempotencyStore) expire(now time.Time) {
+	for len(store.expiries) > 0 && !store.expiries[0].at.After(now) {
+		expiry := store.expiries[0]
+		store.expiries = store.expiries[1:]
+		//同一个key可能已经过期后又被使用了
+		if entry := store.entries[expiry.key]; entry != nil && entry.expireAt.Equal(expiry.at) {
+			delete(store.entries, expiry.key)
+		}
+	}
+}
+
+// idempotencyKey returns the idempotency key of the request metadata, it's empty if there isn't one
+func idempotencyKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(IdempotencyKeyHeader)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// messageDigest returns the hash of message, to compare the payloads of the requests
+func messageDigest(message proto.Message) ([]byte, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+	return digest[:], nil
+}
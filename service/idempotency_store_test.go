@@ -0,0 +1,104 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"proto_demo/pb"
+	"proto_demo/service"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewIdempotencyStore(100 * time.Millisecond)
+	ctx := context.Background()
+	calls := 0
+	create := func() (proto.Message, error) {
+		calls++
+		return &pb.CreateLaptopResponse{Id: "laptop"}, nil
+	}
+
+	res, err := store.Do(ctx, "key", []byte("payload"), create)
+	require.NoError(t, err)
+	require.Equal(t, "laptop", res.(*pb.CreateLaptopResponse).GetId())
+
+	res.(*pb.CreateLaptopResponse).Id = "changed"
+	res, err = store.Do(ctx, "key", []byte("payload"), create)
+	require.NoError(t, err)
+	require.Equal(t, "laptop", res.(*pb.CreateLaptopResponse).GetId())
+	require.Equal(t, 1, calls)
+
+	_, err = store.Do(ctx, "key", []byte("other payload"), create)
+	require.ErrorIs(t, err, service.ErrIdempotencyKeyReused)
+
+	_, err = store.Do(ctx, "other key", []byte("other payload"), create)
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = store.Do(ctx, "key", []byte("other payload"), create)
+	require.NoError(t, err, "the key can be reused after the window")
+	require.Equal(t, 3, calls)
+}
+
+func TestIdempotencyStoreFailure(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewIdempotencyStore(time.Minute)
+	ctx := context.Background()
+	failure := errors.New("failure")
+
+	_, err := store.Do(ctx, "key", []byte("payload"), func() (proto.Message, error) {
+		return nil, failure
+	})
+	require.ErrorIs(t, err, failure)
+
+	res, err := store.Do(ctx, "key", []byte("payload"), func() (proto.Message, error) {
+		return &pb.CreateLaptopResponse{Id: "laptop"}, nil
+	})
+	require.NoError(t, err, "a failed request can be retried")
+	require.Equal(t, "laptop", res.(*pb.CreateLaptopResponse).GetId())
+}
+
+func TestIdempotencyStoreConcurrentRequests(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewIdempotencyStore(time.Minute)
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	calls := 0
+
+	wg := sync.WaitGroup{}
+	ids := make([]string, 5)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := store.Do(context.Background(), "key", []byte("payload"), func() (proto.Message, error) {
+				calls++
+				close(started)
+				<-finish
+				return &pb.CreateLaptopResponse{Id: "laptop"}, nil
+			})
+			require.NoError(t, err)
+			ids[i] = res.(*pb.CreateLaptopResponse).GetId()
+		}(i)
+	}
+
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := store.Do(ctx, "key", []byte("payload"), nil)
+	require.ErrorIs(t, err, context.Canceled, "a replay waits for the first request")
+
+	close(finish)
+	wg.Wait()
+	require.Equal(t, 1, calls)
+	require.Equal(t, []string{"laptop", "laptop", "laptop", "laptop", "laptop"}, ids)
+}
@@ -1,63 +1,507 @@
 package service
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
 	"os"
+	"path/filepath"
+	"proto_demo/pb"
+	"proto_demo/serializer"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// imageManifestFile is the index of the images in the folder of a DiskImageStore
+const imageManifestFile = "images.manifest"
+
+// imageUploadPattern is the name of the temporary files of the images being saved
+const imageUploadPattern = "upload-*.tmp"
+
 type ImageStore interface {
-	Save(laptopID string, imageType string, imagedate bytes.Buffer) (string, error)
+	// Save stores the data of an image of a laptop and returns its ID
+	Save(laptopID string, imageType string, imageData io.Reader) (string, error)
+	// Create starts saving an image of a laptop, the image is stored when the writer is committed
+	Create(laptopID string, imageType string) (ImageWriter, error)
+	// Find returns the info of an image, or nil if it doesn't exist
+	Find(imageID string) (*ImageInfo, error)
+	// Open returns the data of an image, it fails with ErrNotFound if the image doesn't exist
+	Open(imageID string) (io.ReadCloser, error)
+	// FindByLaptop returns the IDs of all images of a laptop, the primary image first and the others in upload order
+	FindByLaptop(laptopID string) ([]string, error)
+	// Delete removes an image, the next image of the laptop becomes primary if it was primary.
+	// it fails with ErrNotFound if the image doesn't exist
+	Delete(imageID string) error
+	// SetPrimary makes an image the primary image of its laptop, it fails with ErrNotFound if the image doesn't exist
+	SetPrimary(imageID string) error
+	// DeleteByLaptop removes all images of a laptop from the store
+	DeleteByLaptop(laptopID string) error
 }
+
+// DiskImageStore saves the images in a folder, their metadata are in a manifest which is rewritten on every change.
+// the rewrite is O(n) in the number of images, a store with many images would need a log like FileLaptopStore
 type DiskImageStore struct {
 	mutex       sync.RWMutex
 	imageFolder string
 	images      map[string]*ImageInfo
+	// laptops are the image IDs of each laptop in FindByLaptop order
+	laptops map[string][]string
+}
+
+// ImageWriter receives the data of an image, it must be committed or aborted
+type ImageWriter interface {
+	io.Writer
+	// Commit flushes the data to disk and stores the image, it returns the ID of the image
+	Commit() (string, error)
+	// Abort removes the data written so far, it does nothing after Commit
+	Abort() error
 }
+
 type ImageInfo struct {
 	LaptopID string
 	Type     string
 	Path     string
+	Size     int64
+	// Checksum is the SHA-256 of the image data
+	Checksum   []byte
+	UploadedAt time.Time
 }
 
-func NewDiskImageStore(imageFolder string) *DiskImageStore {
-	return &DiskImageStore{
+// NewDiskImageStore loads the images saved in imageFolder.
+// the images whose file is missing are dropped, the image files that aren't in the manifest are added to it
+// if laptopExists reports that their laptop exists. laptopExists can be nil to add all of them
+func NewDiskImageStore(imageFolder string, laptopExists func(laptopID string) (bool, error)) (*DiskImageStore, error) {
+	err := os.MkdirAll(imageFolder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create image folder: %w", err)
+	}
+
+	store := &DiskImageStore{
 		imageFolder: imageFolder,
 		images:      make(map[string]*ImageInfo),
+		laptops:     make(map[string][]string),
+	}
+	err = store.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+	err = store.cleanFolder(laptopExists)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// imagePath returns the file of an image, it starts with the laptop ID so that the image can be re-indexed
+// if it's missing from the manifest
+func (store *DiskImageStore) imagePath(laptopID string, imageID string, imageType string) string {
+	return filepath.Join(store.imageFolder, laptopID+"_"+imageID+imageType)
+}
+
+// parseImageFile returns the image of a file name created by imagePath, ok is false for the other files
+func parseImageFile(name string) (laptopID string, imageID string, imageType string, ok bool) {
+	laptopID, rest, found := strings.Cut(name, "_")
+	//图片ID是36个字符的UUID,后面是图片类型
+	if !found || laptopID == "" || len(rest) < 36 {
+		return "", "", "", false
+	}
+	if _, err := uuid.Parse(rest[:36]); err != nil {
+		return "", "", "", false
+	}
+	return laptopID, rest[:36], rest[36:], true
+}
+
+func (store *DiskImageStore) loadManifest() error {
+	manifestPath := filepath.Join(store.imageFolder, imageManifestFile)
+	manifest := &pb.ImageManifest{}
+	err := serializer.ReadProtobufToBinaryFile(manifestPath, manifest)
+	if err != nil {
+		if _, statErr := os.Stat(manifestPath); os.IsNotExist(statErr) {
+			return nil
+		}
+		return fmt.Errorf("cannot read image manifest: %w", err)
+	}
+
+	for _, record := range manifest.GetImages() {
+		imagePath := store.imagePath(record.GetLaptopId(), record.GetId(), record.GetImageType())
+		if _, err := os.Stat(imagePath); err != nil {
+			//删除图片时先删文件再写manifest,中间崩溃会留下这种记录
+			log.Printf("drop image %s: %v", record.GetId(), err)
+			continue
+		}
+		store.images[record.GetId()] = &ImageInfo{
+			LaptopID:   record.GetLaptopId(),
+			Type:       record.GetImageType(),
+			Path:       imagePath,
+			Size:       record.GetSize(),
+			Checksum:   record.GetChecksum(),
+			UploadedAt: record.GetUploadedAt().AsTime(),
+		}
+		store.laptops[record.GetLaptopId()] = append(store.laptops[record.GetLaptopId()], record.GetId())
+	}
+	return nil
+}
+
+// cleanFolder removes the partial images left by a crash and adds the images missing from the manifest if their laptop
+// exists, they're left by a crash during a save. the other files are logged, they're left by a version without manifest
+func (store *DiskImageStore) cleanFolder(laptopExists func(laptopID string) (bool, error)) error {
+	entries, err := os.ReadDir(store.imageFolder)
+	if err != nil {
+		return fmt.Errorf("cannot read image folder: %w", err)
+	}
+	indexed := make(map[string]bool)
+	for _, info := range store.images {
+		indexed[filepath.Base(info.Path)] = true
 	}
+
+	missing := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, imageManifestFile) || indexed[name] {
+			continue
+		}
+		if upload, _ := filepath.Match(imageUploadPattern, name); upload {
+			err := os.Remove(filepath.Join(store.imageFolder, name))
+			if err != nil {
+				return fmt.Errorf("cannot remove partial image: %w", err)
+			}
+			continue
+		}
+		laptopID, imageID, imageType, ok := parseImageFile(name)
+		if !ok || store.images[imageID] != nil {
+			log.Printf("orphaned image file: %s", filepath.Join(store.imageFolder, name))
+			continue
+		}
+		if laptopExists != nil {
+			exists, err := laptopExists(laptopID)
+			if err != nil {
+				return fmt.Errorf("cannot find laptop of image file: %w", err)
+			}
+			if !exists {
+				//笔记本已经删除了,软删除的笔记本恢复之后重启会再加回来
+				log.Printf("image file of a deleted laptop: %s", filepath.Join(store.imageFolder, name))
+				continue
+			}
+		}
+		info, err := readImageInfo(store.imagePath(laptopID, imageID, imageType), laptopID, imageType)
+		if err != nil {
+			return err
+		}
+		log.Printf("re-index image %s of laptop %s", imageID, laptopID)
+		store.images[imageID] = info
+		missing = append(missing, imageID)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	//按上传顺序加在笔记本已有的图片后面
+	sort.SliceStable(missing, func(i, j int) bool {
+		return store.images[missing[i]].UploadedAt.Before(store.images[missing[j]].UploadedAt)
+	})
+	for _, imageID := range missing {
+		laptopID := store.images[imageID].LaptopID
+		store.laptops[laptopID] = append(store.laptops[laptopID], imageID)
+	}
+	return store.writeManifest()
+}
+
+// readImageInfo computes the info of an image file, the upload time is the modification time of the file
+func readImageInfo(imagePath string, laptopID string, imageType string) (*ImageInfo, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open image file : %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image file : %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat image file : %w", err)
+	}
+	return &ImageInfo{
+		LaptopID:   laptopID,
+		Type:       imageType,
+		Path:       imagePath,
+		Size:       size,
+		Checksum:   hash.Sum(nil),
+		UploadedAt: stat.ModTime().UTC(),
+	}, nil
 }
+
+// writeManifest replaces the manifest with the content of the store, the mutex must be locked
+func (store *DiskImageStore) writeManifest() error {
+	laptopIDs := make([]string, 0, len(store.laptops))
+	for laptopID := range store.laptops {
+		laptopIDs = append(laptopIDs, laptopID)
+	}
+	sort.Strings(laptopIDs)
+
+	manifest := &pb.ImageManifest{}
+	for _, laptopID := range laptopIDs {
+		for _, imageID := range store.laptops[laptopID] {
+			info := store.images[imageID]
+			manifest.Images = append(manifest.Images, &pb.ImageRecord{
+				Id:         imageID,
+				LaptopId:   info.LaptopID,
+				ImageType:  info.Type,
+				Size:       info.Size,
+				Checksum:   info.Checksum,
+				UploadedAt: timestamppb.New(info.UploadedAt),
+			})
+		}
+	}
+	err := replaceProtobufFile(manifest, filepath.Join(store.imageFolder, imageManifestFile))
+	if err != nil {
+		return fmt.Errorf("cannot write image manifest: %w", err)
+	}
+	return nil
+}
+
 func (store *DiskImageStore) Save(
 	laptopID string,
 	imageType string,
-	imageData bytes.Buffer,
+	imageData io.Reader,
 ) (string, error) {
+	writer, err := store.Create(laptopID, imageType)
+	if err != nil {
+		return "", err
+	}
+	defer writer.Abort()
+
+	_, err = io.Copy(writer, imageData)
+	if err != nil {
+		return "", err
+	}
+	return writer.Commit()
+}
+
+func (store *DiskImageStore) Create(laptopID string, imageType string) (ImageWriter, error) {
+	file, err := os.CreateTemp(store.imageFolder, imageUploadPattern)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create image file : %w", err)
+	}
+	return &diskImageWriter{
+		store:     store,
+		laptopID:  laptopID,
+		imageType: imageType,
+		file:      file,
+		hash:      sha256.New(),
+	}, nil
+}
+
+// diskImageWriter writes an image to a temporary file which is renamed when it's committed
+type diskImageWriter struct {
+	store     *DiskImageStore
+	laptopID  string
+	imageType string
+	file      *os.File
+	hash      hash.Hash
+	size      int64
+	done      bool
+}
+
+func (writer *diskImageWriter) Write(data []byte) (int, error) {
+	if writer.done {
+		return 0, os.ErrClosed
+	}
+	n, err := writer.file.Write(data)
+	writer.hash.Write(data[:n])
+	writer.size += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("cannot write image file : %w", err)
+	}
+	return n, nil
+}
+
+func (writer *diskImageWriter) Commit() (string, error) {
+	if writer.done {
+		return "", os.ErrClosed
+	}
 	imageID, err := uuid.NewRandom()
 	if err != nil {
 		return "", fmt.Errorf("cannot generate image id :%w", err)
 	}
-	imagePath := fmt.Sprintf("%s/%s%s", store.imageFolder, imageID, imageType)
-	file, err := os.Create(imagePath)
+	err = writer.file.Sync()
 	if err != nil {
-		return "", fmt.Errorf("cannot create image file : %w", err)
+		return "", fmt.Errorf("cannot sync image file : %w", err)
 	}
-	defer file.Close()
-	_, err = imageData.WriteTo(file)
+	err = writer.file.Close()
+	if err != nil {
+		return "", fmt.Errorf("cannot close image file : %w", err)
+	}
+	imagePath := writer.store.imagePath(writer.laptopID, imageID.String(), writer.imageType)
+	err = os.Rename(writer.file.Name(), imagePath)
 	if err != nil {
-		return "", fmt.Errorf("cannot write image file : %w", err)
+		return "", fmt.Errorf("cannot rename image file : %w", err)
 	}
+	writer.done = true
 
+	store := writer.store
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
+	imageIDs := store.laptops[writer.laptopID]
 	store.images[imageID.String()] = &ImageInfo{
-		LaptopID: laptopID,
-		Type:     imageType,
-		Path:     imagePath,
+		LaptopID:   writer.laptopID,
+		Type:       writer.imageType,
+		Path:       imagePath,
+		Size:       writer.size,
+		Checksum:   writer.hash.Sum(nil),
+		UploadedAt: time.Now().UTC(),
 	}
+	store.laptops[writer.laptopID] = append(imageIDs[:len(imageIDs):len(imageIDs)], imageID.String())
 
+	err = store.writeManifest()
+	if err != nil {
+		//图片不在manifest里,重启后就找不到了
+		delete(store.images, imageID.String())
+		store.setLaptopImages(writer.laptopID, imageIDs)
+		os.Remove(imagePath)
+		return "", err
+	}
 	return imageID.String(), nil
+}
+
+func (writer *diskImageWriter) Abort() error {
+	if writer.done {
+		return nil
+	}
+	writer.done = true
+	writer.file.Close()
+	err := os.Remove(writer.file.Name())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove image file : %w", err)
+	}
+	return nil
+}
+func (store *DiskImageStore) Find(imageID string) (*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
 
+	info := store.images[imageID]
+	if info == nil {
+		return nil, nil
+	}
+	other := *info
+	other.Checksum = append([]byte(nil), info.Checksum...)
+	return &other, nil
+}
+func (store *DiskImageStore) Open(imageID string) (io.ReadCloser, error) {
+	info, err := store.Find(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, ErrNotFound
+	}
+	file, err := os.Open(info.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		//图片可能刚被删除
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open image file : %w", err)
+	}
+	return file, nil
+}
+func (store *DiskImageStore) FindByLaptop(laptopID string) ([]string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	imageIDs := make([]string, len(store.laptops[laptopID]))
+	copy(imageIDs, store.laptops[laptopID])
+	return imageIDs, nil
+}
+func (store *DiskImageStore) Delete(imageID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	info := store.images[imageID]
+	if info == nil {
+		return ErrNotFound
+	}
+	err := os.Remove(info.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove image file : %w", err)
+	}
+	delete(store.images, imageID)
+
+	imageIDs := store.laptops[info.LaptopID]
+	i := indexOf(imageIDs, imageID)
+	store.setLaptopImages(info.LaptopID, append(imageIDs[:i:i], imageIDs[i+1:]...))
+	return store.writeManifest()
+}
+func (store *DiskImageStore) SetPrimary(imageID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	info := store.images[imageID]
+	if info == nil {
+		return ErrNotFound
+	}
+	imageIDs := store.laptops[info.LaptopID]
+	i := indexOf(imageIDs, imageID)
+	//其他图片保持原来的顺序
+	primary := append([]string{imageID}, imageIDs[:i]...)
+	store.laptops[info.LaptopID] = append(primary, imageIDs[i+1:]...)
+
+	err := store.writeManifest()
+	if err != nil {
+		store.laptops[info.LaptopID] = imageIDs
+		return err
+	}
+	return nil
+}
+func (store *DiskImageStore) DeleteByLaptop(laptopID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	imageIDs := store.laptops[laptopID]
+	for i, imageID := range imageIDs {
+		err := os.Remove(store.images[imageID].Path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			store.laptops[laptopID] = imageIDs[i:]
+			//删掉的文件在重启时也会从manifest中去掉
+			store.writeManifest()
+			return fmt.Errorf("cannot remove image file : %w", err)
+		}
+		delete(store.images, imageID)
+	}
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	delete(store.laptops, laptopID)
+	return store.writeManifest()
+}
+
+// setLaptopImages sets the image IDs of a laptop, the mutex must be locked
+func (store *DiskImageStore) setLaptopImages(laptopID string, imageIDs []string) {
+	if len(imageIDs) == 0 {
+		delete(store.laptops, laptopID)
+	} else {
+		store.laptops[laptopID] = imageIDs
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for i, other := range values {
+		if other == value {
+			return i
+		}
+	}
+	return -1
 }
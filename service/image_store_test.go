@@ -0,0 +1,121 @@
+package service_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"proto_demo/sample"
+	"proto_demo/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskImageStoreRecover(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	store := newTestImageStore(t, folder)
+	laptopID := sample.NewLaptop().GetId()
+	otherLaptopID := sample.NewLaptop().GetId()
+	deletedLaptopID := sample.NewLaptop().GetId()
+
+	data := []byte("image data")
+	first, err := store.Save(laptopID, ".jpg", bytes.NewBuffer(data))
+	require.NoError(t, err)
+	second, err := store.Save(laptopID, ".png", bytes.NewBufferString("other image data"))
+	require.NoError(t, err)
+	deleted, err := store.Save(laptopID, ".jpg", bytes.NewBufferString("deleted image data"))
+	require.NoError(t, err)
+	removed, err := store.Save(otherLaptopID, ".jpg", bytes.NewBufferString("removed image data"))
+	require.NoError(t, err)
+	require.NoError(t, store.SetPrimary(second))
+	require.NoError(t, store.Delete(deleted))
+
+	info, err := store.Find(first)
+	require.NoError(t, err)
+	checksum := sha256.Sum256(data)
+	require.Equal(t, laptopID, info.LaptopID)
+	require.Equal(t, ".jpg", info.Type)
+	require.Equal(t, int64(len(data)), info.Size)
+	require.Equal(t, checksum[:], info.Checksum)
+	require.WithinDuration(t, time.Now(), info.UploadedAt, time.Minute)
+
+	// a file removed while the server is down is dropped
+	removedInfo, err := store.Find(removed)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(removedInfo.Path))
+	// an image saved during a crash, before the manifest is written, is re-indexed
+	manifestPath := filepath.Join(folder, "images.manifest")
+	manifest, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+	orphaned, err := store.Save(laptopID, ".jpg", bytes.NewBufferString("orphaned image data"))
+	require.NoError(t, err)
+	orphanedInfo, err := store.Find(orphaned)
+	require.NoError(t, err)
+	// unless its laptop has been deleted since
+	deletedLaptopImage, err := store.Save(deletedLaptopID, ".jpg", bytes.NewBufferString("deleted laptop image data"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(manifestPath, manifest, 0644))
+	// a file of a version without manifest is ignored
+	require.NoError(t, os.WriteFile(filepath.Join(folder, "legacy.jpg"), data, 0644))
+	// an image being uploaded during a crash is removed
+	partial, err := store.Create(laptopID, ".jpg")
+	require.NoError(t, err)
+	_, err = partial.Write(data)
+	require.NoError(t, err)
+
+	other, err := service.NewDiskImageStore(folder, func(laptopID string) (bool, error) {
+		return laptopID != deletedLaptopID, nil
+	})
+	require.NoError(t, err)
+	imageIDs, err := other.FindByLaptop(laptopID)
+	require.NoError(t, err)
+	require.Equal(t, []string{second, first, orphaned}, imageIDs)
+	otherInfo, err := other.Find(first)
+	require.NoError(t, err)
+	require.Equal(t, info.Size, otherInfo.Size)
+	require.Equal(t, info.Checksum, otherInfo.Checksum)
+	require.True(t, info.UploadedAt.Equal(otherInfo.UploadedAt))
+	require.Equal(t, info.Path, otherInfo.Path)
+
+	imageIDs, err = other.FindByLaptop(otherLaptopID)
+	require.NoError(t, err)
+	require.Empty(t, imageIDs)
+	imageIDs, err = other.FindByLaptop(deletedLaptopID)
+	require.NoError(t, err)
+	require.Empty(t, imageIDs)
+	otherInfo, err = other.Find(deletedLaptopImage)
+	require.NoError(t, err)
+	require.Nil(t, otherInfo)
+	otherInfo, err = other.Find(deleted)
+	require.NoError(t, err)
+	require.Nil(t, otherInfo)
+	partials, err := filepath.Glob(filepath.Join(folder, "upload-*.tmp"))
+	require.NoError(t, err)
+	require.Empty(t, partials)
+	require.FileExists(t, filepath.Join(folder, "legacy.jpg"))
+
+	otherInfo, err = other.Find(orphaned)
+	require.NoError(t, err)
+	require.Equal(t, laptopID, otherInfo.LaptopID)
+	require.Equal(t, ".jpg", otherInfo.Type)
+	require.Equal(t, orphanedInfo.Path, otherInfo.Path)
+	require.Equal(t, orphanedInfo.Size, otherInfo.Size)
+	require.Equal(t, orphanedInfo.Checksum, otherInfo.Checksum)
+	// the re-indexed image is in the manifest
+	reopened := newTestImageStore(t, folder)
+	imageIDs, err = reopened.FindByLaptop(laptopID)
+	require.NoError(t, err)
+	require.Equal(t, []string{second, first, orphaned}, imageIDs)
+
+	reader, err := other.Open(first)
+	require.NoError(t, err)
+	defer reader.Close()
+	buffer := bytes.Buffer{}
+	_, err = buffer.ReadFrom(reader)
+	require.NoError(t, err)
+	require.Equal(t, data, buffer.Bytes())
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"proto_demo/pb"
+	"sort"
+)
+
+const maxHistograms = 10
+
+// maxHistogramBuckets limits the buckets of a histogram, a small interval would otherwise create a bucket per laptop
+const maxHistogramBuckets = 1000
+
+// maxBucketIndex keeps bucket indexes exact in float64 and within int64
+const maxBucketIndex = 1 << 53
+
+var ErrTooManyBuckets = errors.New("too many histogram buckets")
+
+var gigabyte = toBit(&pb.Memory{Value: 1, Unit: pb.Memory_GIGABYTE})
+
+// ValidateHistograms checks that every histogram has a known field and a positive interval
+func ValidateHistograms(specs []*pb.HistogramSpec) error {
+	if len(specs) > maxHistograms {
+		return fmt.Errorf("too many histograms: %d > %d", len(specs), maxHistograms)
+	}
+	for _, spec := range specs {
+		if spec.GetField() == pb.Histogram_UNKNOWN {
+			return fmt.Errorf("histogram field is not specified")
+		}
+		if spec.GetInterval() <= 0 || math.IsInf(spec.GetInterval(), 0) || math.IsNaN(spec.GetInterval()) {
+			return fmt.Errorf("histogram %s interval must be positive", spec.GetField())
+		}
+	}
+	return nil
+}
+
+// laptopAggregator counts facets, price stats and histograms of the laptops added to it
+type laptopAggregator struct {
+	total           uint32
+	brands          map[string]uint32
+	cpuBrands       map[string]uint32
+	gpuBrands       map[string]uint32
+	storageDrivers  map[string]uint32
+	screenPanels    map[string]uint32
+	keyboardLayouts map[string]uint32
+	minPrice        float64
+	maxPrice        float64
+	sumPrice        float64
+	specs           []*pb.HistogramSpec
+	buckets         []map[int64]uint32
+	err             error
+}
+
+func newLaptopAggregator(specs []*pb.HistogramSpec) *laptopAggregator {
+	aggregator := &laptopAggregator{
+		brands:          make(map[string]uint32),
+		cpuBrands:       make(map[string]uint32),
+		gpuBrands:       make(map[string]uint32),
+		storageDrivers:  make(map[string]uint32),
+		screenPanels:    make(map[string]uint32),
+		keyboardLayouts: make(map[string]uint32),
+		specs:           specs,
+		buckets:         make([]map[int64]uint32, len(specs)),
+	}
+	for i := range specs {
+		aggregator.buckets[i] = make(map[int64]uint32)
+	}
+	return aggregator
+}
+
+func (aggregator *laptopAggregator) Add(laptop *pb.Laptop) {
+	price := laptop.GetPriceUsd()
+	if aggregator.total == 0 || price < aggregator.minPrice {
+		aggregator.minPrice = price
+	}
+	if aggregator.total == 0 || price > aggregator.maxPrice {
+		aggregator.maxPrice = price
+	}
+	aggregator.sumPrice += price
+	aggregator.total++
+
+	aggregator.brands[laptop.GetBrand()]++
+	aggregator.cpuBrands[laptop.GetCpu().GetBrand()]++
+	aggregator.screenPanels[laptop.GetScreen().GetPanel().String()]++
+	aggregator.keyboardLayouts[laptop.GetKeyboard().GetLayout().String()]++
+
+	//每台laptop在每个值上只计数一次
+	gpuBrands := make(map[string]bool)
+	for _, gpu := range laptop.GetGpus() {
+		gpuBrands[gpu.GetBrand()] = true
+	}
+	for brand := range gpuBrands {
+		aggregator.gpuBrands[brand]++
+	}
+	drivers := make(map[string]bool)
+	for _, storage := range laptop.GetStorages() {
+		drivers[storage.GetDriver().String()] = true
+	}
+	for driver := range drivers {
+		aggregator.storageDrivers[driver]++
+	}
+
+	for i, spec := range aggregator.specs {
+		value, ok := histogramValue(spec.GetField(), laptop)
+		if !ok {
+			continue
+		}
+		aggregator.addBucket(i, math.Floor(value/spec.GetInterval()), 1)
+	}
+}
+
+// addBucket adds count laptops to the bucket at index of the i-th histogram
+func (aggregator *laptopAggregator) addBucket(i int, index float64, count uint32) {
+	buckets := aggregator.buckets[i]
+	if math.Abs(index) > maxBucketIndex || (buckets[int64(index)] == 0 && len(buckets) >= maxHistogramBuckets) {
+		if aggregator.err == nil {
+			aggregator.err = fmt.Errorf(
+				"%w: histogram %s needs more than %d buckets, use a larger interval",
+				ErrTooManyBuckets, aggregator.specs[i].GetField(), maxHistogramBuckets,
+			)
+		}
+		return
+	}
+	buckets[int64(index)] += count
+}
+
+// Result returns the aggregation of the laptops added so far,
+// it fails with ErrTooManyBuckets if a histogram exceeds maxHistogramBuckets
+func (aggregator *laptopAggregator) Result() (*pb.AggregateLaptopsResponse, error) {
+	if aggregator.err != nil {
+		return nil, aggregator.err
+	}
+	res := &pb.AggregateLaptopsResponse{
+		Total:           aggregator.total,
+		Brands:          facetCounts(aggregator.brands),
+		CpuBrands:       facetCounts(aggregator.cpuBrands),
+		GpuBrands:       facetCounts(aggregator.gpuBrands),
+		StorageDrivers:  facetCounts(aggregator.storageDrivers),
+		ScreenPanels:    facetCounts(aggregator.screenPanels),
+		KeyboardLayouts: facetCounts(aggregator.keyboardLayouts),
+		Price:           &pb.PriceStats{},
+	}
+	if aggregator.total > 0 {
+		res.Price.MinUsd = aggregator.minPrice
+		res.Price.MaxUsd = aggregator.maxPrice
+		res.Price.AvgUsd = aggregator.sumPrice / float64(aggregator.total)
+	}
+
+	for i, spec := range aggregator.specs {
+		histogram := &pb.Histogram{
+			Field:    spec.GetField(),
+			Interval: spec.GetInterval(),
+		}
+		indexes := make([]int64, 0, len(aggregator.buckets[i]))
+		for index := range aggregator.buckets[i] {
+			indexes = append(indexes, index)
+		}
+		sort.Slice(indexes, func(a, b int) bool { return indexes[a] < indexes[b] })
+		for _, index := range indexes {
+			histogram.Buckets = append(histogram.Buckets, &pb.Histogram_Bucket{
+				Min:   float64(index) * spec.GetInterval(),
+				Max:   float64(index+1) * spec.GetInterval(),
+				Count: aggregator.buckets[i][index],
+			})
+		}
+		res.Histograms = append(res.Histograms, histogram)
+	}
+	return res, nil
+}
+
+// facetCounts sorts counts by count descending then by value
+func facetCounts(counts map[string]uint32) []*pb.FacetCount {
+	facets := make([]*pb.FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facets = append(facets, &pb.FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+	return facets
+}
+
+// histogramValue returns the value of field for laptop, ok is false if the value is unknown
+func histogramValue(field pb.Histogram_Field, laptop *pb.Laptop) (value float64, ok bool) {
+	switch field {
+	case pb.Histogram_PRICE_USD:
+		return laptop.GetPriceUsd(), true
+	case pb.Histogram_RAM_GB:
+		return float64(toBit(laptop.GetRam())) / float64(gigabyte), true
+	case pb.Histogram_CPU_CORES:
+		return float64(laptop.GetCpu().GetNumberCores()), true
+	case pb.Histogram_CPU_GHZ:
+		return laptop.GetCpu().GetMinGhz(), true
+	case pb.Histogram_SSD_GB:
+		return float64(totalStorage(laptop.GetStorages(), pb.Storage_SSD)) / float64(gigabyte), true
+	case pb.Histogram_SCREEN_SIZE_INCH:
+		return float64(laptop.GetScreen().GetSizeInch()), true
+	case pb.Histogram_WEIGHT_KG:
+		return weightKg(laptop)
+	case pb.Histogram_RELEASE_YEAR:
+		return float64(laptop.GetReleaseYear()), true
+	default:
+		return 0, false
+	}
+}
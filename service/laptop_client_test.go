@@ -2,20 +2,31 @@ package service_test
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"proto_demo/client"
 	"proto_demo/pb"
 	"proto_demo/sample"
 	"proto_demo/serializer"
 	"proto_demo/service"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 func TestClientCreateLaptop(t *testing.T) {
@@ -38,7 +49,9 @@ func TestClientCreateLaptop(t *testing.T) {
 	other, err := laptopstore.Find(res.Id)
 	require.NoError(t, err)
 	require.NotNil(t, other)
+	require.Equal(t, uint64(1), other.GetRevision())
 
+	laptop.Revision = other.GetRevision()
 	requireSameLaptop(t, laptop, other)
 
 }
@@ -46,7 +59,7 @@ func TestClientSearchLaptop(t *testing.T) {
 	t.Parallel()
 
 	filter := &pb.Filter{
-		MaxPriceUsd: 2000,
+		MaxPriceUsd: proto.Float64(2000),
 		MinCpuCores: 4,
 		MinCpuGhz:   2.2,
 		MinRam:      &pb.Memory{Value: 8, Unit: pb.Memory_GIGABYTE},
@@ -109,8 +122,9 @@ func TestClientUploadImage(t *testing.T) {
 	t.Parallel()
 
 	testImageFolder := "../tmp"
+	imageFolder := t.TempDir()
 	laptopstore := service.NewInMemoryLaptopStore()
-	imagestore := service.NewDiskImageStore(testImageFolder)
+	imagestore := newTestImageStore(t, imageFolder)
 
 	laptop := sample.NewLaptop()
 	err := laptopstore.Save(laptop)
@@ -164,11 +178,160 @@ func TestClientUploadImage(t *testing.T) {
 	require.NotZero(t, res.GetId())
 	require.EqualValues(t, size, res.GetSize())
 
-	savedImagePath := fmt.Sprintf("%s/%s%s", testImageFolder, res.GetId(), imageTyep)
+	savedImagePath := fmt.Sprintf("%s/%s_%s%s", imageFolder, laptop.GetId(), res.GetId(), imageTyep)
 	require.FileExists(t, savedImagePath)
-	require.NoError(t, os.Remove(savedImagePath))
 
 }
+func TestClientDownloadImage(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	imagestore := newTestImageStore(t, t.TempDir())
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopstore.Save(laptop))
+	serverAddress := startTestLaptopServer(t, laptopstore, imagestore, nil)
+
+	//大于一个分块
+	data := bytes.Repeat([]byte("image data"), 10000)
+	imageID, err := imagestore.Save(laptop.GetId(), ".png", bytes.NewBuffer(data))
+	require.NoError(t, err)
+
+	cc, err := grpc.Dial(serverAddress, grpc.WithInsecure())
+	require.NoError(t, err)
+	laptopClient := client.NewLaptopClient(cc)
+
+	folder := t.TempDir()
+	imagePath, err := laptopClient.DownloadImage(context.Background(), imageID, folder)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(folder, imageID+".png"), imagePath)
+	downloaded, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+	require.Equal(t, data, downloaded)
+
+	_, err = laptopClient.DownloadImage(context.Background(), "missing", folder)
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Equal(t, pb.ErrorReason_IMAGE_NOT_FOUND, client.ErrorReason(err))
+	files, err := os.ReadDir(folder)
+	require.NoError(t, err)
+	require.Len(t, files, 1, "a failed download doesn't leave a file")
+}
+
+func TestClientDownloadImageSlowly(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	imagestore := &slowImageStore{DiskImageStore: newTestImageStore(t, t.TempDir()), delay: 100 * time.Millisecond}
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopstore.Save(laptop))
+	serverAddress := startTestLaptopServer(t, laptopstore, imagestore, nil)
+
+	//4个分块,每次读取都要等100ms
+	data := bytes.Repeat([]byte("image data"), 20000)
+	imageID, err := imagestore.Save(laptop.GetId(), ".png", bytes.NewBuffer(data))
+	require.NoError(t, err)
+	cc, err := grpc.Dial(serverAddress, grpc.WithInsecure())
+	require.NoError(t, err)
+	laptopClient := client.NewLaptopClient(cc)
+
+	folder := t.TempDir()
+	imagePath, err := laptopClient.DownloadImage(context.Background(), imageID, folder)
+	require.NoError(t, err)
+	downloaded, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+	require.Equal(t, data, downloaded)
+
+	// the deadline is the one of the caller
+	other := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	_, err = laptopClient.DownloadImage(ctx, imageID, other)
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	files, err := os.ReadDir(other)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+// slowImageStore waits before each read of an image
+type slowImageStore struct {
+	*service.DiskImageStore
+	delay time.Duration
+}
+
+func (store *slowImageStore) Open(imageID string) (io.ReadCloser, error) {
+	reader, err := store.DiskImageStore.Open(imageID)
+	if err != nil {
+		return nil, err
+	}
+	return &slowReader{ReadCloser: reader, delay: store.delay}, nil
+}
+
+type slowReader struct {
+	io.ReadCloser
+	delay time.Duration
+}
+
+func (reader *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(reader.delay)
+	return reader.ReadCloser.Read(p)
+}
+
+func TestClientImageGallery(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	imagestore := newTestImageStore(t, t.TempDir())
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopstore.Save(laptop))
+	serverAddress := startTestLaptopServer(t, laptopstore, imagestore, nil)
+
+	imageIDs := make([]string, 3)
+	for i := range imageIDs {
+		imageID, err := imagestore.Save(laptop.GetId(), ".jpg", bytes.NewBufferString("image data"))
+		require.NoError(t, err)
+		imageIDs[i] = imageID
+	}
+
+	cc, err := grpc.Dial(serverAddress, grpc.WithInsecure())
+	require.NoError(t, err)
+	laptopClient := client.NewLaptopClient(cc)
+	requireImages := func(images []*pb.Image, expected ...string) {
+		t.Helper()
+		require.Len(t, images, len(expected))
+		for i, image := range images {
+			require.Equal(t, expected[i], image.GetId())
+			require.Equal(t, laptop.GetId(), image.GetLaptopId())
+			require.Equal(t, ".jpg", image.GetImageType())
+			require.Equal(t, i == 0, image.GetPrimary())
+		}
+	}
+
+	images, err := laptopClient.ListImages(laptop.GetId())
+	require.NoError(t, err)
+	requireImages(images, imageIDs...)
+
+	images, err = laptopClient.SetPrimaryImage(imageIDs[2])
+	require.NoError(t, err)
+	requireImages(images, imageIDs[2], imageIDs[0], imageIDs[1])
+	res, err := laptopClient.GetLaptop(laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, imageIDs[2], res.GetPrimaryImageId())
+
+	require.NoError(t, laptopClient.DeleteImage(imageIDs[2]))
+	images, err = laptopClient.ListImages(laptop.GetId())
+	require.NoError(t, err)
+	requireImages(images, imageIDs[0], imageIDs[1])
+	res, err = laptopClient.GetLaptop(laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, imageIDs[0], res.GetPrimaryImageId(), "the next image becomes the primary image")
+
+	err = laptopClient.DeleteImage(imageIDs[2])
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Equal(t, pb.ErrorReason_IMAGE_NOT_FOUND, client.ErrorReason(err))
+	_, err = laptopClient.SetPrimaryImage(imageIDs[2])
+	require.Equal(t, pb.ErrorReason_IMAGE_NOT_FOUND, client.ErrorReason(err))
+	_, err = laptopClient.ListImages("missing")
+	require.Equal(t, pb.ErrorReason_LAPTOP_NOT_FOUND, client.ErrorReason(err))
+}
 func TestClientRateImage(t *testing.T) {
 	t.Parallel()
 
@@ -217,9 +380,571 @@ func TestClientRateImage(t *testing.T) {
 	}
 
 }
+func TestClientGetLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	imagestore := newTestImageStore(t, t.TempDir())
+	ratingstore := service.NewInMemoryRatingStore()
+
+	laptop := sample.NewLaptop()
+	err := laptopstore.Save(laptop)
+	require.NoError(t, err)
+	imageID, err := imagestore.Save(laptop.GetId(), ".jpg", bytes.NewBufferString("image"))
+	require.NoError(t, err)
+	_, err = ratingstore.Add(laptop.GetId(), 8)
+	require.NoError(t, err)
+	_, err = ratingstore.Add(laptop.GetId(), 9)
+	require.NoError(t, err)
+
+	serverAddress := startTestLaptopServer(t, laptopstore, imagestore, ratingstore)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	res, err := laptopClient.GetLaptop(context.Background(), &pb.GetLaptopRequest{Id: laptop.GetId()})
+	require.NoError(t, err)
+	laptop.Revision = 1
+	requireSameLaptop(t, laptop, res.GetLaptop())
+	require.Equal(t, uint32(2), res.GetRating().GetRatedCount())
+	require.Equal(t, 8.5, res.GetRating().GetAverageScore())
+	require.Equal(t, []string{imageID}, res.GetImageIds())
+
+	missingID := sample.NewLaptop().GetId()
+	_, err = laptopClient.GetLaptop(context.Background(), &pb.GetLaptopRequest{Id: missingID})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	batch, err := laptopClient.BatchGetLaptops(context.Background(), &pb.BatchGetLaptopsRequest{
+		Ids: []string{laptop.GetId(), missingID},
+	})
+	require.NoError(t, err)
+	require.Len(t, batch.GetResults(), 2)
+	require.Equal(t, laptop.GetId(), batch.GetResults()[0].GetId())
+	require.Equal(t, uint32(codes.OK), batch.GetResults()[0].GetCode())
+	requireSameLaptop(t, laptop, batch.GetResults()[0].GetLaptop().GetLaptop())
+	require.Equal(t, missingID, batch.GetResults()[1].GetId())
+	require.Equal(t, uint32(codes.NotFound), batch.GetResults()[1].GetCode())
+	require.Nil(t, batch.GetResults()[1].GetLaptop())
+}
+func TestClientWatchLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	serverAddress := startTestLaptopServer(t, laptopstore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	// the watch is established once it receives the event of a new laptop
+	ctx, cancel := context.WithCancel(context.Background())
+	warmup, err := laptopClient.WatchLaptops(ctx, &pb.WatchLaptopsRequest{})
+	require.NoError(t, err)
+	events := make(chan *pb.LaptopEvent)
+	go func() {
+		for {
+			res, err := warmup.Recv()
+			if err != nil {
+				return
+			}
+			select {
+			case events <- res.GetEvent():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var resumeToken string
+	for resumeToken == "" {
+		err = laptopstore.Save(sample.NewLaptop())
+		require.NoError(t, err)
+		select {
+		case event := <-events:
+			require.Equal(t, pb.LaptopEvent_CREATED, event.GetType())
+			resumeToken = event.GetResumeToken()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	cancel()
+
+	laptop := sample.NewLaptop()
+	laptop.Brand = "Watched"
+	err = laptopstore.Save(laptop)
+	require.NoError(t, err)
+	err = laptopstore.Save(sample.NewLaptop())
+	require.NoError(t, err)
+	laptop.PriceUsd = 1234
+	_, err = laptopstore.Update(laptop, &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}})
+	require.NoError(t, err)
+	err = laptopstore.Delete(laptop.GetId(), true)
+	require.NoError(t, err)
+	leaving := sample.NewLaptop()
+	leaving.Brand = "Watched"
+	err = laptopstore.Save(leaving)
+	require.NoError(t, err)
+	_, err = laptopstore.Update(&pb.Laptop{Id: leaving.GetId(), Brand: "Other"}, &fieldmaskpb.FieldMask{Paths: []string{"brand"}})
+	require.NoError(t, err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	req := &pb.WatchLaptopsRequest{
+		Filter:      &pb.Filter{Brands: []string{"watched"}},
+		ResumeToken: resumeToken,
+	}
+	stream, err := laptopClient.WatchLaptops(ctx, req)
+	require.NoError(t, err)
+
+	expected := []struct {
+		eventType pb.LaptopEvent_Type
+		laptopID  string
+		revision  uint64
+	}{
+		{pb.LaptopEvent_CREATED, laptop.GetId(), 1},
+		{pb.LaptopEvent_UPDATED, laptop.GetId(), 2},
+		{pb.LaptopEvent_DELETED, laptop.GetId(), 2},
+		{pb.LaptopEvent_CREATED, leaving.GetId(), 1},
+		// the laptop no longer matches the filter
+		{pb.LaptopEvent_LEFT_FILTER, leaving.GetId(), 2},
+	}
+	for _, want := range expected {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		event := res.GetEvent()
+		require.Equal(t, want.eventType, event.GetType())
+		require.Equal(t, want.laptopID, event.GetLaptop().GetId())
+		require.Equal(t, want.revision, event.GetLaptop().GetRevision())
+		require.NotEmpty(t, event.GetResumeToken())
+		require.NotNil(t, event.GetTime())
+	}
+
+	stream, err = laptopClient.WatchLaptops(context.Background(), &pb.WatchLaptopsRequest{ResumeToken: "invalid"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the token of another server process has expired
+	otherServerAddress := startTestLaptopServer(t, service.NewInMemoryLaptopStore(), nil, nil)
+	otherClient := newTestLaptopClient(t, otherServerAddress)
+	stream, err = otherClient.WatchLaptops(context.Background(), &pb.WatchLaptopsRequest{ResumeToken: resumeToken})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+}
+func TestClientImportLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	serverAddress := startTestLaptopServer(t, laptopstore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	existing := sample.NewLaptop()
+	require.NoError(t, laptopstore.Save(existing))
+	invalid := sample.NewLaptop()
+	invalid.Id = "invalid-uuid"
+	duplicate := sample.NewLaptop()
+	noID := sample.NewLaptop()
+	noID.Id = ""
+	negativePrice := sample.NewLaptop()
+	negativePrice.PriceUsd = -1
+
+	importLaptops := func(transactional bool, laptops ...*pb.Laptop) *pb.ImportLaptopsResponse {
+		stream, err := laptopClient.ImportLaptops(context.Background())
+		require.NoError(t, err)
+		for _, laptop := range laptops {
+			err := stream.Send(&pb.ImportLaptopsRequest{Laptop: laptop, Transactional: transactional})
+			require.NoError(t, err)
+		}
+		res, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		return res
+	}
+	failureReasons := func(res *pb.ImportLaptopsResponse) map[uint32]pb.ImportFailure_Reason {
+		reasons := make(map[uint32]pb.ImportFailure_Reason)
+		for _, failure := range res.GetFailures() {
+			reasons[failure.GetIndex()] = failure.GetReason()
+		}
+		return reasons
+	}
+	expectedReasons := map[uint32]pb.ImportFailure_Reason{
+		1: pb.ImportFailure_INVALID_ID,
+		3: pb.ImportFailure_DUPLICATE,
+		4: pb.ImportFailure_DUPLICATE,
+		5: pb.ImportFailure_INVALID_LAPTOP,
+		7: pb.ImportFailure_INVALID_LAPTOP,
+	}
+
+	valid := sample.NewLaptop()
+	res := importLaptops(true, valid, invalid, duplicate, duplicate, existing, nil)
+	require.Equal(t, uint32(6), res.GetReceived())
+	require.Empty(t, res.GetCreatedIds())
+	require.Equal(t, map[uint32]pb.ImportFailure_Reason{
+		1: pb.ImportFailure_INVALID_ID,
+		3: pb.ImportFailure_DUPLICATE,
+		5: pb.ImportFailure_INVALID_LAPTOP,
+	}, failureReasons(res))
+	found, err := laptopstore.Find(valid.GetId())
+	require.NoError(t, err)
+	require.Nil(t, found, "a transactional import saves nothing if a laptop fails")
+
+	res = importLaptops(false, valid, invalid, duplicate, duplicate, existing, nil, noID, negativePrice)
+	require.Equal(t, uint32(8), res.GetReceived())
+	require.Len(t, res.GetCreatedIds(), 3)
+	require.Equal(t, []string{valid.GetId(), duplicate.GetId()}, res.GetCreatedIds()[:2])
+	require.Equal(t, expectedReasons, failureReasons(res))
+	for _, id := range res.GetCreatedIds() {
+		found, err := laptopstore.Find(id)
+		require.NoError(t, err)
+		require.NotNil(t, found)
+	}
+
+	res = importLaptops(true, sample.NewLaptop(), sample.NewLaptop())
+	require.Len(t, res.GetCreatedIds(), 2)
+	require.Empty(t, res.GetFailures())
+}
+
+func TestClientImportLaptopsStoreFailure(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := &flakyLaptopStore{InMemoryLaptopStore: service.NewInMemoryLaptopStore(), failAt: 2}
+	serverAddress := startTestLaptopServer(t, laptopstore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	//三批:100,100,50,第二批保存失败
+	laptops := make([]*pb.Laptop, 250)
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+	}
+	importLaptops := func(transactional bool) (*pb.ImportLaptopsResponse, error) {
+		stream, err := laptopClient.ImportLaptops(context.Background())
+		require.NoError(t, err)
+		for _, laptop := range laptops {
+			err := stream.Send(&pb.ImportLaptopsRequest{Laptop: laptop, Transactional: transactional})
+			require.NoError(t, err)
+		}
+		return stream.CloseAndRecv()
+	}
+
+	res, err := importLaptops(false)
+	require.NoError(t, err)
+	require.Equal(t, uint32(250), res.GetReceived())
+	require.Len(t, res.GetCreatedIds(), 150)
+	require.Len(t, res.GetFailures(), 100)
+	for i, failure := range res.GetFailures() {
+		require.Equal(t, uint32(100+i), failure.GetIndex())
+		require.Equal(t, laptops[100+i].GetId(), failure.GetId())
+		require.Equal(t, pb.ImportFailure_STORE_FAILURE, failure.GetReason())
+	}
+	for i, laptop := range laptops {
+		found, err := laptopstore.Find(laptop.GetId())
+		require.NoError(t, err)
+		require.Equal(t, i < 100 || i >= 200, found != nil)
+	}
+
+	// a transactional import saves nothing, the failure is returned
+	laptopstore.mutex.Lock()
+	laptopstore.calls, laptopstore.failAt = 0, 1
+	laptopstore.mutex.Unlock()
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+	}
+	_, err = importLaptops(true)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+// flakyLaptopStore fails the failAt-th call of SaveAll
+type flakyLaptopStore struct {
+	*service.InMemoryLaptopStore
+	mutex  sync.Mutex
+	calls  int
+	failAt int
+}
+
+func (store *flakyLaptopStore) SaveAll(laptops []*pb.Laptop) error {
+	store.mutex.Lock()
+	store.calls++
+	fail := store.calls == store.failAt
+	store.mutex.Unlock()
+	if fail {
+		return fmt.Errorf("cannot write laptops: %w", os.ErrClosed)
+	}
+	return store.InMemoryLaptopStore.SaveAll(laptops)
+}
+
+func TestClientStreamErrorDetails(t *testing.T) {
+	t.Parallel()
+
+	sqlStore, err := service.NewSQLStore(":memory:")
+	require.NoError(t, err)
+	require.NoError(t, sqlStore.Close())
+	serverAddress := startTestLaptopServer(t, sqlStore.Laptops, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	stream, err := laptopClient.SearchLaptop(context.Background(), &pb.SearchLaptopRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, pb.ErrorReason_STORE_UNAVAILABLE, client.ErrorReason(err))
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopstore.Save(laptop))
+	laptopServer := service.NewLaptopService(laptopstore, newTestImageStore(t, t.TempDir()), nil, nil)
+	laptopServer.MaxImageSize = 1 << 20
+	laptopClient = newTestLaptopClient(t, startTestServer(t, laptopServer))
+
+	upload, err := laptopClient.UploadImage(context.Background())
+	require.NoError(t, err)
+	info := &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".jpg"}
+	err = upload.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_Info{Info: info}})
+	require.NoError(t, err)
+	chunk := make([]byte, 64*1024)
+	for err == nil {
+		err = upload.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: chunk}})
+	}
+	_, err = upload.CloseAndRecv()
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, pb.ErrorReason_IMAGE_TOO_LARGE, client.ErrorReason(err))
+	quotaFailure := &errdetails.QuotaFailure{}
+	requireErrorDetail(t, err, quotaFailure)
+	require.Equal(t, "laptop:"+laptop.GetId(), quotaFailure.GetViolations()[0].GetSubject())
+}
+
+func TestClientUploadImageCanceled(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopstore.Save(laptop))
+	imageFolder := t.TempDir()
+	imagestore := newTestImageStore(t, imageFolder)
+	laptopClient := newTestLaptopClient(t, startTestLaptopServer(t, laptopstore, imagestore, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := laptopClient.UploadImage(ctx)
+	require.NoError(t, err)
+	info := &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".jpg"}
+	require.NoError(t, stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_Info{Info: info}}))
+	chunk := bytes.Repeat([]byte("image data"), 1000)
+	require.NoError(t, stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: chunk}}))
+
+	//等服务器开始写文件
+	partial := func() int {
+		files, err := filepath.Glob(filepath.Join(imageFolder, "upload-*.tmp"))
+		require.NoError(t, err)
+		return len(files)
+	}
+	require.Eventually(t, func() bool { return partial() == 1 }, time.Second, 10*time.Millisecond)
+	cancel()
+	require.Eventually(t, func() bool { return partial() == 0 }, time.Second, 10*time.Millisecond, "the partial file is removed")
+
+	imageIDs, err := imagestore.FindByLaptop(laptop.GetId())
+	require.NoError(t, err)
+	require.Empty(t, imageIDs)
+}
+
+func TestClientUploadImageIdempotency(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopstore.Save(laptop))
+	imagestore := newTestImageStore(t, t.TempDir())
+	laptopServer := service.NewLaptopService(
+		laptopstore,
+		imagestore,
+		nil,
+		service.NewIdempotencyStore(time.Minute),
+	)
+	laptopClient := newTestLaptopClient(t, startTestServer(t, laptopServer))
+
+	upload := func(key string, data []byte) (*pb.UploadImageResponse, error) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), service.IdempotencyKeyHeader, key)
+		stream, err := laptopClient.UploadImage(ctx)
+		require.NoError(t, err)
+		info := &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".jpg"}
+		require.NoError(t, stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_Info{Info: info}}))
+		require.NoError(t, stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: data}}))
+		return stream.CloseAndRecv()
+	}
+
+	res, err := upload("photo-1", []byte("image data"))
+	require.NoError(t, err)
+	replay, err := upload("photo-1", []byte("image data"))
+	require.NoError(t, err)
+	require.Equal(t, res.GetId(), replay.GetId())
+	imageIDs, err := imagestore.FindByLaptop(laptop.GetId())
+	require.NoError(t, err)
+	require.Len(t, imageIDs, 1, "a replay doesn't store the image again")
+
+	_, err = upload("photo-1", []byte("other image data"))
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	other, err := upload("photo-2", []byte("image data"))
+	require.NoError(t, err)
+	require.NotEqual(t, res.GetId(), other.GetId())
+}
+
+func TestClientResumableUpload(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopstore.Save(laptop))
+	imagestore := newTestImageStore(t, t.TempDir())
+	laptopClient := newTestLaptopClient(t, startTestLaptopServer(t, laptopstore, imagestore, nil))
+	ctx := context.Background()
+
+	start := func() string {
+		info := &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".jpg"}
+		res, err := laptopClient.StartUpload(ctx, &pb.StartUploadRequest{Info: info})
+		require.NoError(t, err)
+		return res.GetUploadId()
+	}
+	send := func(uploadID string, offset int64, data string) (*pb.UploadChunksResponse, error) {
+		stream, err := laptopClient.UploadChunks(ctx)
+		require.NoError(t, err)
+		req := &pb.UploadChunkRequest{UploadId: uploadID, Offset: offset, ChunkData: []byte(data)}
+		require.NoError(t, stream.Send(req))
+		return stream.CloseAndRecv()
+	}
+	checksum := func(data string) []byte {
+		sum := sha256.Sum256([]byte(data))
+		return sum[:]
+	}
+
+	uploadID := start()
+	res, err := send(uploadID, 0, "first part ")
+	require.NoError(t, err)
+	require.Equal(t, int64(len("first part ")), res.GetCommittedSize())
+
+	_, err = send(uploadID, 0, "first part ")
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	require.Equal(t, pb.ErrorReason_UPLOAD_OFFSET_MISMATCH, client.ErrorReason(err))
+	query, err := laptopClient.QueryUpload(ctx, &pb.QueryUploadRequest{UploadId: uploadID})
+	require.NoError(t, err)
+	require.Equal(t, res.GetCommittedSize(), query.GetCommittedSize())
+
+	other := start()
+	stream, err := laptopClient.UploadChunks(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.UploadChunkRequest{UploadId: other, Offset: 0, ChunkData: []byte("other")}))
+	require.NoError(t, stream.Send(&pb.UploadChunkRequest{UploadId: uploadID, Offset: query.GetCommittedSize(), ChunkData: []byte("mixed")}))
+	_, err = stream.CloseAndRecv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "a stream only belongs to the upload of its first chunk")
+	query, err = laptopClient.QueryUpload(ctx, &pb.QueryUploadRequest{UploadId: uploadID})
+	require.NoError(t, err)
+	require.Equal(t, res.GetCommittedSize(), query.GetCommittedSize())
+
+	_, err = send(uploadID, query.GetCommittedSize(), "second part")
+	require.NoError(t, err)
+	finish := &pb.FinishUploadRequest{UploadId: uploadID, Checksum: checksum("first part second part")}
+	image, err := laptopClient.FinishUpload(ctx, finish)
+	require.NoError(t, err)
+	require.EqualValues(t, len("first part second part"), image.GetSize())
+	replay, err := laptopClient.FinishUpload(ctx, finish)
+	require.NoError(t, err)
+	require.Equal(t, image.GetId(), replay.GetId(), "a finished upload can be finished again")
+	_, err = send(uploadID, int64(image.GetSize()), "more")
+	require.Equal(t, pb.ErrorReason_UPLOAD_FINISHED, client.ErrorReason(err))
+
+	file, err := imagestore.Open(image.GetId())
+	require.NoError(t, err)
+	data, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	require.Equal(t, "first part second part", string(data))
+
+	corrupted := start()
+	_, err = send(corrupted, 0, "corrupted data")
+	require.NoError(t, err)
+	_, err = laptopClient.FinishUpload(ctx, &pb.FinishUploadRequest{UploadId: corrupted, Checksum: checksum("data")})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, pb.ErrorReason_UPLOAD_CHECKSUM_MISMATCH, client.ErrorReason(err))
+	_, err = laptopClient.QueryUpload(ctx, &pb.QueryUploadRequest{UploadId: corrupted})
+	require.Equal(t, pb.ErrorReason_UPLOAD_NOT_FOUND, client.ErrorReason(err), "a corrupted upload is aborted")
+
+	imageIDs, err := imagestore.FindByLaptop(laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, []string{image.GetId()}, imageIDs)
+
+	_, err = laptopClient.QueryUpload(ctx, &pb.QueryUploadRequest{UploadId: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	info := &pb.ImageInfo{LaptopId: sample.NewLaptop().GetId(), ImageType: ".jpg"}
+	_, err = laptopClient.StartUpload(ctx, &pb.StartUploadRequest{Info: info})
+	require.Equal(t, pb.ErrorReason_LAPTOP_NOT_FOUND, client.ErrorReason(err))
+}
+
+func TestClientUploadImageResume(t *testing.T) {
+	t.Parallel()
+
+	laptopstore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopstore.Save(laptop))
+	imagestore := newTestImageStore(t, t.TempDir())
+	laptopServer := service.NewLaptopService(laptopstore, imagestore, nil, nil)
+
+	//第一次上传在收到两个分块之后断开
+	chunks := 0
+	failed := false
+	mutex := sync.Mutex{}
+	interceptor := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if info.FullMethod != "/techschool.pcbook.LaptopService/UploadChunks" {
+			return handler(srv, ss)
+		}
+		mutex.Lock()
+		disconnect := !failed
+		failed = true
+		mutex.Unlock()
+		return handler(srv, &flakyServerStream{ServerStream: ss, disconnect: disconnect, received: func() {
+			mutex.Lock()
+			chunks++
+			mutex.Unlock()
+		}})
+	}
+	serverAddress := startTestServer(t, laptopServer, grpc.StreamInterceptor(interceptor))
+
+	data := bytes.Repeat([]byte("image data"), 30000)
+	imagePath := filepath.Join(t.TempDir(), "laptop.jpg")
+	require.NoError(t, os.WriteFile(imagePath, data, 0644))
+
+	cc, err := grpc.Dial(serverAddress, grpc.WithInsecure())
+	require.NoError(t, err)
+	imageID, err := client.NewLaptopClient(cc).UploadImage(laptop.GetId(), imagePath)
+	require.NoError(t, err)
+
+	file, err := imagestore.Open(imageID)
+	require.NoError(t, err)
+	uploaded, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	require.Equal(t, data, uploaded)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.True(t, failed)
+	require.Equal(t, (len(data)+64<<10-1)/(64<<10), chunks, "the chunks received before the disconnection aren't sent again")
+}
+
+// flakyServerStream fails after receiving two messages if disconnect is true
+type flakyServerStream struct {
+	grpc.ServerStream
+	disconnect bool
+	received   func()
+	count      int
+}
+
+func (stream *flakyServerStream) RecvMsg(m any) error {
+	if stream.disconnect && stream.count == 2 {
+		return status.Error(codes.Unavailable, "connection lost")
+	}
+	err := stream.ServerStream.RecvMsg(m)
+	if err == nil {
+		stream.count++
+		stream.received()
+	}
+	return err
+}
+
 func startTestLaptopServer(t *testing.T, laptopstore service.LaptopStore, imagestore service.ImageStore, ratingstore service.RatingStore) string {
-	laptopServer := service.NewLaptopService(laptopstore, imagestore, ratingstore)
-	grpcService := grpc.NewServer()
+	return startTestServer(t, service.NewLaptopService(laptopstore, imagestore, ratingstore, nil))
+}
+func startTestServer(t *testing.T, laptopServer *service.LaptopServer, opts ...grpc.ServerOption) string {
+	grpcService := grpc.NewServer(opts...)
 	pb.RegisterLaptopServiceServer(grpcService, laptopServer)
 
 	l, err := net.Listen("tcp", ":0") // random available port
@@ -230,6 +955,12 @@ func startTestLaptopServer(t *testing.T, laptopstore service.LaptopStore, images
 	return l.Addr().String()
 
 }
+func newTestImageStore(t *testing.T, imageFolder string) *service.DiskImageStore {
+	imagestore, err := service.NewDiskImageStore(imageFolder, nil)
+	require.NoError(t, err)
+	return imagestore
+}
+
 func newTestLaptopClient(t *testing.T, serverAddress string) pb.LaptopServiceClient {
 	cc, err := grpc.Dial(serverAddress, grpc.WithInsecure()) //不安全连接
 	require.NoError(t, err)
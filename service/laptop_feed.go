@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"proto_demo/pb"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// eventLogSize is the number of events kept to resume a watch
+const eventLogSize = 1000
+
+var ErrInvalidResumeToken = errors.New("invalid resume token")
+var ErrResumeTokenExpired = errors.New("resume token has expired")
+
+// changeFeed is a bounded log of laptop events that watchers can follow and resume.
+// resume tokens are "epoch/sequence", the epoch changes with every feed so the tokens
+// of a previous process expire instead of pointing at unrelated events
+type changeFeed struct {
+	mutex sync.Mutex
+	epoch string
+	// events is a ring buffer of the last events, the event with sequence number s is events[s%len(events)]
+	events []*pb.LaptopEvent
+	// next is the sequence number of the next event, the first event is 1
+	next uint64
+	// notify is closed and replaced each time an event is published
+	notify chan struct{}
+}
+
+func newChangeFeed(capacity int) *changeFeed {
+	return &changeFeed{
+		epoch:  uuid.New().String(),
+		events: make([]*pb.LaptopEvent, capacity),
+		next:   1,
+		notify: make(chan struct{}),
+	}
+}
+
+// first returns the sequence number of the oldest event kept
+func (feed *changeFeed) first() uint64 {
+	if feed.next <= uint64(len(feed.events)) {
+		return 1
+	}
+	return feed.next - uint64(len(feed.events))
+}
+
+// Publish appends an event for laptop, it must be called in the order of the changes.
+// laptop must not be modified afterwards
+func (feed *changeFeed) Publish(eventType pb.LaptopEvent_Type, laptop *pb.Laptop) {
+	feed.publish(&pb.LaptopEvent{Type: eventType, Laptop: laptop})
+}
+
+// PublishUpdate appends an UPDATED event with the laptop before and after the change,
+// neither must be modified afterwards
+func (feed *changeFeed) PublishUpdate(previous *pb.Laptop, updated *pb.Laptop) {
+	feed.publish(&pb.LaptopEvent{Type: pb.LaptopEvent_UPDATED, Laptop: updated, Previous: previous})
+}
+
+func (feed *changeFeed) publish(event *pb.LaptopEvent) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	event.ResumeToken = fmt.Sprintf("%s/%d", feed.epoch, feed.next)
+	event.Time = timestamppb.Now()
+	//覆盖最旧的事件
+	feed.events[feed.next%uint64(len(feed.events))] = event
+	feed.next++
+
+	close(feed.notify)
+	feed.notify = make(chan struct{})
+}
+
+// Watch calls found for each event published after resumeToken until ctx is done.
+// an empty resumeToken only follows the new events, a token of another feed has expired
+func (feed *changeFeed) Watch(ctx context.Context, resumeToken string, found func(event *pb.LaptopEvent) error) error {
+	feed.mutex.Lock()
+	next := feed.next
+	feed.mutex.Unlock()
+
+	if resumeToken != "" {
+		epoch, sequenceText, ok := strings.Cut(resumeToken, "/")
+		sequence, err := strconv.ParseUint(sequenceText, 10, 64)
+		if !ok || err != nil {
+			return ErrInvalidResumeToken
+		}
+		if epoch != feed.epoch {
+			return ErrResumeTokenExpired
+		}
+		if sequence >= next {
+			return ErrInvalidResumeToken
+		}
+		next = sequence + 1
+	}
+
+	for {
+		feed.mutex.Lock()
+		if next < feed.first() {
+			feed.mutex.Unlock()
+			return ErrResumeTokenExpired
+		}
+		//publish会覆盖缓冲区,所以在锁内复制新事件
+		events := make([]*pb.LaptopEvent, 0, feed.next-next)
+		for sequence := next; sequence < feed.next; sequence++ {
+			events = append(events, feed.events[sequence%uint64(len(feed.events))])
+		}
+		notify := feed.notify
+		feed.mutex.Unlock()
+
+		for _, event := range events {
+			other, err := deepCopyEvent(event)
+			if err != nil {
+				return err
+			}
+			err = found(other)
+			if err != nil {
+				return err
+			}
+			next++
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+func deepCopyEvent(event *pb.LaptopEvent) (*pb.LaptopEvent, error) {
+	laptop, err := deepCopy(event.GetLaptop())
+	if err != nil {
+		return nil, err
+	}
+	other := &pb.LaptopEvent{
+		Type:        event.GetType(),
+		Laptop:      laptop,
+		ResumeToken: event.GetResumeToken(),
+		Time:        event.GetTime(),
+	}
+	if event.GetPrevious() != nil {
+		other.Previous, err = deepCopy(event.GetPrevious())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return other, nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"proto_demo/pb"
+	"strings"
+)
+
+const kgPerLb = 0.45359237
+
+// isQualified reports whether laptop matches every condition of filter,
+// conditions with a zero value are ignored except max_price_usd, which is ignored only when unset
+func isQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
+	price := laptop.GetPriceUsd()
+	if maxPrice, ok := maxPriceUsd(filter); ok && price > maxPrice {
+		return false
+	}
+	if price < filter.GetMinPriceUsd() {
+		return false
+	}
+	if laptop.GetCpu().GetNumberCores() < filter.GetMinCpuCores() {
+		return false
+	}
+	if laptop.GetCpu().GetMinGhz() < filter.GetMinCpuGhz() {
+		return false
+	}
+	if toBit(laptop.GetRam()) < toBit(filter.GetMinRam()) {
+		return false
+	}
+	if !containsFold(filter.GetBrands(), laptop.GetBrand()) || !containsFold(filter.GetNames(), laptop.GetName()) {
+		return false
+	}
+	if !hasQualifiedGPU(filter, laptop.GetGpus()) {
+		return false
+	}
+	if toBit(filter.GetMinSsd()) > 0 && totalStorage(laptop.GetStorages(), pb.Storage_SSD) < toBit(filter.GetMinSsd()) {
+		return false
+	}
+	return isQualifiedScreen(filter, laptop.GetScreen()) &&
+		isQualifiedKeyboard(filter, laptop.GetKeyboard()) &&
+		isQualifiedWeight(filter, laptop) &&
+		isQualifiedReleaseYear(filter, laptop.GetReleaseYear())
+}
+
+// maxPriceUsd returns the max_price_usd of filter, ok is false if it is unset
+func maxPriceUsd(filter *pb.Filter) (maxPrice float64, ok bool) {
+	if filter == nil || filter.MaxPriceUsd == nil {
+		return 0, false
+	}
+	return *filter.MaxPriceUsd, true
+}
+
+// containsFold reports whether value is in values ignoring case, an empty set contains every value
+func containsFold(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasQualifiedGPU(filter *pb.Filter, gpus []*pb.GPU) bool {
+	if len(filter.GetGpuBrands()) == 0 && toBit(filter.GetMinGpuMemory()) == 0 {
+		return true
+	}
+	for _, gpu := range gpus {
+		if containsFold(filter.GetGpuBrands(), gpu.GetBrand()) && toBit(gpu.GetMemory()) >= toBit(filter.GetMinGpuMemory()) {
+			return true
+		}
+	}
+	return false
+}
+
+// totalStorage returns the capacity in bits of all storages with the driver
+func totalStorage(storages []*pb.Storage, driver pb.Storage_Driver) uint64 {
+	total := uint64(0)
+	for _, storage := range storages {
+		if storage.GetDriver() == driver {
+			total += toBit(storage.GetMemory())
+		}
+	}
+	return total
+}
+
+func isQualifiedScreen(filter *pb.Filter, screen *pb.Screen) bool {
+	if screen.GetSizeInch() < filter.GetMinScreenSizeInch() {
+		return false
+	}
+	if filter.GetMaxScreenSizeInch() > 0 && screen.GetSizeInch() > filter.GetMaxScreenSizeInch() {
+		return false
+	}
+	if screen.GetResolution().GetWidth() < filter.GetMinResolution().GetWidth() ||
+		screen.GetResolution().GetHeight() < filter.GetMinResolution().GetHeight() {
+		return false
+	}
+	if len(filter.GetPanels()) == 0 {
+		return true
+	}
+	for _, panel := range filter.GetPanels() {
+		if panel == screen.GetPanel() {
+			return true
+		}
+	}
+	return false
+}
+
+func isQualifiedKeyboard(filter *pb.Filter, keyboard *pb.Keyboard) bool {
+	if filter != nil && filter.KeyboardBacklit != nil && filter.GetKeyboardBacklit() != keyboard.GetBacklit() {
+		return false
+	}
+	if len(filter.GetKeyboardLayouts()) == 0 {
+		return true
+	}
+	for _, layout := range filter.GetKeyboardLayouts() {
+		if layout == keyboard.GetLayout() {
+			return true
+		}
+	}
+	return false
+}
+
+func isQualifiedWeight(filter *pb.Filter, laptop *pb.Laptop) bool {
+	if filter.GetMinWeightKg() == 0 && filter.GetMaxWeightKg() == 0 {
+		return true
+	}
+	weight, ok := weightKg(laptop)
+	if !ok {
+		return false
+	}
+	if weight < filter.GetMinWeightKg() {
+		return false
+	}
+	return filter.GetMaxWeightKg() == 0 || weight <= filter.GetMaxWeightKg()
+}
+
+// weightKg returns the weight of laptop in kilograms, ok is false if the weight is unknown
+func weightKg(laptop *pb.Laptop) (weight float64, ok bool) {
+	switch w := laptop.GetWeight().(type) {
+	case *pb.Laptop_WeightKg:
+		return w.WeightKg, true
+	case *pb.Laptop_WeightLb:
+		return w.WeightLb * kgPerLb, true
+	default:
+		return 0, false
+	}
+}
+
+func isQualifiedReleaseYear(filter *pb.Filter, year uint32) bool {
+	if year < filter.GetMinReleaseYear() {
+		return false
+	}
+	return filter.GetMaxReleaseYear() == 0 || year <= filter.GetMaxReleaseYear()
+}
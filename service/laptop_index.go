@@ -0,0 +1,226 @@
+package service
+
+import (
+	"math"
+	"math/rand"
+	"proto_demo/pb"
+	"sort"
+)
+
+type indexEntry struct {
+	value float64
+	id    string
+}
+
+func (entry indexEntry) less(other indexEntry) bool {
+	return entry.value < other.value || (entry.value == other.value && entry.id < other.id)
+}
+
+// maxSkipLevel is enough for 4^16 entries with a level probability of 1/4
+const maxSkipLevel = 16
+
+type skipNode struct {
+	entry indexEntry
+	next  []*skipNode
+}
+
+// numericIndex keeps laptop IDs sorted by a numeric value in a skip list,
+// so adding and removing a laptop is logarithmic
+type numericIndex struct {
+	value  func(laptop *pb.Laptop) float64
+	head   *skipNode
+	level  int
+	random *rand.Rand
+}
+
+func newNumericIndex(value func(laptop *pb.Laptop) float64) *numericIndex {
+	return &numericIndex{
+		value:  value,
+		head:   &skipNode{next: make([]*skipNode, maxSkipLevel)},
+		level:  1,
+		random: rand.New(rand.NewSource(1)),
+	}
+}
+
+// predecessors returns the last node before entry on every level
+func (index *numericIndex) predecessors(entry indexEntry) [maxSkipLevel]*skipNode {
+	var update [maxSkipLevel]*skipNode
+	node := index.head
+	for level := index.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].entry.less(entry) {
+			node = node.next[level]
+		}
+		update[level] = node
+	}
+	return update
+}
+
+func (index *numericIndex) Add(laptop *pb.Laptop) {
+	entry := indexEntry{index.value(laptop), laptop.GetId()}
+	update := index.predecessors(entry)
+	if next := update[0].next[0]; next != nil && next.entry == entry {
+		return
+	}
+
+	level := 1
+	for level < maxSkipLevel && index.random.Intn(4) == 0 {
+		level++
+	}
+	for ; index.level < level; index.level++ {
+		update[index.level] = index.head
+	}
+	node := &skipNode{entry: entry, next: make([]*skipNode, level)}
+	for i := range node.next {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+}
+
+func (index *numericIndex) Remove(laptop *pb.Laptop) {
+	entry := indexEntry{index.value(laptop), laptop.GetId()}
+	update := index.predecessors(entry)
+	node := update[0].next[0]
+	if node == nil || node.entry != entry {
+		return
+	}
+	for i := range node.next {
+		update[i].next[i] = node.next[i]
+	}
+	for index.level > 1 && index.head.next[index.level-1] == nil {
+		index.level--
+	}
+}
+
+// Range returns the IDs of the entries with a value between low and high included, sorted by value
+func (index *numericIndex) Range(low float64, high float64) []string {
+	node := index.head
+	for level := index.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].entry.value < low {
+			node = node.next[level]
+		}
+	}
+	ids := []string{}
+	for node = node.next[0]; node != nil && node.entry.value <= high; node = node.next[0] {
+		ids = append(ids, node.entry.id)
+	}
+	return ids
+}
+
+// numericField is an indexed numeric field of laptops
+type numericField struct {
+	name  string
+	value func(laptop *pb.Laptop) float64
+	// bounds returns the values accepted by filter, ok is false if filter has no condition on the field
+	bounds func(filter *pb.Filter) (low float64, high float64, ok bool)
+}
+
+// numericFields are the fields used to select the candidates of a filter
+var numericFields = []numericField{
+	{
+		name: "price",
+		value: func(laptop *pb.Laptop) float64 {
+			return laptop.GetPriceUsd()
+		},
+		bounds: func(filter *pb.Filter) (float64, float64, bool) {
+			high, ok := maxPriceUsd(filter)
+			if !ok {
+				high = math.Inf(1)
+			}
+			return filter.GetMinPriceUsd(), high, ok || filter.GetMinPriceUsd() > 0
+		},
+	},
+	{
+		name: "cpu_cores",
+		value: func(laptop *pb.Laptop) float64 {
+			return float64(laptop.GetCpu().GetNumberCores())
+		},
+		bounds: func(filter *pb.Filter) (float64, float64, bool) {
+			return float64(filter.GetMinCpuCores()), math.Inf(1), filter.GetMinCpuCores() > 0
+		},
+	},
+	{
+		name: "cpu_ghz",
+		value: func(laptop *pb.Laptop) float64 {
+			return laptop.GetCpu().GetMinGhz()
+		},
+		bounds: func(filter *pb.Filter) (float64, float64, bool) {
+			return filter.GetMinCpuGhz(), math.Inf(1), filter.GetMinCpuGhz() > 0
+		},
+	},
+	{
+		name: "ram",
+		value: func(laptop *pb.Laptop) float64 {
+			return float64(toBit(laptop.GetRam()))
+		},
+		bounds: func(filter *pb.Filter) (float64, float64, bool) {
+			minRam := float64(toBit(filter.GetMinRam()))
+			return minRam, math.Inf(1), minRam > 0
+		},
+	},
+}
+
+// laptopIndex holds the secondary indexes of a laptop store
+type laptopIndex struct {
+	// numeric holds an index for each of numericFields
+	numeric []*numericIndex
+	text    *textIndex
+}
+
+func newLaptopIndex() *laptopIndex {
+	index := &laptopIndex{text: newTextIndex()}
+	for _, field := range numericFields {
+		index.numeric = append(index.numeric, newNumericIndex(field.value))
+	}
+	return index
+}
+
+func (index *laptopIndex) Add(laptop *pb.Laptop) {
+	for _, numeric := range index.numeric {
+		numeric.Add(laptop)
+	}
+	index.text.Add(laptop)
+}
+
+func (index *laptopIndex) Remove(laptop *pb.Laptop) {
+	for _, numeric := range index.numeric {
+		numeric.Remove(laptop)
+	}
+	index.text.Remove(laptop)
+}
+
+// Candidates returns the IDs of the laptops that may match the numeric conditions of filter.
+// the ranges of all indexed conditions are intersected, the other conditions must still be checked.
+// ok is false if filter has no indexed condition
+func (index *laptopIndex) Candidates(filter *pb.Filter) (ids []string, ok bool) {
+	ranges := [][]string{}
+	for i, field := range numericFields {
+		low, high, ok := field.bounds(filter)
+		if ok {
+			ranges = append(ranges, index.numeric[i].Range(low, high))
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, false
+	}
+
+	//从最小的范围开始求交集
+	sort.Slice(ranges, func(i, j int) bool { return len(ranges[i]) < len(ranges[j]) })
+	ids = ranges[0]
+	for _, r := range ranges[1:] {
+		if len(ids) == 0 {
+			break
+		}
+		inRange := make(map[string]bool, len(r))
+		for _, id := range r {
+			inRange[id] = true
+		}
+		kept := ids[:0]
+		for _, id := range ids {
+			if inRange[id] {
+				kept = append(kept, id)
+			}
+		}
+		ids = kept
+	}
+	return ids, true
+}
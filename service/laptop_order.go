@@ -0,0 +1,176 @@
+package service
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"proto_demo/pb"
+	"sort"
+	"strings"
+)
+
+// LaptopOrder sorts laptops by a field, ties are broken by the laptop ID
+type LaptopOrder struct {
+	Field      pb.SortField
+	Descending bool
+	// Rating returns the average score of a laptop, it's used to sort by AVERAGE_RATING
+	Rating func(laptopID string) float64
+	// Relevance returns the text search score of a laptop, it's used to sort by RELEVANCE
+	Relevance func(laptopID string) float64
+}
+
+// LaptopCursor is the position of a laptop in a LaptopOrder
+type LaptopCursor struct {
+	Value float64 `json:"v"`
+	Nanos int32   `json:"n,omitempty"`
+	ID    string  `json:"i"`
+}
+
+// Cursor returns the position of laptop in the order
+func (order LaptopOrder) Cursor(laptop *pb.Laptop) *LaptopCursor {
+	cursor := &LaptopCursor{ID: laptop.GetId()}
+	switch order.Field {
+	case pb.SortField_PRICE:
+		cursor.Value = laptop.GetPriceUsd()
+	case pb.SortField_RELEASE_YEAR:
+		cursor.Value = float64(laptop.GetReleaseYear())
+	case pb.SortField_UPDATE_AT:
+		cursor.Value = float64(laptop.GetUpdateAt().GetSeconds())
+		cursor.Nanos = laptop.GetUpdateAt().GetNanos()
+	case pb.SortField_AVERAGE_RATING:
+		if order.Rating != nil {
+			cursor.Value = order.Rating(laptop.GetId())
+		}
+	case pb.SortField_RELEVANCE:
+		if order.Relevance != nil {
+			cursor.Value = order.Relevance(laptop.GetId())
+		}
+	}
+	return cursor
+}
+
+// Less reports whether the laptop at cursor a comes before the one at cursor b
+func (order LaptopOrder) Less(a *LaptopCursor, b *LaptopCursor) bool {
+	if order.Descending {
+		return compareCursors(a, b) > 0
+	}
+	return compareCursors(a, b) < 0
+}
+
+func compareCursors(a *LaptopCursor, b *LaptopCursor) int {
+	switch {
+	case a.Value < b.Value:
+		return -1
+	case a.Value > b.Value:
+		return 1
+	case a.Nanos < b.Nanos:
+		return -1
+	case a.Nanos > b.Nanos:
+		return 1
+	default:
+		return strings.Compare(a.ID, b.ID)
+	}
+}
+
+type pageToken struct {
+	Field      pb.SortField  `json:"f"`
+	Descending bool          `json:"d"`
+	After      *LaptopCursor `json:"a"`
+}
+
+// EncodePageToken returns an opaque token to continue listing after cursor
+func EncodePageToken(order LaptopOrder, cursor *LaptopCursor) (string, error) {
+	data, err := json.Marshal(pageToken{
+		Field:      order.Field,
+		Descending: order.Descending,
+		After:      cursor,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot encode page token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodePageToken returns the cursor of a token, the token must be created for the same order
+func DecodePageToken(order LaptopOrder, token string) (*LaptopCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode page token: %w", err)
+	}
+	other := pageToken{}
+	err = json.Unmarshal(data, &other)
+	if err != nil || other.After == nil {
+		return nil, fmt.Errorf("page token is malformed")
+	}
+	if other.Field != order.Field || other.Descending != order.Descending {
+		return nil, fmt.Errorf("page token was created for another order")
+	}
+	return other.After, nil
+}
+
+type orderedLaptop struct {
+	laptop *pb.Laptop
+	cursor *LaptopCursor
+}
+
+// laptopSelector keeps the first limit laptops of an order, or every laptop if limit is 0.
+// with a limit it's a max-heap so the last selected laptop can be replaced in O(log limit)
+type laptopSelector struct {
+	order LaptopOrder
+	limit int
+	items []orderedLaptop
+}
+
+func newLaptopSelector(order LaptopOrder, limit int) *laptopSelector {
+	return &laptopSelector{order: order, limit: limit}
+}
+
+func (selector *laptopSelector) Len() int { return len(selector.items) }
+func (selector *laptopSelector) Less(i, j int) bool {
+	return selector.order.Less(selector.items[j].cursor, selector.items[i].cursor)
+}
+func (selector *laptopSelector) Swap(i, j int) {
+	selector.items[i], selector.items[j] = selector.items[j], selector.items[i]
+}
+func (selector *laptopSelector) Push(x interface{}) {
+	selector.items = append(selector.items, x.(orderedLaptop))
+}
+func (selector *laptopSelector) Pop() interface{} {
+	n := len(selector.items)
+	item := selector.items[n-1]
+	selector.items = selector.items[:n-1]
+	return item
+}
+
+// Add selects laptop if it's among the first limit laptops seen so far
+func (selector *laptopSelector) Add(laptop *pb.Laptop) {
+	item := orderedLaptop{laptop, selector.order.Cursor(laptop)}
+	if selector.limit <= 0 {
+		selector.items = append(selector.items, item)
+		return
+	}
+	if len(selector.items) < selector.limit {
+		heap.Push(selector, item)
+		return
+	}
+	if selector.order.Less(item.cursor, selector.items[0].cursor) {
+		selector.items[0] = item
+		heap.Fix(selector, 0)
+	}
+}
+
+// Laptops returns the selected laptops in order
+func (selector *laptopSelector) Laptops() []*pb.Laptop {
+	sort.Slice(selector.items, func(i, j int) bool {
+		return selector.order.Less(selector.items[i].cursor, selector.items[j].cursor)
+	})
+	laptops := make([]*pb.Laptop, len(selector.items))
+	for i, item := range selector.items {
+		laptops[i] = item.laptop
+	}
+	return laptops
+}
@@ -0,0 +1,499 @@
+package service
+
+import (
+	"fmt"
+	"proto_demo/pb"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Predicate is a condition on a laptop parsed from a search query
+type Predicate interface {
+	Match(laptop *pb.Laptop) bool
+}
+
+// QueryError reports the token of a search query that can't be parsed
+type QueryError struct {
+	Pos   int
+	Token string
+	Msg   string
+}
+
+func (err *QueryError) Error() string {
+	if err.Token == "" {
+		return fmt.Sprintf("%s at end of query", err.Msg)
+	}
+	return fmt.Sprintf("%s at position %d near %q", err.Msg, err.Pos, err.Token)
+}
+
+// ParseQuery parses a query like `brand:Dell price<2000 ram>=16GB (panel:OLED OR panel:IPS)`.
+// terms are joined by AND unless OR is used, NOT or a leading '-' negates a term.
+// an empty query returns a nil predicate
+func ParseQuery(query string) (Predicate, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	parser := &queryParser{tokens: tokens}
+	if parser.peek().kind == tokenEOF {
+		return nil, nil
+	}
+	predicate, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != tokenEOF {
+		return nil, token.errorf("unexpected token")
+	}
+	return predicate, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenNot
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (token queryToken) errorf(format string, args ...interface{}) *QueryError {
+	return &QueryError{Pos: token.pos, Token: token.text, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-+*", r)
+}
+
+func lexQuery(query string) ([]queryToken, error) {
+	runes := []rune(query)
+	tokens := []queryToken{}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		//比较运算符后的-和数字是负数,其他的-是NOT
+		negative := r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]) &&
+			len(tokens) > 0 && tokens[len(tokens)-1].kind == tokenOperator
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenLeftParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenRightParen, text: ")", pos: i})
+			i++
+		case r == '-' && !negative:
+			tokens = append(tokens, queryToken{kind: tokenNot, text: "-", pos: i})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &QueryError{Pos: i, Token: string(runes[i:]), Msg: "unterminated string"}
+			}
+			tokens = append(tokens, queryToken{kind: tokenString, text: string(runes[i+1 : end]), pos: i})
+			i = end + 1
+		case strings.ContainsRune(":=!<>", r):
+			end := i + 1
+			if end < len(runes) && runes[end] == '=' && r != ':' && r != '=' {
+				end++
+			}
+			text := string(runes[i:end])
+			if text == "!" {
+				return nil, &QueryError{Pos: i, Token: text, Msg: "unknown operator"}
+			}
+			tokens = append(tokens, queryToken{kind: tokenOperator, text: text, pos: i})
+			i = end
+		case isWordRune(r):
+			end := i
+			for end < len(runes) && isWordRune(runes[end]) {
+				end++
+			}
+			text := string(runes[i:end])
+			kind := tokenWord
+			if text == "NOT" {
+				kind = tokenNot
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: text, pos: i})
+			i = end
+		default:
+			return nil, &QueryError{Pos: i, Token: string(r), Msg: "unexpected character"}
+		}
+	}
+	return append(tokens, queryToken{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	next   int
+}
+
+func (parser *queryParser) peek() queryToken {
+	return parser.tokens[parser.next]
+}
+
+func (parser *queryParser) pop() queryToken {
+	token := parser.tokens[parser.next]
+	if token.kind != tokenEOF {
+		parser.next++
+	}
+	return token
+}
+
+func (parser *queryParser) parseOr() (Predicate, error) {
+	predicate, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := orPredicate{predicate}
+	for parser.peek().kind == tokenWord && parser.peek().text == "OR" {
+		parser.pop()
+		predicate, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, predicate)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (parser *queryParser) parseAnd() (Predicate, error) {
+	predicate, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	and := andPredicate{predicate}
+	for {
+		token := parser.peek()
+		if token.kind == tokenEOF || token.kind == tokenRightParen || (token.kind == tokenWord && token.text == "OR") {
+			break
+		}
+		if token.kind == tokenWord && token.text == "AND" {
+			parser.pop()
+		}
+		predicate, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, predicate)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (parser *queryParser) parseUnary() (Predicate, error) {
+	if parser.peek().kind == tokenNot {
+		parser.pop()
+		predicate, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notPredicate{predicate}, nil
+	}
+	return parser.parsePrimary()
+}
+
+func (parser *queryParser) parsePrimary() (Predicate, error) {
+	token := parser.pop()
+	switch token.kind {
+	case tokenLeftParen:
+		predicate, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := parser.pop(); closing.kind != tokenRightParen {
+			return nil, closing.errorf("expected )")
+		}
+		return predicate, nil
+	case tokenWord:
+		return parser.parseTerm(token)
+	default:
+		return nil, token.errorf("expected a field or (")
+	}
+}
+
+func (parser *queryParser) parseTerm(name queryToken) (Predicate, error) {
+	field, ok := queryFields[strings.ToLower(name.text)]
+	if !ok {
+		return nil, name.errorf("unknown field")
+	}
+	op := parser.pop()
+	if op.kind != tokenOperator {
+		return nil, op.errorf("expected an operator after %s", name.text)
+	}
+	if op.text == ":" {
+		op.text = "="
+	}
+	if field.kind == textField || field.kind == enumField || field.kind == boolField {
+		if op.text != "=" && op.text != "!=" {
+			return nil, op.errorf("field %s only supports : = !=", name.text)
+		}
+	}
+	value := parser.pop()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, value.errorf("expected a value for %s", name.text)
+	}
+
+	term := &comparison{field: field, op: op.text}
+	switch field.kind {
+	case textField:
+		term.text = strings.ToLower(value.text)
+	case numberField:
+		number, err := strconv.ParseFloat(value.text, 64)
+		if err != nil {
+			return nil, value.errorf("invalid number")
+		}
+		term.number = number
+	case memoryField:
+		bits, err := parseMemory(value.text)
+		if err != nil {
+			return nil, value.errorf("invalid memory size")
+		}
+		term.number = float64(bits)
+	case enumField:
+		number, ok := field.enum[strings.ToUpper(value.text)]
+		if !ok {
+			return nil, value.errorf("unknown %s value", name.text)
+		}
+		term.number = float64(number)
+	case boolField:
+		b, err := strconv.ParseBool(value.text)
+		if err != nil {
+			return nil, value.errorf("invalid boolean")
+		}
+		if b {
+			term.number = 1
+		}
+	}
+	return term, nil
+}
+
+// parseMemory parses a size like 16GB or 512mb into bits, a size without unit is in gigabytes
+func parseMemory(text string) (uint64, error) {
+	units := []struct {
+		suffix string
+		unit   pb.Memory_Unit
+	}{
+		{"TB", pb.Memory_TERABYTE},
+		{"GB", pb.Memory_GIGABYTE},
+		{"MB", pb.Memory_MEGABYTE},
+		{"KB", pb.Memory_KILOBYTE},
+		{"B", pb.Memory_BYTE},
+	}
+	upper := strings.ToUpper(text)
+	unit := pb.Memory_GIGABYTE
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper = strings.TrimSuffix(upper, u.suffix)
+			unit = u.unit
+			break
+		}
+	}
+	value, err := strconv.ParseUint(upper, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return toBit(&pb.Memory{Value: value, Unit: unit}), nil
+}
+
+type andPredicate []Predicate
+type orPredicate []Predicate
+type notPredicate struct{ Predicate }
+
+func (and andPredicate) Match(laptop *pb.Laptop) bool {
+	for _, predicate := range and {
+		if !predicate.Match(laptop) {
+			return false
+		}
+	}
+	return true
+}
+
+func (or orPredicate) Match(laptop *pb.Laptop) bool {
+	for _, predicate := range or {
+		if predicate.Match(laptop) {
+			return true
+		}
+	}
+	return false
+}
+
+func (not notPredicate) Match(laptop *pb.Laptop) bool {
+	return !not.Predicate.Match(laptop)
+}
+
+type fieldKind int
+
+const (
+	textField fieldKind = iota
+	numberField
+	memoryField
+	enumField
+	boolField
+)
+
+// queryField reads a value of a laptop, text fields can have several values like the GPU brands
+type queryField struct {
+	kind   fieldKind
+	text   func(laptop *pb.Laptop) []string
+	number func(laptop *pb.Laptop) (float64, bool)
+	enum   map[string]int32
+}
+
+type comparison struct {
+	field  *queryField
+	op     string
+	text   string
+	number float64
+}
+
+func (term *comparison) Match(laptop *pb.Laptop) bool {
+	if term.field.kind == textField {
+		matched := false
+		for _, value := range term.field.text(laptop) {
+			if matchText(term.text, strings.ToLower(value)) {
+				matched = true
+				break
+			}
+		}
+		return matched == (term.op == "=")
+	}
+
+	value, ok := term.field.number(laptop)
+	if !ok {
+		return false
+	}
+	switch term.op {
+	case "=":
+		return value == term.number
+	case "!=":
+		return value != term.number
+	case "<":
+		return value < term.number
+	case "<=":
+		return value <= term.number
+	case ">":
+		return value > term.number
+	default:
+		return value >= term.number
+	}
+}
+
+// matchText compares a lower case value with a pattern, a trailing * matches any suffix
+func matchText(pattern string, value string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == value
+}
+
+func textOf(get func(laptop *pb.Laptop) string) *queryField {
+	return &queryField{kind: textField, text: func(laptop *pb.Laptop) []string {
+		return []string{get(laptop)}
+	}}
+}
+
+func numberOf(get func(laptop *pb.Laptop) float64) *queryField {
+	return &queryField{kind: numberField, number: func(laptop *pb.Laptop) (float64, bool) {
+		return get(laptop), true
+	}}
+}
+
+func memoryOf(get func(laptop *pb.Laptop) uint64) *queryField {
+	return &queryField{kind: memoryField, number: func(laptop *pb.Laptop) (float64, bool) {
+		return float64(get(laptop)), true
+	}}
+}
+
+func boolOf(get func(laptop *pb.Laptop) bool) *queryField {
+	return &queryField{kind: boolField, number: func(laptop *pb.Laptop) (float64, bool) {
+		if get(laptop) {
+			return 1, true
+		}
+		return 0, true
+	}}
+}
+
+func gpuTexts(get func(gpu *pb.GPU) string) *queryField {
+	return &queryField{kind: textField, text: func(laptop *pb.Laptop) []string {
+		values := make([]string, len(laptop.GetGpus()))
+		for i, gpu := range laptop.GetGpus() {
+			values[i] = get(gpu)
+		}
+		return values
+	}}
+}
+
+// queryFields are the fields that can be used in a query
+var queryFields = map[string]*queryField{
+	"brand":     textOf(func(laptop *pb.Laptop) string { return laptop.GetBrand() }),
+	"name":      textOf(func(laptop *pb.Laptop) string { return laptop.GetName() }),
+	"cpu.brand": textOf(func(laptop *pb.Laptop) string { return laptop.GetCpu().GetBrand() }),
+	"cpu.name":  textOf(func(laptop *pb.Laptop) string { return laptop.GetCpu().GetName() }),
+	"gpu.brand": gpuTexts(func(gpu *pb.GPU) string { return gpu.GetBrand() }),
+	"gpu.name":  gpuTexts(func(gpu *pb.GPU) string { return gpu.GetName() }),
+	"price":     numberOf(func(laptop *pb.Laptop) float64 { return laptop.GetPriceUsd() }),
+	"year":      numberOf(func(laptop *pb.Laptop) float64 { return float64(laptop.GetReleaseYear()) }),
+	"cpu.cores": numberOf(func(laptop *pb.Laptop) float64 { return float64(laptop.GetCpu().GetNumberCores()) }),
+	"cpu.threads": numberOf(func(laptop *pb.Laptop) float64 {
+		return float64(laptop.GetCpu().GetNumberThreads())
+	}),
+	"cpu.ghz":     numberOf(func(laptop *pb.Laptop) float64 { return laptop.GetCpu().GetMinGhz() }),
+	"cpu.max_ghz": numberOf(func(laptop *pb.Laptop) float64 { return laptop.GetCpu().GetMaxGhz() }),
+	"screen":      numberOf(func(laptop *pb.Laptop) float64 { return float64(laptop.GetScreen().GetSizeInch()) }),
+	"weight": {kind: numberField, number: func(laptop *pb.Laptop) (float64, bool) {
+		return weightKg(laptop)
+	}},
+	"ram": memoryOf(func(laptop *pb.Laptop) uint64 { return toBit(laptop.GetRam()) }),
+	"ssd": memoryOf(func(laptop *pb.Laptop) uint64 { return totalStorage(laptop.GetStorages(), pb.Storage_SSD) }),
+	"hdd": memoryOf(func(laptop *pb.Laptop) uint64 { return totalStorage(laptop.GetStorages(), pb.Storage_HDD) }),
+	"gpu.memory": memoryOf(func(laptop *pb.Laptop) uint64 {
+		largest := uint64(0)
+		for _, gpu := range laptop.GetGpus() {
+			if toBit(gpu.GetMemory()) > largest {
+				largest = toBit(gpu.GetMemory())
+			}
+		}
+		return largest
+	}),
+	"panel": {kind: enumField, enum: pb.Screen_Panel_value, number: func(laptop *pb.Laptop) (float64, bool) {
+		return float64(laptop.GetScreen().GetPanel()), true
+	}},
+	"layout": {kind: enumField, enum: pb.Keyboard_Layout_value, number: func(laptop *pb.Laptop) (float64, bool) {
+		return float64(laptop.GetKeyboard().GetLayout()), true
+	}},
+	"backlit":    boolOf(func(laptop *pb.Laptop) bool { return laptop.GetKeyboard().GetBacklit() }),
+	"multitouch": boolOf(func(laptop *pb.Laptop) bool { return laptop.GetScreen().GetMultitouch() }),
+}
+
+func init() {
+	aliases := map[string]string{
+		"price_usd":        "price",
+		"cpu.min_ghz":      "cpu.ghz",
+		"release_year":     "year",
+		"screen.size":      "screen",
+		"screen.panel":     "panel",
+		"keyboard.layout":  "layout",
+		"keyboard.backlit": "backlit",
+	}
+	for alias, name := range aliases {
+		queryFields[alias] = queryFields[name]
+	}
+}
@@ -0,0 +1,87 @@
+package service_test
+
+import (
+	"errors"
+	"proto_demo/pb"
+	"proto_demo/service"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuery(t *testing.T) {
+	t.Parallel()
+
+	laptop := &pb.Laptop{
+		Brand:    "Dell",
+		Name:     "XPS 15",
+		Cpu:      &pb.CPU{Brand: "Intel", NumberCores: 8, MinGhz: 2.4},
+		Ram:      &pb.Memory{Value: 32, Unit: pb.Memory_GIGABYTE},
+		Gpus:     []*pb.GPU{{Brand: "NVIDIA", Name: "RTX 2060"}},
+		Screen:   &pb.Screen{SizeInch: 15.6, Panel: pb.Screen_OLED},
+		Keyboard: &pb.Keyboard{Layout: pb.Keyboard_QWERTY, Backlit: true},
+		PriceUsd: 1899,
+	}
+
+	testCases := []struct {
+		query   string
+		matched bool
+	}{
+		{"brand:Dell price<2000 ram>=16GB cpu.cores>=6 (panel:OLED OR panel:IPS)", true},
+		{"brand:dell AND price<=1899", true},
+		{"brand:Lenovo OR brand:Dell", true},
+		{"-brand:Dell", false},
+		{"NOT (brand:Apple OR brand:Lenovo)", true},
+		{`name:"xps 15"`, true},
+		{"name:xps*", true},
+		{"gpu.name:rtx*", true},
+		{"gpu.brand!=NVIDIA", false},
+		{"ram>32768MB", false},
+		{"ram:32", true},
+		{"panel:IPS", false},
+		{"backlit:true layout:qwerty", true},
+		{"cpu.ghz>2.5", false},
+		{"price_usd > -1", true},
+		{"cpu.min_ghz >= -0.5", true},
+		{"price<-1", false},
+		{"-price>-1", false},
+	}
+	for _, tc := range testCases {
+		predicate, err := service.ParseQuery(tc.query)
+		require.NoError(t, err, tc.query)
+		require.Equal(t, tc.matched, predicate.Match(laptop), tc.query)
+	}
+
+	predicate, err := service.ParseQuery("  ")
+	require.NoError(t, err)
+	require.Nil(t, predicate)
+}
+
+func TestParseQueryError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		query string
+		pos   int
+		token string
+	}{
+		{"brand:Dell color:red", 11, "color"},
+		{"price<cheap", 6, "cheap"},
+		{"brand>Dell", 5, ">"},
+		{"ram>=16XB", 5, "16XB"},
+		{"(brand:Dell", 11, ""},
+		{"brand:Dell)", 10, ")"},
+		{"panel:TN", 6, "TN"},
+		{"price", 5, ""},
+		{"price<2000 #", 11, "#"},
+		{`name:"xps`, 5, `"xps`},
+	}
+	for _, tc := range testCases {
+		_, err := service.ParseQuery(tc.query)
+		require.Error(t, err, tc.query)
+		queryErr := &service.QueryError{}
+		require.True(t, errors.As(err, &queryErr), tc.query)
+		require.Equal(t, tc.pos, queryErr.Pos, tc.query)
+		require.Equal(t, tc.token, queryErr.Token, tc.query)
+	}
+}
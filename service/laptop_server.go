@@ -1,28 +1,82 @@
 package service
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"proto_demo/pb"
+	"sort"
 
 	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
-const maxImageSize = 1 << 20
+// DefaultMaxImageSize is the default limit of the images uploaded to a LaptopServer
+const DefaultMaxImageSize = 512 << 20
+
+const imageChunkSize = 64 << 10
+const maxBatchSize = 100
+const defaultPageSize = 20
+const maxPageSize = 100
+const importBatchSize = 100
+const maxImportSize = 10000
 
 type LaptopServer struct {
-	laptopStore LaptopStore
-	imageStore  ImageStore
-	ratingStore RatingStore
+	laptopStore      LaptopStore
+	imageStore       ImageStore
+	ratingStore      RatingStore
+	idempotencyStore *IdempotencyStore
+	uploads          *uploadSessions
+	// MaxImageSize is the largest image accepted by UploadImage
+	MaxImageSize int64
 }
 
-func NewLaptopService(laptopstore LaptopStore, imagestore ImageStore, ratingstore RatingStore) *LaptopServer {
-	return &LaptopServer{laptopstore, imagestore, ratingstore}
+// NewLaptopService creates a laptop server, the idempotency keys are ignored if idempotencystore is nil
+func NewLaptopService(
+	laptopstore LaptopStore,
+	imagestore ImageStore,
+	ratingstore RatingStore,
+	idempotencystore *IdempotencyStore,
+) *LaptopServer {
+	return &LaptopServer{
+		laptopStore:      laptopstore,
+		imageStore:       imagestore,
+		ratingStore:      ratingstore,
+		idempotencyStore: idempotencystore,
+		uploads:          newUploadSessions(),
+		MaxImageSize:     DefaultMaxImageSize,
+	}
+}
+
+// idempotent runs create, or returns the response of the first request
+// with the same idempotency key if the request has one
+func (server *LaptopServer) idempotent(
+	ctx context.Context,
+	method string,
+	digest []byte,
+	create func() (proto.Message, error),
+) (proto.Message, error) {
+	key := idempotencyKey(ctx)
+	if key == "" || server.idempotencyStore == nil {
+		return create()
+	}
+	if len(key) > maxIdempotencyKeySize {
+		return nil, invalidArgumentError(IdempotencyKeyHeader, "idempotency key is too long: %d > %d", len(key), maxIdempotencyKeySize)
+	}
+
+	res, err := server.idempotencyStore.Do(ctx, method+"/"+key, digest, create)
+	if errors.Is(err, ErrIdempotencyKeyReused) {
+		return nil, idempotencyKeyReusedError(key)
+	}
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	return res, err
 }
 
 func (service *LaptopServer) CreateLaptop(
@@ -32,45 +86,294 @@ func (service *LaptopServer) CreateLaptop(
 	laptop := req.GetLaptop()
 	log.Printf("receive a create-laptop request with id :%s", laptop.Id)
 
+	//在分配ID之前计算,重试的请求才会相同
+	digest, err := messageDigest(req)
+	if err != nil {
+		return nil, internalError("cannot hash request", err)
+	}
+	res, err := service.idempotent(ctx, "CreateLaptop", digest, func() (proto.Message, error) {
+		return service.createLaptop(ctx, laptop)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*pb.CreateLaptopResponse), nil
+}
+
+func (service *LaptopServer) createLaptop(ctx context.Context, laptop *pb.Laptop) (*pb.CreateLaptopResponse, error) {
+	if err := assignLaptopID(laptop); err != nil {
+		return nil, invalidArgumentError("laptop.id", "%v", err)
+	}
+	if err := ValidateLaptop(laptop); err != nil {
+		return nil, status.Convert(err).Err()
+	}
+	//semo heavy processing set timeout
+	//time.Sleep(6 * time.Second)
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	err := service.laptopStore.Save(laptop)
+	if err != nil {
+		return nil, laptopStoreError(laptop.Id, "cannot save laptop to the store", err)
+	}
+	log.Printf("saved laptop with id :%s", laptop.Id)
+	res := &pb.CreateLaptopResponse{
+		Id: laptop.Id,
+	}
+	return res, nil
+}
+
+// assignLaptopID checks the ID of laptop or generates a new one if it's empty
+func assignLaptopID(laptop *pb.Laptop) error {
 	if len(laptop.Id) > 0 {
 		_, err := uuid.Parse(laptop.Id)
 		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "laptop ID is not a valid UUID:%v", err)
+			return fmt.Errorf("laptop ID is not a valid UUID:%v", err)
+		}
+		return nil
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return fmt.Errorf("cannot generate a new laptop ID:%v", err)
+	}
+	laptop.Id = id.String()
+	return nil
+}
+
+func (server *LaptopServer) UpdateLaptop(
+	ctx context.Context,
+	req *pb.UpdateLaptopRequest,
+) (*pb.UpdateLaptopResponse, error) {
+	laptop := req.GetLaptop()
+	mask := req.GetUpdateMask()
+	log.Printf("receive an update-laptop request with id :%s, mask: %v", laptop.GetId(), mask.GetPaths())
+
+	_, err := uuid.Parse(laptop.GetId())
+	if err != nil {
+		return nil, invalidArgumentError("laptop.id", "laptop ID is not a valid UUID:%v", err)
+	}
+	err = ValidateUpdateMask(mask)
+	if err != nil {
+		return nil, invalidArgumentError("update_mask", "invalid update mask:%v", err)
+	}
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	updated, err := server.laptopStore.Update(laptop, mask)
+	if err != nil {
+		return nil, laptopStoreError(laptop.GetId(), "cannot update laptop in the store", err)
+	}
+	log.Printf("updated laptop with id :%s", updated.GetId())
+	res := &pb.UpdateLaptopResponse{
+		Laptop: updated,
+	}
+	return res, nil
+}
+func (server *LaptopServer) DeleteLaptop(
+	ctx context.Context,
+	req *pb.DeleteLaptopRequest,
+) (*pb.DeleteLaptopResponse, error) {
+	laptopID := req.GetId()
+	log.Printf("receive a delete-laptop request with id :%s, soft: %t", laptopID, req.GetSoft())
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	//硬删除时先级联删除图片和评分,失败的话笔记本还在,重试会再删一次
+	if !req.GetSoft() {
+		if server.imageStore != nil {
+			err := server.imageStore.DeleteByLaptop(laptopID)
+			if err != nil {
+				return nil, storeError("cannot delete laptop images", err)
+			}
+		}
+		if server.ratingStore != nil {
+			err := server.ratingStore.Delete(laptopID)
+			if err != nil {
+				return nil, storeError("cannot delete laptop rating", err)
+			}
+		}
+	}
+	err := server.laptopStore.Delete(laptopID, req.GetSoft())
+	if err != nil {
+		return nil, laptopStoreError(laptopID, "cannot delete laptop from the store", err)
+	}
+	log.Printf("deleted laptop with id :%s", laptopID)
+	res := &pb.DeleteLaptopResponse{
+		Id: laptopID,
+	}
+	return res, nil
+}
+func (server *LaptopServer) RestoreLaptop(
+	ctx context.Context,
+	req *pb.RestoreLaptopRequest,
+) (*pb.RestoreLaptopResponse, error) {
+	laptopID := req.GetId()
+	log.Printf("receive a restore-laptop request with id :%s", laptopID)
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	laptop, err := server.laptopStore.Restore(laptopID)
+	if err != nil {
+		return nil, laptopStoreError(laptopID, "cannot restore laptop", err)
+	}
+	log.Printf("restored laptop with id :%s", laptopID)
+	res := &pb.RestoreLaptopResponse{
+		Laptop: laptop,
+	}
+	return res, nil
+}
+func (server *LaptopServer) GetLaptop(
+	ctx context.Context,
+	req *pb.GetLaptopRequest,
+) (*pb.GetLaptopResponse, error) {
+	log.Printf("receive a get-laptop request with id :%s", req.GetId())
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	return server.getLaptop(req.GetId())
+}
+func (server *LaptopServer) BatchGetLaptops(
+	ctx context.Context,
+	req *pb.BatchGetLaptopsRequest,
+) (*pb.BatchGetLaptopsResponse, error) {
+	laptopIDs := req.GetIds()
+	log.Printf("receive a batch-get-laptops request with %d ids", len(laptopIDs))
+
+	if len(laptopIDs) > maxBatchSize {
+		return nil, invalidArgumentError("ids", "too many ids: %d > %d", len(laptopIDs), maxBatchSize)
+	}
+
+	res := &pb.BatchGetLaptopsResponse{}
+	for _, laptopID := range laptopIDs {
+		if err := contextError(ctx); err != nil {
+			return nil, err
 		}
-	} else {
-		id, err := uuid.NewRandom()
+
+		result := &pb.LaptopResult{Id: laptopID}
+		laptop, err := server.getLaptop(laptopID)
 		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "cannot generate a new laptop ID:%v", err)
+			st := status.Convert(err)
+			result.Code = uint32(st.Code())
+			result.Message = st.Message()
+		} else {
+			result.Laptop = laptop
 		}
-		laptop.Id = id.String()
+		res.Results = append(res.Results, result)
+	}
+	return res, nil
+}
+
+func (server *LaptopServer) ListLaptops(
+	ctx context.Context,
+	req *pb.ListLaptopsRequest,
+) (*pb.ListLaptopsResponse, error) {
+	log.Printf("receive a list-laptops request: %v", req)
+
+	pageSize := int(req.GetPageSize())
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		return nil, invalidArgumentError("page_size", "page size is too large: %d > %d", pageSize, maxPageSize)
+	}
+	order := LaptopOrder{
+		Field:      req.GetOrderBy(),
+		Descending: req.GetDescending(),
+		Rating:     server.averageRating,
+	}
+	after, err := DecodePageToken(order, req.GetPageToken())
+	if err != nil {
+		return nil, invalidArgumentError("page_token", "invalid page token: %v", err)
 	}
-	//semo heavy processing set timeout
-	//time.Sleep(6 * time.Second)
 
 	if err := contextError(ctx); err != nil {
 		return nil, err
 	}
 
-	err := service.laptopStore.Save(laptop)
+	//多取一个,判断是否还有下一页
+	laptops, err := server.laptopStore.List(ctx, order, after, pageSize+1)
 	if err != nil {
-		code := codes.Internal
-		if errors.Is(err, ErrAlreadyExists) {
-			code = codes.AlreadyExists
+		if err := contextError(ctx); err != nil {
+			return nil, err
 		}
-		return nil, status.Errorf(code, "cannot save laptop to the store:%v", err)
+		return nil, storeError("cannot list laptops", err)
 	}
-	log.Printf("saved laptop with id :%s", laptop.Id)
-	res := &pb.CreateLaptopResponse{
-		Id: laptop.Id,
+
+	res := &pb.ListLaptopsResponse{}
+	if len(laptops) > pageSize {
+		laptops = laptops[:pageSize]
+		res.NextPageToken, err = EncodePageToken(order, order.Cursor(laptops[pageSize-1]))
+		if err != nil {
+			return nil, internalError("cannot create page token", err)
+		}
+	}
+	res.Laptops = laptops
+	return res, nil
+}
+
+// averageRating returns the average score of a laptop, or 0 if it's not rated
+func (server *LaptopServer) averageRating(laptopID string) float64 {
+	if server.ratingStore == nil {
+		return 0
+	}
+	rating, err := server.ratingStore.Find(laptopID)
+	if err != nil || rating == nil || rating.Count == 0 {
+		return 0
+	}
+	return rating.Sum / float64(rating.Count)
+}
+
+// getLaptop loads a laptop with its rating summary and image IDs
+func (server *LaptopServer) getLaptop(laptopID string) (*pb.GetLaptopResponse, error) {
+	laptop, err := server.laptopStore.Find(laptopID)
+	if err != nil {
+		return nil, storeError("cannot find laptop", err)
+	}
+	if laptop == nil {
+		return nil, laptopNotFoundError(laptopID)
+	}
+	res := &pb.GetLaptopResponse{
+		Laptop: laptop,
+		Rating: &pb.RatingSummary{},
+	}
+
+	if server.ratingStore != nil {
+		rating, err := server.ratingStore.Find(laptopID)
+		if err != nil {
+			return nil, storeError("cannot find laptop rating", err)
+		}
+		if rating != nil && rating.Count > 0 {
+			res.Rating.RatedCount = rating.Count
+			res.Rating.AverageScore = rating.Sum / float64(rating.Count)
+		}
+	}
+	if server.imageStore != nil {
+		imageIDs, err := server.imageStore.FindByLaptop(laptopID)
+		if err != nil {
+			return nil, storeError("cannot find laptop images", err)
+		}
+		res.ImageIds = imageIDs
+		if len(imageIDs) > 0 {
+			res.PrimaryImageId = imageIDs[0]
+		}
 	}
 	return res, nil
 }
 func contextError(ctx context.Context) error {
 	switch ctx.Err() {
 	case context.Canceled:
-		return logError(status.Error(codes.Canceled, "request is canceled"))
+		return logError(statusError(codes.Canceled, pb.ErrorReason_REQUEST_CANCELED, "request is canceled"))
 	case context.DeadlineExceeded:
-		return logError(status.Error(codes.DeadlineExceeded, "deadline is exceeded"))
+		return logError(statusError(codes.DeadlineExceeded, pb.ErrorReason_DEADLINE_EXCEEDED, "deadline is exceeded"))
 	default:
 		return nil
 	}
@@ -82,29 +385,120 @@ func (server *LaptopServer) SearchLaptop(
 	filter := req.GetFilter()
 	log.Printf("receive a search-laptop request with filter:%v", filter)
 
-	err := server.laptopStore.Search(
+	predicate, err := ParseQuery(req.GetQuery())
+	if err != nil {
+		return invalidArgumentError("query", "invalid query: %v", err)
+	}
+	query := &SearchQuery{
+		Filter:    filter,
+		Predicate: predicate,
+		Order: LaptopOrder{
+			Field:      req.GetSortBy(),
+			Descending: req.GetDescending(),
+			Rating:     server.averageRating,
+		},
+		Text:  req.GetText(),
+		Limit: int(req.GetLimit()),
+	}
+	var sendErr error
+	err = server.laptopStore.Search(
 		stream.Context(),
-		filter,
-		func(laptop *pb.Laptop) error {
-			res := &pb.SearchLaptopResponse{Laptop: laptop}
-			err := stream.Send(res)
-			if err != nil {
-				return err
+		query,
+		func(laptop *pb.Laptop, score float64) error {
+			res := &pb.SearchLaptopResponse{Laptop: laptop, Score: score}
+			sendErr = stream.Send(res)
+			if sendErr != nil {
+				return sendErr
 			}
 			log.Printf("sent laptop with id : %s", laptop.GetId())
 			return nil
 		},
 	)
+	if err := contextError(stream.Context()); err != nil {
+		return err
+	}
+	if sendErr != nil {
+		return streamError("cannot send laptop", sendErr)
+	}
 	if err != nil {
-		return status.Errorf(codes.Internal, "unexpected err:%v", err)
+		return storeError("cannot search laptops", err)
 	}
 	return nil
 
 }
+func (server *LaptopServer) AggregateLaptops(
+	ctx context.Context,
+	req *pb.AggregateLaptopsRequest,
+) (*pb.AggregateLaptopsResponse, error) {
+	log.Printf("receive an aggregate-laptops request with filter:%v", req.GetFilter())
+
+	err := ValidateHistograms(req.GetHistograms())
+	if err != nil {
+		return nil, invalidArgumentError("histograms", "invalid histograms: %v", err)
+	}
+
+	res, err := server.laptopStore.Aggregate(ctx, req.GetFilter(), req.GetHistograms())
+	if err != nil {
+		if err := contextError(ctx); err != nil {
+			return nil, err
+		}
+		if errors.Is(err, ErrTooManyBuckets) {
+			return nil, invalidArgumentError("histograms", "invalid histograms: %v", err)
+		}
+		return nil, storeError("cannot aggregate laptops", err)
+	}
+	return res, nil
+}
+
+// WatchLaptops streams the changes of the laptops matching the filter,
+// a deleted laptop is sent as it was before the deletion,
+// an updated laptop that no longer matches the filter is sent as LEFT_FILTER
+func (server *LaptopServer) WatchLaptops(
+	req *pb.WatchLaptopsRequest,
+	stream pb.LaptopService_WatchLaptopsServer,
+) error {
+	filter := req.GetFilter()
+	log.Printf("receive a watch-laptops request with filter:%v, resume token:%q", filter, req.GetResumeToken())
+
+	var sendErr error
+	err := server.laptopStore.Watch(
+		stream.Context(),
+		req.GetResumeToken(),
+		func(event *pb.LaptopEvent) error {
+			if !isQualified(filter, event.GetLaptop()) {
+				previous := event.GetPrevious()
+				if event.GetType() != pb.LaptopEvent_UPDATED || previous == nil || !isQualified(filter, previous) {
+					return nil
+				}
+				event.Type = pb.LaptopEvent_LEFT_FILTER
+			}
+			sendErr = stream.Send(&pb.WatchLaptopsResponse{Event: event})
+			if sendErr != nil {
+				return sendErr
+			}
+			log.Printf("sent %v event for laptop with id : %s", event.GetType(), event.GetLaptop().GetId())
+			return nil
+		},
+	)
+	if err := contextError(stream.Context()); err != nil {
+		return err
+	}
+	switch {
+	case sendErr != nil:
+		return streamError("cannot send event", sendErr)
+	case errors.Is(err, ErrInvalidResumeToken):
+		return invalidArgumentError("resume_token", "cannot watch laptops: %v", err)
+	case errors.Is(err, ErrResumeTokenExpired):
+		return statusError(codes.OutOfRange, pb.ErrorReason_RESUME_TOKEN_EXPIRED, fmt.Sprintf("cannot watch laptops: %v", err))
+	case err != nil:
+		return storeError("cannot watch laptops", err)
+	}
+	return nil
+}
 func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServer) error {
 	req, err := stream.Recv()
 	if err != nil {
-		return logError(status.Errorf(codes.Unknown, "cannot receive image info"))
+		return streamError("cannot receive image info", err)
 	}
 	lagtopID := req.GetInfo().GetLaptopId()
 	imageTyep := req.GetInfo().GetImageType()
@@ -112,13 +506,25 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 
 	laptop, err := server.laptopStore.Find(lagtopID)
 	if err != nil {
-		return logError(status.Errorf(codes.Internal, "cannot find laptop %s", err))
+		return storeError("cannot find laptop", err)
 	}
 	if laptop == nil {
-		return logError(status.Errorf(codes.InvalidArgument, "laptop %s doesn't exist", lagtopID))
+		return logError(laptopNotFoundError(lagtopID))
 	}
-	imageData := bytes.Buffer{}
-	imageSize := 0
+	digest, err := messageDigest(req)
+	if err != nil {
+		return internalError("cannot hash image info", err)
+	}
+	hash := sha256.New()
+	hash.Write(digest)
+
+	writer, err := server.imageStore.Create(lagtopID, imageTyep)
+	if err != nil {
+		return storeError("cannot create image", err)
+	}
+	//上传失败或者客户端取消时删掉写了一半的文件
+	defer writer.Abort()
+	var imageSize int64
 	for {
 		//
 		if err := contextError(stream.Context()); err != nil {
@@ -132,42 +538,503 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 			break
 		}
 		if err != nil {
-			return logError(status.Errorf(codes.Unknown, "cannot receive chunk data :%v", err))
+			return streamError("cannot receive chunk data", err)
 		}
 		chunk := req.GetChunkData()
 		size := len(chunk)
 
 		log.Printf("received a chunk with size:%d", size)
-		imageSize += size
-		if imageSize > maxImageSize {
-			return logError(status.Errorf(codes.InvalidArgument, "image is too large :%d > %d", imageSize, maxImageSize))
+		imageSize += int64(size)
+		if imageSize > server.MaxImageSize {
+			return logError(imageTooLargeError(lagtopID, imageSize, server.MaxImageSize))
 		}
 		//time.Sleep(time.Second)
 
-		_, err = imageData.Write(chunk)
+		_, err = writer.Write(chunk)
+		if err != nil {
+			return storeError("cannot write chunk data", err)
+		}
+		hash.Write(chunk)
+
+	}
+
+	res, err := server.idempotent(stream.Context(), "UploadImage", hash.Sum(nil), func() (proto.Message, error) {
+		imageID, err := writer.Commit()
+		if err != nil {
+			return nil, storeError("cannot save image to the store", err)
+		}
+		log.Printf("saved image with id: %s,size:%d", imageID, imageSize)
+		return &pb.UploadImageResponse{
+			Id:   imageID,
+			Size: uint64(imageSize),
+		}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = stream.SendAndClose(res.(*pb.UploadImageResponse))
+	if err != nil {
+		return streamError("cannot send response", err)
+	}
+
+	return nil
+}
+
+// StartUpload starts a resumable upload of an image, its chunks are sent with UploadChunks.
+// a retry with the same idempotency key gets the same upload
+func (server *LaptopServer) StartUpload(
+	ctx context.Context,
+	req *pb.StartUploadRequest,
+) (*pb.StartUploadResponse, error) {
+	laptopID := req.GetInfo().GetLaptopId()
+	imageType := req.GetInfo().GetImageType()
+	log.Printf("receive a start-upload request for laptop %s with image type %s", laptopID, imageType)
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	laptop, err := server.laptopStore.Find(laptopID)
+	if err != nil {
+		return nil, storeError("cannot find laptop", err)
+	}
+	if laptop == nil {
+		return nil, laptopNotFoundError(laptopID)
+	}
+
+	//重试时带着同一个幂等键,拿到同一个上传
+	key := idempotencyKey(ctx)
+	if len(key) > maxIdempotencyKeySize {
+		return nil, invalidArgumentError(IdempotencyKeyHeader, "idempotency key is too long: %d > %d", len(key), maxIdempotencyKeySize)
+	}
+	session, err := server.uploads.start(key, laptopID, imageType, func() (ImageWriter, error) {
+		writer, err := server.imageStore.Create(laptopID, imageType)
+		if err != nil {
+			return nil, storeError("cannot create image", err)
+		}
+		return writer, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("started upload with id: %s", session.id)
+	return &pb.StartUploadResponse{UploadId: session.id}, nil
+}
+
+// UploadChunks appends chunks to the upload of the first chunk, each chunk must start where the previous one ended.
+// after a disconnection the client gets the committed size with QueryUpload and sends the rest
+func (server *LaptopServer) UploadChunks(stream pb.LaptopService_UploadChunksServer) error {
+	var session *uploadSession
+	for {
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return streamError("cannot receive chunk data", err)
+		}
+
+		//一个流只属于第一个分块的上传
+		if session != nil && req.GetUploadId() != session.id {
+			return invalidArgumentError("upload_id", "chunk of upload %s sent on the stream of upload %s", req.GetUploadId(), session.id)
+		}
+		session = server.uploads.find(req.GetUploadId())
+		if session == nil {
+			return uploadNotFoundError(req.GetUploadId())
+		}
+		err = session.write(req.GetOffset(), req.GetChunkData(), server.MaxImageSize)
+		if err != nil {
+			return err
+		}
+	}
+	if session == nil {
+		return invalidArgumentError("upload_id", "no chunk is received")
+	}
+
+	size, err := session.committedSize()
+	if err != nil {
+		return err
+	}
+	err = stream.SendAndClose(&pb.UploadChunksResponse{UploadId: session.id, CommittedSize: size})
+	if err != nil {
+		return streamError("cannot send response", err)
+	}
+	return nil
+}
+
+// QueryUpload returns the number of bytes of an upload received by the server
+func (server *LaptopServer) QueryUpload(
+	ctx context.Context,
+	req *pb.QueryUploadRequest,
+) (*pb.QueryUploadResponse, error) {
+	log.Printf("receive a query-upload request with id :%s", req.GetUploadId())
+
+	session := server.uploads.find(req.GetUploadId())
+	if session == nil {
+		return nil, uploadNotFoundError(req.GetUploadId())
+	}
+	size, err := session.committedSize()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.QueryUploadResponse{UploadId: session.id, CommittedSize: size}, nil
+}
+
+// FinishUpload stores the image of an upload if the checksum matches its data and the laptop still exists
+func (server *LaptopServer) FinishUpload(
+	ctx context.Context,
+	req *pb.FinishUploadRequest,
+) (*pb.UploadImageResponse, error) {
+	uploadID := req.GetUploadId()
+	log.Printf("receive a finish-upload request with id :%s", uploadID)
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	session := server.uploads.find(uploadID)
+	if session == nil {
+		return nil, uploadNotFoundError(uploadID)
+	}
+	//上传期间笔记本可能被删除了
+	res, err := session.finish(req.GetChecksum(), func() error {
+		laptop, err := server.laptopStore.Find(session.laptopID)
+		if err != nil {
+			return storeError("cannot find laptop", err)
+		}
+		if laptop == nil {
+			return laptopNotFoundError(session.laptopID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("saved image with id: %s,size:%d", res.GetId(), res.GetSize())
+	return res, nil
+}
+
+// DownloadImage sends the info of an image followed by its data in chunks
+func (server *LaptopServer) DownloadImage(
+	req *pb.DownloadImageRequest,
+	stream pb.LaptopService_DownloadImageServer,
+) error {
+	imageID := req.GetImageId()
+	log.Printf("receive a download-image request with id :%s", imageID)
+
+	info, err := server.imageStore.Find(imageID)
+	if err != nil {
+		return storeError("cannot find image", err)
+	}
+	if info == nil {
+		return imageNotFoundError(imageID)
+	}
+	file, err := server.imageStore.Open(imageID)
+	if errors.Is(err, ErrNotFound) {
+		return imageNotFoundError(imageID)
+	}
+	if err != nil {
+		return storeError("cannot open image", err)
+	}
+	defer file.Close()
+
+	res := &pb.DownloadImageResponse{
+		Data: &pb.DownloadImageResponse_Info{
+			Info: &pb.ImageInfo{LaptopId: info.LaptopID, ImageType: info.Type},
+		},
+	}
+	err = stream.Send(res)
+	if err != nil {
+		return streamError("cannot send image info", err)
+	}
+
+	buffer := make([]byte, imageChunkSize)
+	size := 0
+	for {
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+		n, err := file.Read(buffer)
+		if n > 0 {
+			res := &pb.DownloadImageResponse{
+				Data: &pb.DownloadImageResponse_ChunkData{ChunkData: buffer[:n]},
+			}
+			err := stream.Send(res)
+			if err != nil {
+				return streamError("cannot send chunk data", err)
+			}
+			size += n
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return storeError("cannot read image", err)
+		}
+	}
+	log.Printf("sent image with id: %s,size:%d", imageID, size)
+	return nil
+}
+
+func (server *LaptopServer) ListImages(
+	ctx context.Context,
+	req *pb.ListImagesRequest,
+) (*pb.ListImagesResponse, error) {
+	laptopID := req.GetLaptopId()
+	log.Printf("receive a list-images request with laptop id :%s", laptopID)
+
+	laptop, err := server.laptopStore.Find(laptopID)
+	if err != nil {
+		return nil, storeError("cannot find laptop", err)
+	}
+	if laptop == nil {
+		return nil, laptopNotFoundError(laptopID)
+	}
+	images, err := server.laptopImages(laptopID)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ListImagesResponse{Images: images}, nil
+}
+
+// laptopImages returns the images of a laptop, the primary image first
+func (server *LaptopServer) laptopImages(laptopID string) ([]*pb.Image, error) {
+	imageIDs, err := server.imageStore.FindByLaptop(laptopID)
+	if err != nil {
+		return nil, storeError("cannot find laptop images", err)
+	}
+	images := []*pb.Image{}
+	for _, imageID := range imageIDs {
+		info, err := server.imageStore.Find(imageID)
 		if err != nil {
-			return logError(status.Errorf(codes.Internal, "cannot write chunk data %v", err))
+			return nil, storeError("cannot find image", err)
+		}
+		if info == nil {
+			//图片在两次查询之间被删除了
+			continue
 		}
+		images = append(images, &pb.Image{
+			Id:        imageID,
+			LaptopId:  info.LaptopID,
+			ImageType: info.Type,
+			Primary:   len(images) == 0,
+		})
+	}
+	return images, nil
+}
+
+func (server *LaptopServer) DeleteImage(
+	ctx context.Context,
+	req *pb.DeleteImageRequest,
+) (*pb.DeleteImageResponse, error) {
+	imageID := req.GetImageId()
+	log.Printf("receive a delete-image request with id :%s", imageID)
 
+	if err := contextError(ctx); err != nil {
+		return nil, err
 	}
 
-	imageID, err := server.imageStore.Save(lagtopID, imageTyep, imageData)
+	err := server.imageStore.Delete(imageID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, imageNotFoundError(imageID)
+	}
+	if err != nil {
+		return nil, storeError("cannot delete image", err)
+	}
+	log.Printf("deleted image with id :%s", imageID)
+	return &pb.DeleteImageResponse{ImageId: imageID}, nil
+}
+
+// SetPrimaryImage makes an image the primary image of its laptop and returns the images of the laptop
+func (server *LaptopServer) SetPrimaryImage(
+	ctx context.Context,
+	req *pb.SetPrimaryImageRequest,
+) (*pb.SetPrimaryImageResponse, error) {
+	imageID := req.GetImageId()
+	log.Printf("receive a set-primary-image request with id :%s", imageID)
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	info, err := server.imageStore.Find(imageID)
 	if err != nil {
-		return logError(status.Errorf(codes.Internal, "cannot save image to the store %v", err))
+		return nil, storeError("cannot find image", err)
+	}
+	if info == nil {
+		return nil, imageNotFoundError(imageID)
 	}
-	res := &pb.UploadImageResponse{
-		Id:   imageID,
-		Size: uint32(imageSize),
+	err = server.imageStore.SetPrimary(imageID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, imageNotFoundError(imageID)
+	}
+	if err != nil {
+		return nil, storeError("cannot set primary image", err)
 	}
 
-	err = stream.SendAndClose(res)
+	images, err := server.laptopImages(info.LaptopID)
 	if err != nil {
-		return logError(status.Errorf(codes.Unknown, "cannot send response %v", err))
+		return nil, err
 	}
-	log.Printf("saved image with id: %s,size:%d", imageID, imageSize)
+	return &pb.SetPrimaryImageResponse{Images: images}, nil
+}
+
+// ImportLaptops saves a stream of laptops in batches and returns the laptops that failed.
+// in transactional mode no laptop is saved if one of them fails, and a store failure is returned as an error.
+// otherwise the laptops of a batch the store fails to save are STORE_FAILURE failures and the next batches are tried
+func (server *LaptopServer) ImportLaptops(stream pb.LaptopService_ImportLaptopsServer) error {
+	res := &pb.ImportLaptopsResponse{}
+	transactional := false
+	ids := make(map[string]bool)
+	batch := []*pb.Laptop{}
+	indexes := []uint32{}
 
+	for {
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return streamError("cannot receive laptop", err)
+		}
+
+		index := res.Received
+		if index == 0 {
+			transactional = req.GetTransactional()
+			log.Printf("receive an import-laptops request, transactional: %t", transactional)
+		}
+		if index >= maxImportSize {
+			return logError(invalidArgumentError("laptop", "too many laptops: > %d", maxImportSize))
+		}
+		res.Received++
+
+		laptop := req.GetLaptop()
+		failure := checkImportedLaptop(laptop, ids)
+		if failure != nil {
+			failure.Index = index
+			res.Failures = append(res.Failures, failure)
+			continue
+		}
+		batch = append(batch, laptop)
+		indexes = append(indexes, index)
+
+		if !transactional && len(batch) == importBatchSize {
+			err := server.saveBatch(res, batch, indexes, true)
+			if err != nil {
+				return err
+			}
+			batch = []*pb.Laptop{}
+			indexes = []uint32{}
+		}
+	}
+
+	if !transactional || len(res.Failures) == 0 {
+		err := server.saveBatch(res, batch, indexes, !transactional)
+		if err != nil {
+			return err
+		}
+	}
+	sort.Slice(res.Failures, func(i, j int) bool {
+		return res.Failures[i].Index < res.Failures[j].Index
+	})
+
+	log.Printf("imported %d of %d laptops", len(res.CreatedIds), res.Received)
+	return stream.SendAndClose(res)
+}
+
+// checkImportedLaptop assigns the ID of laptop, it returns a failure if laptop can't be imported.
+// ids are the IDs received before, to find the duplicates of the stream
+func checkImportedLaptop(laptop *pb.Laptop, ids map[string]bool) *pb.ImportFailure {
+	if laptop == nil {
+		return &pb.ImportFailure{
+			Reason:  pb.ImportFailure_INVALID_LAPTOP,
+			Message: "laptop is missing",
+		}
+	}
+	err := assignLaptopID(laptop)
+	if err != nil {
+		return &pb.ImportFailure{
+			Id:      laptop.GetId(),
+			Reason:  pb.ImportFailure_INVALID_ID,
+			Message: err.Error(),
+		}
+	}
+	err = ValidateLaptop(laptop)
+	if err != nil {
+		return &pb.ImportFailure{
+			Id:      laptop.GetId(),
+			Reason:  pb.ImportFailure_INVALID_LAPTOP,
+			Message: err.Error(),
+		}
+	}
+	if ids[laptop.GetId()] {
+		return &pb.ImportFailure{
+			Id:      laptop.GetId(),
+			Reason:  pb.ImportFailure_DUPLICATE,
+			Message: "laptop ID is already in the stream",
+		}
+	}
+	ids[laptop.GetId()] = true
+	return nil
+}
+
+// saveBatch saves laptops and adds the created IDs and the failures to res.
+// indexes are the positions of laptops in the stream.
+// if partial is true the laptops that can't be saved are skipped, and a store failure fails the laptops left,
+// else none is saved and a store failure is returned
+func (server *LaptopServer) saveBatch(
+	res *pb.ImportLaptopsResponse,
+	laptops []*pb.Laptop,
+	indexes []uint32,
+	partial bool,
+) error {
+	for len(laptops) > 0 {
+		err := server.laptopStore.SaveAll(laptops)
+		if err == nil {
+			for _, laptop := range laptops {
+				res.CreatedIds = append(res.CreatedIds, laptop.GetId())
+			}
+			return nil
+		}
+
+		var batchErr *BatchError
+		if !errors.As(err, &batchErr) || !errors.Is(batchErr.Err, ErrAlreadyExists) {
+			if !partial {
+				return storeError("cannot save laptops to the store", err)
+			}
+			//SaveAll失败时这一批都没有保存
+			log.Printf("cannot save %d laptops to the store: %v", len(laptops), err)
+			for i, laptop := range laptops {
+				res.Failures = append(res.Failures, &pb.ImportFailure{
+					Index:   indexes[i],
+					Id:      laptop.GetId(),
+					Reason:  pb.ImportFailure_STORE_FAILURE,
+					Message: err.Error(),
+				})
+			}
+			return nil
+		}
+		i := batchErr.Index
+		res.Failures = append(res.Failures, &pb.ImportFailure{
+			Index:   indexes[i],
+			Id:      laptops[i].GetId(),
+			Reason:  pb.ImportFailure_DUPLICATE,
+			Message: batchErr.Err.Error(),
+		})
+		if !partial {
+			return nil
+		}
+		laptops = append(laptops[:i:i], laptops[i+1:]...)
+		indexes = append(indexes[:i:i], indexes[i+1:]...)
+	}
 	return nil
 }
+
 func (service *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer) error {
 	for {
 		err := contextError(stream.Context())
@@ -180,7 +1047,7 @@ func (service *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer
 			break
 		}
 		if err != nil {
-			return logError(status.Errorf(codes.Unknown, "cannot receive stream request:%v", err))
+			return streamError("cannot receive stream request", err)
 		}
 
 		laptopID := req.GetLaptopId()
@@ -190,15 +1057,15 @@ func (service *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer
 
 		found, err := service.laptopStore.Find(laptopID)
 		if err != nil {
-			return logError(status.Errorf(codes.Internal, "cannot find laptop %v", err))
+			return storeError("cannot find laptop", err)
 		}
 		if found == nil {
-			return logError(status.Errorf(codes.NotFound, "laptopID %s is not found", laptopID))
+			return logError(laptopNotFoundError(laptopID))
 		}
 
 		rating, err := service.ratingStore.Add(laptopID, score)
 		if err != nil {
-			return logError(status.Errorf(codes.Internal, "cannot add rating to the store: %v", err))
+			return storeError("cannot add rating to the store", err)
 		}
 		res := &pb.RateLaptopResponse{
 			LaptopId:     laptopID,
@@ -207,7 +1074,7 @@ func (service *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer
 		}
 		err = stream.Send(res)
 		if err != nil {
-			return logError(status.Errorf(codes.Unknown, "cannot send stream response %v", err))
+			return streamError("cannot send stream response", err)
 		}
 	}
 	return nil
@@ -1,15 +1,28 @@
 package service_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"proto_demo/client"
 	"proto_demo/pb"
 	"proto_demo/sample"
 	"proto_demo/service"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 func TestServerCreateLaptop(t *testing.T) {
@@ -65,7 +78,7 @@ func TestServerCreateLaptop(t *testing.T) {
 				Laptop: tc.laptop,
 			}
 
-			service := service.NewLaptopService(tc.store, nil, nil)
+			service := service.NewLaptopService(tc.store, nil, nil, nil)
 			res, err := service.CreateLaptop(context.Background(), req)
 			if tc.code == codes.OK {
 				require.NoError(t, err)
@@ -84,3 +97,657 @@ func TestServerCreateLaptop(t *testing.T) {
 		})
 	}
 }
+func TestServerCreateLaptopValidation(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		change func(laptop *pb.Laptop)
+		fields []string
+	}{
+		{
+			name:   "negative_price",
+			change: func(laptop *pb.Laptop) { laptop.PriceUsd = -1 },
+			fields: []string{"price_usd"},
+		},
+		{
+			name: "cpu_threads_and_frequency",
+			change: func(laptop *pb.Laptop) {
+				laptop.Cpu.NumberThreads = laptop.Cpu.NumberCores - 1
+				laptop.Cpu.MinGhz = laptop.Cpu.MaxGhz + 1
+			},
+			fields: []string{"cpu.number_threads", "cpu.max_ghz"},
+		},
+		{
+			name:   "missing_cpu",
+			change: func(laptop *pb.Laptop) { laptop.Cpu = nil },
+			fields: []string{"cpu"},
+		},
+		{
+			name:   "zero_screen",
+			change: func(laptop *pb.Laptop) { laptop.Screen.SizeInch = 0 },
+			fields: []string{"screen.size_inch"},
+		},
+		{
+			name: "unknown_memory_unit",
+			change: func(laptop *pb.Laptop) {
+				laptop.Ram.Unit = pb.Memory_UNKOWN
+				laptop.Storages[0].Memory.Unit = pb.Memory_UNKOWN
+			},
+			fields: []string{"ram.unit", "storages[0].memory.unit"},
+		},
+		{
+			name: "memory_overflow",
+			change: func(laptop *pb.Laptop) {
+				laptop.Ram = &pb.Memory{Value: math.MaxUint64, Unit: pb.Memory_BIT}
+				laptop.Gpus[0].Memory = &pb.Memory{Value: 1 << 20, Unit: pb.Memory_TERABYTE}
+				laptop.Storages[0].Memory = &pb.Memory{Value: 1 << 19, Unit: pb.Memory_TERABYTE}
+			},
+			fields: []string{"ram.value", "gpus[0].memory.value"},
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			laptop := sample.NewLaptop()
+			tc.change(laptop)
+			server := service.NewLaptopService(service.NewInMemoryLaptopStore(), nil, nil, nil)
+			_, err := server.CreateLaptop(context.Background(), &pb.CreateLaptopRequest{Laptop: laptop})
+			require.Error(t, err)
+
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+			require.Equal(t, pb.ErrorReason_INVALID_LAPTOP, client.ErrorReason(err))
+			badRequest := &errdetails.BadRequest{}
+			requireErrorDetail(t, err, badRequest)
+			fields := []string{}
+			for _, violation := range badRequest.GetFieldViolations() {
+				fields = append(fields, violation.GetField())
+			}
+			require.Equal(t, tc.fields, fields)
+		})
+	}
+}
+
+func TestServerCreateLaptopIdempotency(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	server := service.NewLaptopService(store, nil, nil, service.NewIdempotencyStore(time.Minute))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(service.IdempotencyKeyHeader, "import-1"))
+	createLaptop := func(ctx context.Context, laptop *pb.Laptop) (*pb.CreateLaptopResponse, error) {
+		//每次重试都是新的请求
+		req := &pb.CreateLaptopRequest{Laptop: proto.Clone(laptop).(*pb.Laptop)}
+		return server.CreateLaptop(ctx, req)
+	}
+
+	laptop := sample.NewLaptop()
+	laptop.Id = ""
+	res, err := createLaptop(ctx, laptop)
+	require.NoError(t, err)
+	replay, err := createLaptop(ctx, laptop)
+	require.NoError(t, err)
+	require.Equal(t, res.GetId(), replay.GetId())
+
+	other, err := createLaptop(context.Background(), laptop)
+	require.NoError(t, err)
+	require.NotEqual(t, res.GetId(), other.GetId(), "a request without key isn't a replay")
+
+	laptop.PriceUsd++
+	_, err = createLaptop(ctx, laptop)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	require.Equal(t, pb.ErrorReason_IDEMPOTENCY_KEY_REUSED, client.ErrorReason(err))
+
+	count := 0
+	err = store.Search(context.Background(), &service.SearchQuery{}, func(laptop *pb.Laptop, score float64) error {
+		count++
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func TestServerUpdateLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptop := sample.NewLaptop()
+	replacement := sample.NewLaptop()
+	replacement.Id = laptop.Id
+	replacement.Brand = "Dell"
+	replacement.PriceUsd = 999
+
+	testCases := []struct {
+		name   string
+		laptop *pb.Laptop
+		paths  []string
+		code   codes.Code
+		check  func(t *testing.T, other *pb.Laptop)
+	}{
+		{
+			name:   "success_price",
+			laptop: &pb.Laptop{Id: laptop.Id, PriceUsd: 999},
+			paths:  []string{"price_usd"},
+			code:   codes.OK,
+			check: func(t *testing.T, other *pb.Laptop) {
+				require.Equal(t, 999.0, other.GetPriceUsd())
+				require.Equal(t, laptop.GetName(), other.GetName())
+			},
+		},
+		{
+			name:   "success_current_revision",
+			laptop: &pb.Laptop{Id: laptop.Id, PriceUsd: 999, Revision: 1},
+			paths:  []string{"price_usd"},
+			code:   codes.OK,
+			check: func(t *testing.T, other *pb.Laptop) {
+				require.Equal(t, 999.0, other.GetPriceUsd())
+			},
+		},
+		{
+			name:   "success_nested",
+			laptop: &pb.Laptop{Id: laptop.Id, Cpu: &pb.CPU{NumberCores: 1}},
+			paths:  []string{"cpu.number_cores"},
+			code:   codes.OK,
+			check: func(t *testing.T, other *pb.Laptop) {
+				require.Equal(t, uint32(1), other.GetCpu().GetNumberCores())
+				require.Equal(t, laptop.GetCpu().GetName(), other.GetCpu().GetName())
+				require.Equal(t, laptop.GetPriceUsd(), other.GetPriceUsd())
+			},
+		},
+		{
+			name:   "success_no_mask",
+			laptop: replacement,
+			code:   codes.OK,
+			check: func(t *testing.T, other *pb.Laptop) {
+				require.Equal(t, "Dell", other.GetBrand())
+				require.Equal(t, 999.0, other.GetPriceUsd())
+				require.Equal(t, replacement.GetCpu().GetName(), other.GetCpu().GetName())
+			},
+		},
+		{
+			name:   "failure_no_mask_incomplete",
+			laptop: &pb.Laptop{Id: laptop.Id, Brand: "Dell", PriceUsd: 999},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "failure_invalid_nested",
+			laptop: &pb.Laptop{Id: laptop.Id, Cpu: &pb.CPU{NumberCores: 64}},
+			paths:  []string{"cpu.number_cores"},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "failure_negative_price",
+			laptop: &pb.Laptop{Id: laptop.Id, PriceUsd: -1},
+			paths:  []string{"price_usd"},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "failure_invalid_id",
+			laptop: &pb.Laptop{Id: "invalid-uuid"},
+			paths:  []string{"price_usd"},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "failure_unknown_path",
+			laptop: &pb.Laptop{Id: laptop.Id},
+			paths:  []string{"color"},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "failure_immutable_path",
+			laptop: &pb.Laptop{Id: laptop.Id},
+			paths:  []string{"id"},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "failure_stale_revision",
+			laptop: &pb.Laptop{Id: laptop.Id, PriceUsd: 999, Revision: 2},
+			paths:  []string{"price_usd"},
+			code:   codes.Aborted,
+		},
+		{
+			name:   "failure_immutable_revision",
+			laptop: &pb.Laptop{Id: laptop.Id},
+			paths:  []string{"revision"},
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "failure_not_found",
+			laptop: sample.NewLaptop(),
+			paths:  []string{"price_usd"},
+			code:   codes.NotFound,
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := service.NewInMemoryLaptopStore()
+			err := store.Save(laptop)
+			require.NoError(t, err)
+
+			req := &pb.UpdateLaptopRequest{
+				Laptop:     tc.laptop,
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: tc.paths},
+			}
+
+			server := service.NewLaptopService(store, nil, nil, nil)
+			res, err := server.UpdateLaptop(context.Background(), req)
+			if tc.code != codes.OK {
+				require.Error(t, err)
+				require.Nil(t, res)
+				s, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, tc.code, s.Code())
+				return
+			}
+
+			require.NoError(t, err)
+			other, err := store.Find(laptop.Id)
+			require.NoError(t, err)
+			requireSameLaptop(t, res.GetLaptop(), other)
+			require.True(t, other.GetUpdateAt().AsTime().After(laptop.GetUpdateAt().AsTime()))
+			require.Equal(t, uint64(2), other.GetRevision())
+			tc.check(t, other)
+		})
+	}
+}
+
+func TestServerUpdateLaptopWithoutMask(t *testing.T) {
+	t.Parallel()
+
+	laptop := sample.NewLaptop()
+	store := service.NewInMemoryLaptopStore()
+	err := store.Save(laptop)
+	require.NoError(t, err)
+	server := service.NewLaptopService(store, nil, nil, nil)
+
+	update := sample.NewLaptop()
+	update.Id = laptop.Id
+	update.Brand = "Dell"
+	update.PriceUsd = 999
+	gpuName := update.GetGpus()[0].GetName()
+	gpuBrand := update.GetGpus()[0].GetBrand()
+
+	req := &pb.UpdateLaptopRequest{Laptop: update}
+	res, err := server.UpdateLaptop(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, "Dell", res.GetLaptop().GetBrand())
+	require.Equal(t, 999.0, res.GetLaptop().GetPriceUsd())
+	require.Equal(t, update.GetName(), res.GetLaptop().GetName(), "a request without update mask replaces every mutable field")
+
+	// the store doesn't share sub-messages with the request or the response
+	req.Laptop.Gpus[0].Name = "changed"
+	res.GetLaptop().Gpus[0].Brand = "changed"
+	other, err := store.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Equal(t, gpuName, other.GetGpus()[0].GetName())
+	require.Equal(t, gpuBrand, other.GetGpus()[0].GetBrand())
+}
+
+func TestServerDeleteLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := newTestImageStore(t, imageFolder)
+	ratingStore := service.NewInMemoryRatingStore()
+	server := service.NewLaptopService(laptopStore, imageStore, ratingStore, nil)
+
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+	imageID, err := imageStore.Save(laptop.Id, ".jpg", bytes.NewBufferString("image"))
+	require.NoError(t, err)
+	_, err = ratingStore.Add(laptop.Id, 8)
+	require.NoError(t, err)
+
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id, Soft: true})
+	require.NoError(t, err)
+	found, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, found)
+	require.ErrorIs(t, laptopStore.Save(laptop), service.ErrAlreadyExists)
+
+	res, err := server.RestoreLaptop(context.Background(), &pb.RestoreLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+	require.Equal(t, laptop.Id, res.GetLaptop().GetId())
+	require.Equal(t, uint64(2), res.GetLaptop().GetRevision())
+
+	imagePath := fmt.Sprintf("%s/%s_%s.jpg", imageFolder, laptop.Id, imageID)
+	require.FileExists(t, imagePath)
+
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+	found, err = laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, found)
+	require.NoFileExists(t, imagePath)
+	rating, err := ratingStore.Add(laptop.Id, 5)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), rating.Count)
+
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = server.RestoreLaptop(context.Background(), &pb.RestoreLaptopRequest{Id: laptop.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServerDeleteLaptopCascadeFailure(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := &failingImageStore{DiskImageStore: newTestImageStore(t, t.TempDir()), fail: true}
+	ratingStore := service.NewInMemoryRatingStore()
+	server := service.NewLaptopService(laptopStore, imageStore, ratingStore, nil)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	imageID, err := imageStore.Save(laptop.Id, ".jpg", bytes.NewBufferString("image"))
+	require.NoError(t, err)
+	_, err = ratingStore.Add(laptop.Id, 8)
+	require.NoError(t, err)
+
+	// the laptop is kept if its images can't be deleted
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.Equal(t, codes.Internal, status.Code(err))
+	found, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	rating, err := ratingStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.NotNil(t, rating)
+
+	// so the retry deletes everything
+	imageStore.fail = false
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+	found, err = laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, found)
+	info, err := imageStore.Find(imageID)
+	require.NoError(t, err)
+	require.Nil(t, info)
+	rating, err = ratingStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, rating)
+}
+
+// failingImageStore fails to delete the images of a laptop if fail is true
+type failingImageStore struct {
+	*service.DiskImageStore
+	fail bool
+}
+
+func (store *failingImageStore) DeleteByLaptop(laptopID string) error {
+	if store.fail {
+		return errors.New("disk failure")
+	}
+	return store.DiskImageStore.DeleteByLaptop(laptopID)
+}
+
+func TestServerUploadSession(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := newTestImageStore(t, imageFolder)
+	server := service.NewLaptopService(laptopStore, imageStore, nil, nil)
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(service.IdempotencyKeyHeader, "upload-1"))
+	info := &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".jpg"}
+
+	// a retry of StartUpload gets the same upload
+	res, err := server.StartUpload(ctx, &pb.StartUploadRequest{Info: info})
+	require.NoError(t, err)
+	replay, err := server.StartUpload(ctx, &pb.StartUploadRequest{Info: info})
+	require.NoError(t, err)
+	require.Equal(t, res.GetUploadId(), replay.GetUploadId())
+	partials, err := filepath.Glob(filepath.Join(imageFolder, "upload-*.tmp"))
+	require.NoError(t, err)
+	require.Len(t, partials, 1)
+
+	other, err := server.StartUpload(context.Background(), &pb.StartUploadRequest{Info: info})
+	require.NoError(t, err)
+	require.NotEqual(t, res.GetUploadId(), other.GetUploadId(), "a request without key isn't a retry")
+	_, err = server.StartUpload(ctx, &pb.StartUploadRequest{Info: &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".png"}})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	require.Equal(t, pb.ErrorReason_IDEMPOTENCY_KEY_REUSED, client.ErrorReason(err))
+
+	// the laptop is deleted before the upload is finished
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.GetId(), Soft: true})
+	require.NoError(t, err)
+	checksum := sha256.Sum256(nil)
+	finish := &pb.FinishUploadRequest{UploadId: res.GetUploadId(), Checksum: checksum[:]}
+	_, err = server.FinishUpload(context.Background(), finish)
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Equal(t, pb.ErrorReason_LAPTOP_NOT_FOUND, client.ErrorReason(err))
+
+	// the upload is kept, it can be finished once the laptop is restored
+	_, err = server.RestoreLaptop(context.Background(), &pb.RestoreLaptopRequest{Id: laptop.GetId()})
+	require.NoError(t, err)
+	image, err := server.FinishUpload(context.Background(), finish)
+	require.NoError(t, err)
+	imageIDs, err := imageStore.FindByLaptop(laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, []string{image.GetId()}, imageIDs)
+}
+
+func TestServerListLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+	server := service.NewLaptopService(laptopStore, nil, ratingStore, nil)
+
+	for i := 0; i < 7; i++ {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = float64(1000 + 100*i)
+		err := laptopStore.Save(laptop)
+		require.NoError(t, err)
+		_, err = ratingStore.Add(laptop.Id, float64(i))
+		require.NoError(t, err)
+	}
+
+	req := &pb.ListLaptopsRequest{PageSize: 3, OrderBy: pb.SortField_PRICE}
+	prices := []float64{}
+	for page := 0; ; page++ {
+		res, err := server.ListLaptops(context.Background(), req)
+		require.NoError(t, err)
+		for _, laptop := range res.GetLaptops() {
+			prices = append(prices, laptop.GetPriceUsd())
+		}
+		if res.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = res.GetNextPageToken()
+
+		if page == 0 {
+			//新增的laptop只在排在游标之后时出现
+			cheap := sample.NewLaptop()
+			cheap.PriceUsd = 500
+			require.NoError(t, laptopStore.Save(cheap))
+			expensive := sample.NewLaptop()
+			expensive.PriceUsd = 5000
+			require.NoError(t, laptopStore.Save(expensive))
+		}
+	}
+	require.Equal(t, []float64{1000, 1100, 1200, 1300, 1400, 1500, 1600, 5000}, prices)
+
+	res, err := server.ListLaptops(context.Background(), &pb.ListLaptopsRequest{
+		PageSize:   2,
+		OrderBy:    pb.SortField_AVERAGE_RATING,
+		Descending: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, res.GetLaptops(), 2)
+	require.Equal(t, 1600.0, res.GetLaptops()[0].GetPriceUsd())
+	require.Equal(t, 1500.0, res.GetLaptops()[1].GetPriceUsd())
+
+	_, err = server.ListLaptops(context.Background(), &pb.ListLaptopsRequest{
+		OrderBy:   pb.SortField_RELEASE_YEAR,
+		PageToken: res.GetNextPageToken(),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = server.ListLaptops(context.Background(), &pb.ListLaptopsRequest{PageToken: "invalid"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+func TestServerAggregateLaptops(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	brands := []string{"Dell", "Lenovo", "Dell", "Apple"}
+	for i, brand := range brands {
+		laptop := sample.NewLaptop()
+		laptop.Brand = brand
+		laptop.PriceUsd = float64(1000 * (i + 1))
+		laptop.Screen.Panel = pb.Screen_IPS
+		require.NoError(t, store.Save(laptop))
+	}
+	server := service.NewLaptopService(store, nil, nil, nil)
+
+	req := &pb.AggregateLaptopsRequest{
+		Filter: &pb.Filter{MaxPriceUsd: proto.Float64(3000)},
+		Histograms: []*pb.HistogramSpec{
+			{Field: pb.Histogram_PRICE_USD, Interval: 2000},
+		},
+	}
+	res, err := server.AggregateLaptops(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), res.GetTotal())
+	require.Len(t, res.GetBrands(), 2)
+	require.Equal(t, "Dell", res.GetBrands()[0].GetValue())
+	require.Equal(t, uint32(2), res.GetBrands()[0].GetCount())
+	require.Equal(t, "Lenovo", res.GetBrands()[1].GetValue())
+	require.Len(t, res.GetScreenPanels(), 1)
+	require.Equal(t, "IPS", res.GetScreenPanels()[0].GetValue())
+	require.Equal(t, uint32(3), res.GetScreenPanels()[0].GetCount())
+	require.Equal(t, 1000.0, res.GetPrice().GetMinUsd())
+	require.Equal(t, 3000.0, res.GetPrice().GetMaxUsd())
+	require.Equal(t, 2000.0, res.GetPrice().GetAvgUsd())
+
+	require.Len(t, res.GetHistograms(), 1)
+	buckets := res.GetHistograms()[0].GetBuckets()
+	require.Len(t, buckets, 2)
+	require.Equal(t, 0.0, buckets[0].GetMin())
+	require.Equal(t, uint32(1), buckets[0].GetCount())
+	require.Equal(t, 2000.0, buckets[1].GetMin())
+	require.Equal(t, 4000.0, buckets[1].GetMax())
+	require.Equal(t, uint32(2), buckets[1].GetCount())
+
+	req.Histograms[0].Interval = 0
+	_, err = server.AggregateLaptops(context.Background(), req)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// a tiny interval would overflow the bucket index
+	req.Histograms[0].Interval = 1e-300
+	_, err = server.AggregateLaptops(context.Background(), req)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerAggregateLaptopsTooManyBuckets(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	for i := 0; i <= 1000; i++ {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = float64(i)
+		require.NoError(t, store.Save(laptop))
+	}
+	server := service.NewLaptopService(store, nil, nil, nil)
+
+	req := &pb.AggregateLaptopsRequest{
+		Histograms: []*pb.HistogramSpec{{Field: pb.Histogram_PRICE_USD, Interval: 1}},
+	}
+	_, err := server.AggregateLaptops(context.Background(), req)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	req.Histograms[0].Interval = 2
+	res, err := server.AggregateLaptops(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, res.GetHistograms()[0].GetBuckets(), 501)
+}
+
+func TestServerErrorDetails(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, store.Save(laptop))
+	server := service.NewLaptopService(store, nil, nil, nil)
+
+	missingID := sample.NewLaptop().GetId()
+	_, err := server.GetLaptop(context.Background(), &pb.GetLaptopRequest{Id: missingID})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Equal(t, pb.ErrorReason_LAPTOP_NOT_FOUND, client.ErrorReason(err))
+	resourceInfo := &errdetails.ResourceInfo{}
+	requireErrorDetail(t, err, resourceInfo)
+	require.Equal(t, missingID, resourceInfo.GetResourceName())
+	errorInfo := &errdetails.ErrorInfo{}
+	requireErrorDetail(t, err, errorInfo)
+	require.Equal(t, service.ErrorDomain, errorInfo.GetDomain())
+	require.Equal(t, missingID, errorInfo.GetMetadata()["laptop_id"])
+
+	stale := &pb.Laptop{Id: laptop.GetId(), PriceUsd: 999, Revision: 5}
+	req := &pb.UpdateLaptopRequest{Laptop: stale, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}}}
+	_, err = server.UpdateLaptop(context.Background(), req)
+	require.Equal(t, codes.Aborted, status.Code(err))
+	require.Equal(t, pb.ErrorReason_STALE_REVISION, client.ErrorReason(err))
+	_, ok := client.RetryDelay(err)
+	require.True(t, ok)
+
+	_, err = server.ListLaptops(context.Background(), &pb.ListLaptopsRequest{PageSize: 1000})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	badRequest := &errdetails.BadRequest{}
+	requireErrorDetail(t, err, badRequest)
+	require.Equal(t, "page_size", badRequest.GetFieldViolations()[0].GetField())
+
+	sqlStore, err := service.NewSQLStore(":memory:")
+	require.NoError(t, err)
+	require.NoError(t, sqlStore.Close())
+	server = service.NewLaptopService(sqlStore.Laptops, nil, nil, nil)
+	_, err = server.GetLaptop(context.Background(), &pb.GetLaptopRequest{Id: laptop.GetId()})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, pb.ErrorReason_STORE_UNAVAILABLE, client.ErrorReason(err))
+	delay, ok := client.RetryDelay(err)
+	require.True(t, ok)
+	require.Positive(t, delay)
+
+	// a failure that won't go away is not retried
+	imageFolder := t.TempDir()
+	server = service.NewLaptopService(store, newTestImageStore(t, imageFolder), nil, nil)
+	require.NoError(t, os.RemoveAll(imageFolder))
+	_, err = server.StartUpload(context.Background(), &pb.StartUploadRequest{
+		Info: &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".jpg"},
+	})
+	require.Equal(t, codes.Internal, status.Code(err))
+	require.Equal(t, pb.ErrorReason_INTERNAL_ERROR, client.ErrorReason(err))
+	_, ok = client.RetryDelay(err)
+	require.False(t, ok)
+
+	user, err := service.NewUser("admin", "secret", "admin")
+	require.NoError(t, err)
+	userStore := service.NewInMemoryUserStore()
+	require.NoError(t, userStore.Save(user))
+	authServer := service.NewAuthServer(userStore, service.NewJwtManager("secret", time.Minute))
+	_, err = authServer.Login(context.Background(), &pb.LoginRequest{Username: "admin", Password: "wrong"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	require.Equal(t, pb.ErrorReason_INVALID_CREDENTIALS, client.ErrorReason(err))
+}
+
+// requireErrorDetail copies the detail of err with the type of detail into detail
+func requireErrorDetail(t *testing.T, err error, detail proto.Message) {
+	t.Helper()
+	for _, d := range status.Convert(err).Details() {
+		other, ok := d.(proto.Message)
+		if ok && other.ProtoReflect().Descriptor() == detail.ProtoReflect().Descriptor() {
+			proto.Merge(detail, other)
+			return
+		}
+	}
+	require.Failf(t, "missing error detail", "%T in %v", detail, err)
+}
@@ -4,34 +4,172 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"proto_demo/pb"
 	"sync"
 
 	"github.com/jinzhu/copier"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var ErrAlreadyExists = errors.New("record already exists")
+var ErrNotFound = errors.New("record not found")
+var ErrStaleRevision = errors.New("record has been modified")
+
+// immutableLaptopFields can't be changed by an update
+var immutableLaptopFields = map[string]bool{
+	"id":        true,
+	"update_at": true,
+	"revision":  true,
+}
+
+// BatchError is returned when a laptop of a batch can't be saved
+type BatchError struct {
+	// Index is the position of the laptop in the batch
+	Index int
+	Err   error
+}
+
+func (err *BatchError) Error() string {
+	return fmt.Sprintf("laptop %d: %v", err.Index, err.Err)
+}
+
+func (err *BatchError) Unwrap() error {
+	return err.Err
+}
 
 type LaptopStore interface {
 	Save(laptop *pb.Laptop) error
+	// SaveAll saves all the laptops or none of them, it fails with a *BatchError if one of them can't be saved
+	SaveAll(laptops []*pb.Laptop) error
 	Find(id string) (*pb.Laptop, error)
-	Search(ctx context.Context, filter *pb.Filter, found func(laptop *pb.Laptop) error) error
+	// Update overwrites the fields listed in mask, an empty mask replaces all mutable fields.
+	// if laptop.Revision is not zero it must match the stored revision
+	Update(laptop *pb.Laptop, mask *fieldmaskpb.FieldMask) (*pb.Laptop, error)
+	// Delete removes a laptop, a soft deleted laptop is hidden until it is restored
+	Delete(id string, soft bool) error
+	Restore(id string) (*pb.Laptop, error)
+	// List returns at most limit laptops in order, starting after the cursor if it's not nil
+	List(ctx context.Context, order LaptopOrder, after *LaptopCursor, limit int) ([]*pb.Laptop, error)
+	// Search calls found for each laptop matching query, score is the text search relevance
+	Search(ctx context.Context, query *SearchQuery, found func(laptop *pb.Laptop, score float64) error) error
+	// Aggregate counts the facets and histograms of the laptops matching filter
+	Aggregate(ctx context.Context, filter *pb.Filter, histograms []*pb.HistogramSpec) (*pb.AggregateLaptopsResponse, error)
+	// Watch calls found for each change made after resumeToken until ctx is done,
+	// an empty resumeToken only follows the new changes
+	Watch(ctx context.Context, resumeToken string, found func(event *pb.LaptopEvent) error) error
+}
+
+// SearchQuery selects the laptops matching Filter.
+// laptops are sorted by Order and truncated to Limit if Limit isn't 0, Order isn't the default one or Text is set
+type SearchQuery struct {
+	Filter *pb.Filter
+	// Predicate is an optional condition parsed by ParseQuery
+	Predicate Predicate
+	// Text is an optional full text search on brand, name, CPU and GPU names
+	Text  string
+	Order LaptopOrder
+	Limit int
+}
+
+func (query *SearchQuery) match(laptop *pb.Laptop) bool {
+	return isQualified(query.Filter, laptop) && (query.Predicate == nil || query.Predicate.Match(laptop))
+}
+
+func (query *SearchQuery) sorted() bool {
+	return query.Limit > 0 || query.Order.Field != pb.SortField_ID || query.Order.Descending || query.Text != ""
+}
+
+// order returns the order of the results, a text search is sorted by relevance by default
+func (query *SearchQuery) order(scores map[string]float64) LaptopOrder {
+	order := query.Order
+	if query.Text != "" && order.Field == pb.SortField_ID && !order.Descending {
+		order.Field = pb.SortField_RELEVANCE
+		order.Descending = true
+	}
+	order.Relevance = func(laptopID string) float64 {
+		return scores[laptopID]
+	}
+	return order
+}
+
+// searchResults collects the laptops matching a query for the stores without a text index
+type searchResults struct {
+	query    *SearchQuery
+	scores   map[string]float64
+	matched  []*pb.Laptop
+	selector *laptopSelector
+}
+
+func newSearchResults(query *SearchQuery) *searchResults {
+	results := &searchResults{
+		query:  query,
+		scores: make(map[string]float64),
+	}
+	results.selector = newLaptopSelector(query.order(results.scores), query.Limit)
+	return results
+}
+
+// Add keeps laptop if it matches the query, it must not be modified afterwards
+func (results *searchResults) Add(laptop *pb.Laptop) {
+	if !results.query.match(laptop) {
+		return
+	}
+	if results.query.Text != "" {
+		score := textScore(results.query.Text, laptop)
+		if score == 0 {
+			return
+		}
+		results.scores[laptop.GetId()] = score
+	}
+	if results.query.sorted() {
+		results.selector.Add(laptop)
+	} else {
+		results.matched = append(results.matched, laptop)
+	}
 }
+
+// Send calls found for each laptop kept
+func (results *searchResults) Send(ctx context.Context, found func(laptop *pb.Laptop, score float64) error) error {
+	laptops := results.matched
+	if results.query.sorted() {
+		laptops = results.selector.Laptops()
+	}
+	for _, laptop := range laptops {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := found(laptop, results.scores[laptop.GetId()])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type InMemoryLaptopStore struct {
-	mutex sync.RWMutex
-	data  map[string]*pb.Laptop
+	mutex   sync.RWMutex
+	data    map[string]*pb.Laptop
+	deleted map[string]*pb.Laptop
+	index   *laptopIndex
+	feed    *changeFeed
+	// writeAhead is called with the records of a change before it's applied, the change is discarded if it fails.
+	// it's set by a persistent store wrapping this one
+	writeAhead func(records ...*pb.LaptopRecord) error
 }
 
 func NewInMemoryLaptopStore() *InMemoryLaptopStore {
 	return &InMemoryLaptopStore{
-		data: make(map[string]*pb.Laptop),
+		data:    make(map[string]*pb.Laptop),
+		deleted: make(map[string]*pb.Laptop),
+		index:   newLaptopIndex(),
+		feed:    newChangeFeed(eventLogSize),
 	}
 }
 func (store *InMemoryLaptopStore) Save(laptop *pb.Laptop) error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
-	if store.data[laptop.Id] != nil {
+	if store.data[laptop.Id] != nil || store.deleted[laptop.Id] != nil {
 		return ErrAlreadyExists
 	}
 	other, err := deepCopy(laptop)
@@ -39,7 +177,47 @@ func (store *InMemoryLaptopStore) Save(laptop *pb.Laptop) error {
 	if err != nil {
 		return err
 	}
+	other.Revision = 1
+	err = store.log(&pb.LaptopRecord{Op: pb.LaptopRecord_PUT, Laptop: other})
+	if err != nil {
+		return err
+	}
 	store.data[other.Id] = other
+	store.index.Add(other)
+	store.feed.Publish(pb.LaptopEvent_CREATED, other)
+	return nil
+}
+func (store *InMemoryLaptopStore) SaveAll(laptops []*pb.Laptop) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	others := make([]*pb.Laptop, len(laptops))
+	records := make([]*pb.LaptopRecord, len(laptops))
+	ids := make(map[string]bool)
+	for i, laptop := range laptops {
+		if store.data[laptop.Id] != nil || store.deleted[laptop.Id] != nil || ids[laptop.Id] {
+			return &BatchError{Index: i, Err: ErrAlreadyExists}
+		}
+		ids[laptop.Id] = true
+
+		other, err := deepCopy(laptop)
+		if err != nil {
+			return &BatchError{Index: i, Err: err}
+		}
+		other.Revision = 1
+		others[i] = other
+		records[i] = &pb.LaptopRecord{Op: pb.LaptopRecord_PUT, Laptop: other}
+	}
+
+	err := store.log(records...)
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		store.data[other.Id] = other
+		store.index.Add(other)
+		store.feed.Publish(pb.LaptopEvent_CREATED, other)
+	}
 	return nil
 }
 func (store *InMemoryLaptopStore) Find(id string) (*pb.Laptop, error) {
@@ -52,52 +230,348 @@ func (store *InMemoryLaptopStore) Find(id string) (*pb.Laptop, error) {
 	}
 	return deepCopy(laptop)
 }
-func (store *InMemoryLaptopStore) Search(
+func (store *InMemoryLaptopStore) Update(laptop *pb.Laptop, mask *fieldmaskpb.FieldMask) (*pb.Laptop, error) {
+	err := ValidateUpdateMask(mask)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	old := store.data[laptop.Id]
+	if old == nil {
+		return nil, ErrNotFound
+	}
+	other, err := updateLaptop(old, laptop, mask)
+	if err != nil {
+		return nil, err
+	}
+
+	//深拷贝,避免和请求共享子消息
+	updated, err := deepCopy(other)
+	if err != nil {
+		return nil, err
+	}
+	err = store.log(&pb.LaptopRecord{Op: pb.LaptopRecord_PUT, Laptop: updated})
+	if err != nil {
+		return nil, err
+	}
+	store.data[updated.Id] = updated
+	store.index.Remove(old)
+	store.index.Add(updated)
+	store.feed.PublishUpdate(old, updated)
+	return other, nil
+}
+
+func (store *InMemoryLaptopStore) Delete(id string, soft bool) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	laptop := store.data[id]
+	if laptop == nil && (soft || store.deleted[id] == nil) {
+		return ErrNotFound
+	}
+	op := pb.LaptopRecord_DELETE
+	if soft {
+		op = pb.LaptopRecord_SOFT_DELETE
+	}
+	err := store.log(&pb.LaptopRecord{Op: op, Id: id})
+	if err != nil {
+		return err
+	}
+	if laptop == nil {
+		//硬删除可以清除已经软删除的laptop
+		delete(store.deleted, id)
+		return nil
+	}
+
+	delete(store.data, id)
+	store.index.Remove(laptop)
+	if soft {
+		store.deleted[id] = laptop
+	}
+	store.feed.Publish(pb.LaptopEvent_DELETED, laptop)
+	return nil
+}
+func (store *InMemoryLaptopStore) Restore(id string) (*pb.Laptop, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	laptop := store.deleted[id]
+	if laptop == nil {
+		return nil, ErrNotFound
+	}
+	other, err := deepCopy(laptop)
+	if err != nil {
+		return nil, err
+	}
+	other.UpdateAt = timestamppb.Now()
+	other.Revision = laptop.GetRevision() + 1
+	err = store.log(&pb.LaptopRecord{Op: pb.LaptopRecord_PUT, Laptop: other})
+	if err != nil {
+		return nil, err
+	}
+
+	delete(store.deleted, id)
+	store.data[id] = other
+	store.index.Add(other)
+	store.feed.Publish(pb.LaptopEvent_CREATED, other)
+	return deepCopy(other)
+}
+
+// log passes the records of a change to writeAhead, if any
+func (store *InMemoryLaptopStore) log(records ...*pb.LaptopRecord) error {
+	if store.writeAhead == nil {
+		return nil
+	}
+	return store.writeAhead(records...)
+}
+
+// put stores laptop as is, it's used to replay the changes of a persistent store
+func (store *InMemoryLaptopStore) put(laptop *pb.Laptop) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if old := store.data[laptop.Id]; old != nil {
+		store.index.Remove(old)
+	}
+	delete(store.deleted, laptop.Id)
+	store.data[laptop.Id] = laptop
+	store.index.Add(laptop)
+}
+
+// remove deletes a laptop without checking that it exists, it's used to replay the changes of a persistent store
+func (store *InMemoryLaptopStore) remove(id string, soft bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	laptop := store.data[id]
+	if laptop != nil {
+		delete(store.data, id)
+		store.index.Remove(laptop)
+	}
+	if !soft {
+		delete(store.deleted, id)
+	} else if laptop != nil {
+		store.deleted[id] = laptop
+	}
+}
+
+// snapshot returns all the laptops of the store
+func (store *InMemoryLaptopStore) snapshot() *pb.LaptopSnapshot {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	snapshot := &pb.LaptopSnapshot{}
+	for _, laptop := range store.data {
+		snapshot.Laptops = append(snapshot.Laptops, laptop)
+	}
+	for _, laptop := range store.deleted {
+		snapshot.Deleted = append(snapshot.Deleted, laptop)
+	}
+	return snapshot
+}
+
+func (store *InMemoryLaptopStore) List(
 	ctx context.Context,
-	filter *pb.Filter,
-	found func(laptop *pb.Laptop) error,
-) error {
+	order LaptopOrder,
+	after *LaptopCursor,
+	limit int,
+) ([]*pb.Laptop, error) {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
+	selector := newLaptopSelector(order, limit)
 	for _, laptop := range store.data {
-		//set time
-		//time.Sleep(time.Second)
-		log.Print("checking laptop id: ", laptop.GetId())
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if after != nil && !order.Less(after, order.Cursor(laptop)) {
+			continue
+		}
+		selector.Add(laptop)
+	}
 
-		if ctx.Err() == context.Canceled || ctx.Err() == context.DeadlineExceeded {
-			log.Print("context is cancelled")
-			return errors.New("context is cancelled")
+	laptops := selector.Laptops()
+	for i, laptop := range laptops {
+		other, err := deepCopy(laptop)
+		if err != nil {
+			return nil, err
 		}
-		if isQualified(filter, laptop) {
-			other, err := deepCopy(laptop)
-			if err != nil {
-				return err
-			}
-			err = found(other)
-			if err != nil {
-				return err
-			}
+		laptops[i] = other
+	}
+	return laptops, nil
+}
+
+// updateLaptop returns a copy of old with the fields of mask taken from laptop and a new revision
+func updateLaptop(old *pb.Laptop, laptop *pb.Laptop, mask *fieldmaskpb.FieldMask) (*pb.Laptop, error) {
+	if laptop.GetRevision() != 0 && laptop.GetRevision() != old.GetRevision() {
+		return nil, fmt.Errorf("%w: revision %d, current %d", ErrStaleRevision, laptop.GetRevision(), old.GetRevision())
+	}
+	other, err := deepCopy(old)
+	if err != nil {
+		return nil, err
+	}
+	paths := updatePaths(mask)
+	err = applyFieldMask(other, laptop, paths)
+	if err != nil {
+		return nil, err
+	}
+	err = validateUpdatedLaptop(other, paths)
+	if err != nil {
+		return nil, err
+	}
+	other.UpdateAt = timestamppb.Now()
+	other.Revision = old.GetRevision() + 1
+	return other, nil
+}
+
+// ValidateUpdateMask checks that every path exists in pb.Laptop and is mutable
+func ValidateUpdateMask(mask *fieldmaskpb.FieldMask) error {
+	if len(mask.GetPaths()) == 0 {
+		return nil
+	}
+	if !mask.IsValid(&pb.Laptop{}) {
+		return fmt.Errorf("invalid update mask paths: %v", mask.GetPaths())
+	}
+	for _, path := range mask.GetPaths() {
+		if immutableLaptopFields[path] {
+			return fmt.Errorf("field %s can't be updated", path)
 		}
 	}
 	return nil
 }
 
-func isQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
-	if laptop.GetPriceUsd() > filter.GetMaxPriceUsd() {
-		return false
+// updatePaths returns the paths of mask, or every mutable field if mask is empty
+func updatePaths(mask *fieldmaskpb.FieldMask) []string {
+	if len(mask.GetPaths()) > 0 {
+		return mask.GetPaths()
 	}
-	if laptop.GetCpu().GetNumberCores() < filter.GetMinCpuCores() {
-		return false
+	fields := (&pb.Laptop{}).ProtoReflect().Descriptor().Fields()
+	paths := make([]string, 0, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		name := string(fields.Get(i).Name())
+		if !immutableLaptopFields[name] {
+			paths = append(paths, name)
+		}
 	}
-	if laptop.GetCpu().GetMinGhz() < filter.GetMinCpuGhz() {
-		return false
+	return paths
+}
+func (store *InMemoryLaptopStore) Search(
+	ctx context.Context,
+	query *SearchQuery,
+	found func(laptop *pb.Laptop, score float64) error,
+) error {
+	laptops, scores, err := store.selectLaptops(ctx, query)
+	if err != nil {
+		return err
 	}
-	if toBit(laptop.GetRam()) < toBit(filter.MinRam) {
-		return false
+
+	//锁已经释放,慢的客户端不会阻塞写入
+	for _, laptop := range laptops {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		other, err := deepCopy(laptop)
+		if err != nil {
+			return err
+		}
+		err = found(other, scores[laptop.GetId()])
+		if err != nil {
+			return err
+		}
 	}
-	return true
+	return nil
 }
+
+// selectLaptops returns a snapshot of the laptops matching query and their text search scores.
+// stored laptops are never modified so they can be used after the lock is released
+func (store *InMemoryLaptopStore) selectLaptops(
+	ctx context.Context,
+	query *SearchQuery,
+) ([]*pb.Laptop, map[string]float64, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var scores map[string]float64
+	var ids []string
+	indexed := false
+	if query.Text != "" {
+		scores = store.index.text.Search(query.Text)
+		for laptopID := range scores {
+			ids = append(ids, laptopID)
+		}
+		indexed = true
+	} else {
+		ids, indexed = store.index.Candidates(query.Filter)
+	}
+
+	matched := []*pb.Laptop{}
+	selector := newLaptopSelector(query.order(scores), query.Limit)
+	visit := func(laptop *pb.Laptop) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !query.match(laptop) {
+			return nil
+		}
+		if query.sorted() {
+			selector.Add(laptop)
+		} else {
+			matched = append(matched, laptop)
+		}
+		return nil
+	}
+
+	if indexed {
+		for _, laptopID := range ids {
+			if err := visit(store.data[laptopID]); err != nil {
+				return nil, nil, err
+			}
+		}
+	} else {
+		for _, laptop := range store.data {
+			if err := visit(laptop); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if query.sorted() {
+		return selector.Laptops(), scores, nil
+	}
+	return matched, scores, nil
+}
+
+func (store *InMemoryLaptopStore) Aggregate(
+	ctx context.Context,
+	filter *pb.Filter,
+	histograms []*pb.HistogramSpec,
+) (*pb.AggregateLaptopsResponse, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	aggregator := newLaptopAggregator(histograms)
+	for _, laptop := range store.data {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if isQualified(filter, laptop) {
+			aggregator.Add(laptop)
+		}
+	}
+	return aggregator.Result()
+}
+
+func (store *InMemoryLaptopStore) Watch(
+	ctx context.Context,
+	resumeToken string,
+	found func(event *pb.LaptopEvent) error,
+) error {
+	return store.feed.Watch(ctx, resumeToken, found)
+}
+
 func toBit(memory *pb.Memory) uint64 {
 	value := memory.GetValue()
 	switch memory.GetUnit() {
@@ -120,7 +594,7 @@ func toBit(memory *pb.Memory) uint64 {
 func deepCopy(laptop *pb.Laptop) (*pb.Laptop, error) {
 	other := &pb.Laptop{}
 	//深拷贝
-	err := copier.Copy(other, laptop)
+	err := copier.CopyWithOption(other, laptop, copier.Option{DeepCopy: true})
 	if err != nil {
 		return nil, fmt.Errorf("cannot copy laptop data:%w", err)
 	}
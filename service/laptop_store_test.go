@@ -0,0 +1,121 @@
+package service_test
+
+import (
+	"context"
+	"math/rand"
+	"proto_demo/pb"
+	"proto_demo/sample"
+	"proto_demo/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestInMemoryLaptopStoreSearchIndexRandom(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	laptops := map[string]*pb.Laptop{}
+	for i := 0; i < 300; i++ {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = float64(rand.Intn(30) * 100)
+		laptop.Ram = &pb.Memory{Value: uint64(4 << rand.Intn(4)), Unit: pb.Memory_GIGABYTE}
+		require.NoError(t, store.Save(laptop))
+		laptops[laptop.Id] = laptop
+	}
+	for id, laptop := range laptops {
+		switch rand.Intn(3) {
+		case 0:
+			require.NoError(t, store.Delete(id, false))
+			delete(laptops, id)
+		case 1:
+			laptop.PriceUsd = float64(rand.Intn(30) * 100)
+			_, err := store.Update(laptop, &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}})
+			require.NoError(t, err)
+		}
+	}
+
+	filter := &pb.Filter{
+		MinPriceUsd: 1000,
+		MaxPriceUsd: proto.Float64(2000),
+		MinCpuCores: 4,
+		MinRam:      &pb.Memory{Value: 16, Unit: pb.Memory_GIGABYTE},
+	}
+	expected := []string{}
+	for id, laptop := range laptops {
+		if laptop.PriceUsd >= 1000 && laptop.PriceUsd <= 2000 && laptop.Cpu.NumberCores >= 4 && laptop.Ram.Value >= 16 {
+			expected = append(expected, id)
+		}
+	}
+	ids := []string{}
+	err := store.Search(context.Background(), &service.SearchQuery{Filter: filter}, func(laptop *pb.Laptop, score float64) error {
+		ids = append(ids, laptop.GetId())
+		return nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, expected, ids)
+}
+
+func TestInMemoryLaptopStoreWatchWrapsEventLog(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan *pb.LaptopEvent, 1)
+	done := make(chan error)
+	go func() {
+		done <- store.Watch(ctx, "", func(event *pb.LaptopEvent) error {
+			select {
+			case first <- event:
+			default:
+			}
+			cancel()
+			return nil
+		})
+	}()
+	var token string
+	for token == "" {
+		require.NoError(t, store.Save(sample.NewLaptop()))
+		select {
+		case event := <-first:
+			token = event.GetResumeToken()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	// the log keeps 1000 events, the oldest ones are overwritten in place
+	ids := []string{}
+	for i := 0; i < 999; i++ {
+		laptop := sample.NewLaptop()
+		require.NoError(t, store.Save(laptop))
+		ids = append(ids, laptop.GetId())
+	}
+	resume := func(token string) ([]string, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		received := []string{}
+		err := store.Watch(ctx, token, func(event *pb.LaptopEvent) error {
+			received = append(received, event.GetLaptop().GetId())
+			if event.GetLaptop().GetId() == ids[len(ids)-1] {
+				cancel()
+			}
+			return nil
+		})
+		return received, err
+	}
+	received, err := resume(token)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, ids, received)
+
+	for i := 0; i < 2; i++ {
+		laptop := sample.NewLaptop()
+		require.NoError(t, store.Save(laptop))
+		ids = append(ids, laptop.GetId())
+	}
+	_, err = resume(token)
+	require.ErrorIs(t, err, service.ErrResumeTokenExpired)
+}
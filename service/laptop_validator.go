@@ -0,0 +1,201 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"proto_demo/pb"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ValidationError is returned when a laptop has invalid fields
+type ValidationError struct {
+	Violations []*errdetails.BadRequest_FieldViolation
+}
+
+func (err *ValidationError) Error() string {
+	fields := make([]string, len(err.Violations))
+	for i, violation := range err.Violations {
+		fields[i] = violation.GetField() + " " + violation.GetDescription()
+	}
+	return "invalid laptop: " + strings.Join(fields, ", ")
+}
+
+// GRPCStatus returns an InvalidArgument status with the violations as BadRequest details
+func (err *ValidationError) GRPCStatus() *status.Status {
+	return newStatus(
+		codes.InvalidArgument,
+		pb.ErrorReason_INVALID_LAPTOP,
+		err.Error(),
+		nil,
+		&errdetails.BadRequest{FieldViolations: err.Violations},
+	)
+}
+
+type laptopViolation struct {
+	violation *errdetails.BadRequest_FieldViolation
+	// fields are the fields checked by the rule, the reported field is the first one
+	fields []string
+}
+
+// laptopValidator collects the violations of a laptop and its sub-messages
+type laptopValidator struct {
+	violations []laptopViolation
+}
+
+func (validator *laptopValidator) check(ok bool, field string, format string, args ...any) {
+	validator.compare(ok, field, "", format, args...)
+}
+
+// compare is check for a rule between field and other, the violation is reported on field
+func (validator *laptopValidator) compare(ok bool, field string, other string, format string, args ...any) {
+	if ok {
+		return
+	}
+	fields := []string{field}
+	if other != "" {
+		fields = append(fields, other)
+	}
+	validator.violations = append(validator.violations, laptopViolation{
+		violation: &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: fmt.Sprintf(format, args...),
+		},
+		fields: fields,
+	})
+}
+
+// ValidateLaptop checks the specs of laptop, it returns a *ValidationError listing every invalid field
+func ValidateLaptop(laptop *pb.Laptop) error {
+	return validateUpdatedLaptop(laptop, nil)
+}
+
+// validateUpdatedLaptop checks the fields of laptop that are changed by paths, or every field if paths is empty.
+// the other fields may have been saved before the validation existed
+func validateUpdatedLaptop(laptop *pb.Laptop, paths []string) error {
+	validator := &laptopValidator{}
+	validator.laptop(laptop)
+
+	violations := []*errdetails.BadRequest_FieldViolation{}
+	for _, v := range validator.violations {
+		if len(paths) == 0 || updatesAny(paths, v.fields) {
+			violations = append(violations, v.violation)
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// updatesAny returns true if one of paths changes one of fields
+func updatesAny(paths []string, fields []string) bool {
+	for _, path := range paths {
+		for _, field := range fields {
+			if fieldInPath(field, path) || fieldInPath(path, field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldInPath returns true if field is path or one of its sub-fields
+func fieldInPath(field string, path string) bool {
+	if !strings.HasPrefix(field, path) {
+		return false
+	}
+	rest := field[len(path):]
+	return rest == "" || rest[0] == '.' || rest[0] == '['
+}
+
+func (validator *laptopValidator) laptop(laptop *pb.Laptop) {
+	if laptop == nil {
+		validator.check(false, "laptop", "is required")
+		return
+	}
+	validator.check(laptop.GetBrand() != "", "brand", "is required")
+	validator.check(laptop.GetName() != "", "name", "is required")
+	validator.check(laptop.GetPriceUsd() >= 0, "price_usd", "must not be negative")
+
+	switch weight := laptop.GetWeight().(type) {
+	case *pb.Laptop_WeightKg:
+		validator.check(weight.WeightKg > 0, "weight_kg", "must be positive")
+	case *pb.Laptop_WeightLb:
+		validator.check(weight.WeightLb > 0, "weight_lb", "must be positive")
+	}
+
+	validator.cpu("cpu", laptop.GetCpu())
+	validator.memory("ram", laptop.GetRam())
+	for i, gpu := range laptop.GetGpus() {
+		validator.gpu(fmt.Sprintf("gpus[%d]", i), gpu)
+	}
+	for i, storage := range laptop.GetStorages() {
+		validator.storage(fmt.Sprintf("storages[%d]", i), storage)
+	}
+	validator.screen("screen", laptop.GetScreen())
+}
+
+func (validator *laptopValidator) cpu(field string, cpu *pb.CPU) {
+	if cpu == nil {
+		validator.check(false, field, "is required")
+		return
+	}
+	validator.check(cpu.GetNumberCores() > 0, field+".number_cores", "must be positive")
+	validator.compare(
+		cpu.GetNumberThreads() >= cpu.GetNumberCores(),
+		field+".number_threads", field+".number_cores", "must not be less than number_cores (%d)", cpu.GetNumberCores(),
+	)
+	validator.frequency(field, cpu.GetMinGhz(), cpu.GetMaxGhz())
+}
+
+func (validator *laptopValidator) gpu(field string, gpu *pb.GPU) {
+	validator.frequency(field, gpu.GetMinGhz(), gpu.GetMaxGhz())
+	validator.memory(field+".memory", gpu.GetMemory())
+}
+
+func (validator *laptopValidator) frequency(field string, minGhz float64, maxGhz float64) {
+	validator.check(minGhz > 0, field+".min_ghz", "must be positive")
+	validator.compare(maxGhz >= minGhz, field+".max_ghz", field+".min_ghz", "must not be less than min_ghz (%g)", minGhz)
+}
+
+func (validator *laptopValidator) memory(field string, memory *pb.Memory) {
+	if memory == nil {
+		validator.check(false, field, "is required")
+		return
+	}
+	validator.check(memory.GetValue() > 0, field+".value", "must be positive")
+	validator.check(memory.GetUnit() != pb.Memory_UNKOWN, field+".unit", "must be set")
+	if memory.GetUnit() != pb.Memory_UNKOWN {
+		maxValue := maxMemoryValue(memory.GetUnit())
+		validator.check(memory.GetValue() <= maxValue, field+".value", "must not exceed %d %s", maxValue, memory.GetUnit())
+	}
+}
+
+// maxMemoryValue is the largest value of unit whose size in bits fits in an int64, as the stores save the sizes
+func maxMemoryValue(unit pb.Memory_Unit) uint64 {
+	return math.MaxInt64 / toBit(&pb.Memory{Value: 1, Unit: unit})
+}
+
+func (validator *laptopValidator) storage(field string, storage *pb.Storage) {
+	validator.check(storage.GetDriver() != pb.Storage_UNKNOWN, field+".driver", "must be set")
+	validator.memory(field+".memory", storage.GetMemory())
+}
+
+func (validator *laptopValidator) screen(field string, screen *pb.Screen) {
+	if screen == nil {
+		validator.check(false, field, "is required")
+		return
+	}
+	validator.check(screen.GetSizeInch() > 0, field+".size_inch", "must be positive")
+	resolution := screen.GetResolution()
+	if resolution == nil {
+		validator.check(false, field+".resolution", "is required")
+		return
+	}
+	validator.check(resolution.GetWidth() > 0, field+".resolution.width", "must be positive")
+	validator.check(resolution.GetHeight() > 0, field+".resolution.height", "must be positive")
+}
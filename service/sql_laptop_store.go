@@ -0,0 +1,872 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"proto_demo/pb"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// sqlQueryer is a *sql.DB or a *sql.Tx
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// laptopTables joins a laptop with its CPU and screen, the filter conditions use the aliases l, c and s
+const laptopTables = `laptops l
+	LEFT JOIN cpus c ON c.laptop_id = l.id
+	LEFT JOIN screens s ON s.laptop_id = l.id`
+
+// sqlWeightKg is the weight of a laptop of laptopTables in kilograms, as weightKg
+var sqlWeightKg = fmt.Sprintf("COALESCE(l.weight_kg, l.weight_lb * %v)", kgPerLb)
+
+// SQLLaptopStore keeps the laptops in normalised tables of a SQLStore
+type SQLLaptopStore struct {
+	// mutex serializes the changes so that the events have the same order as the database
+	mutex sync.Mutex
+	db    *sql.DB
+	feed  *changeFeed
+}
+
+func newSQLLaptopStore(db *sql.DB) *SQLLaptopStore {
+	return &SQLLaptopStore{
+		db:   db,
+		feed: newChangeFeed(eventLogSize),
+	}
+}
+
+// sqlFilter translates filter into a WHERE clause on laptopTables and its parameters,
+// it selects the same laptops as isQualified, except that SQLite only ignores the case of ASCII letters
+func sqlFilter(filter *pb.Filter) (string, []any) {
+	conditions := []string{"l.deleted = 0"}
+	args := []any{}
+	add := func(condition string, values ...any) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+	in := func(column string, values []any) {
+		add(fmt.Sprintf("%s IN (%s)", column, placeholders(len(values))), values...)
+	}
+
+	if maxPrice, ok := maxPriceUsd(filter); ok {
+		add("l.price_usd <= ?", maxPrice)
+	}
+	if filter.GetMinPriceUsd() > 0 {
+		add("l.price_usd >= ?", filter.GetMinPriceUsd())
+	}
+	if filter.GetMinCpuCores() > 0 {
+		add("c.number_cores >= ?", filter.GetMinCpuCores())
+	}
+	if filter.GetMinCpuGhz() > 0 {
+		add("c.min_ghz >= ?", filter.GetMinCpuGhz())
+	}
+	if toBit(filter.GetMinRam()) > 0 {
+		add("l.ram_bits >= ?", int64(toBit(filter.GetMinRam())))
+	}
+	if len(filter.GetBrands()) > 0 {
+		in("l.brand COLLATE NOCASE", stringArgs(filter.GetBrands()))
+	}
+	if len(filter.GetNames()) > 0 {
+		in("l.name COLLATE NOCASE", stringArgs(filter.GetNames()))
+	}
+
+	if len(filter.GetGpuBrands()) > 0 || toBit(filter.GetMinGpuMemory()) > 0 {
+		gpu := "SELECT 1 FROM gpus g WHERE g.laptop_id = l.id AND g.memory_bits >= ?"
+		gpuArgs := []any{int64(toBit(filter.GetMinGpuMemory()))}
+		if len(filter.GetGpuBrands()) > 0 {
+			gpu += fmt.Sprintf(" AND g.brand COLLATE NOCASE IN (%s)", placeholders(len(filter.GetGpuBrands())))
+			gpuArgs = append(gpuArgs, stringArgs(filter.GetGpuBrands())...)
+		}
+		add("EXISTS ("+gpu+")", gpuArgs...)
+	}
+	if toBit(filter.GetMinSsd()) > 0 {
+		add(
+			"(SELECT COALESCE(SUM(st.memory_bits), 0) FROM storages st WHERE st.laptop_id = l.id AND st.driver = ?) >= ?",
+			int32(pb.Storage_SSD), int64(toBit(filter.GetMinSsd())),
+		)
+	}
+
+	if filter.GetMinScreenSizeInch() > 0 {
+		add("COALESCE(s.size_inch, 0) >= ?", float64(filter.GetMinScreenSizeInch()))
+	}
+	if filter.GetMaxScreenSizeInch() > 0 {
+		add("COALESCE(s.size_inch, 0) <= ?", float64(filter.GetMaxScreenSizeInch()))
+	}
+	if filter.GetMinResolution().GetWidth() > 0 {
+		add("COALESCE(s.resolution_width, 0) >= ?", filter.GetMinResolution().GetWidth())
+	}
+	if filter.GetMinResolution().GetHeight() > 0 {
+		add("COALESCE(s.resolution_height, 0) >= ?", filter.GetMinResolution().GetHeight())
+	}
+	if len(filter.GetPanels()) > 0 {
+		panels := []any{}
+		for _, panel := range filter.GetPanels() {
+			panels = append(panels, int32(panel))
+		}
+		in("COALESCE(s.panel, 0)", panels)
+	}
+
+	if filter != nil && filter.KeyboardBacklit != nil {
+		add("COALESCE(l.keyboard_backlit, 0) = ?", filter.GetKeyboardBacklit())
+	}
+	if len(filter.GetKeyboardLayouts()) > 0 {
+		layouts := []any{}
+		for _, layout := range filter.GetKeyboardLayouts() {
+			layouts = append(layouts, int32(layout))
+		}
+		in("COALESCE(l.keyboard_layout, 0)", layouts)
+	}
+
+	if filter.GetMinWeightKg() > 0 || filter.GetMaxWeightKg() > 0 {
+		add(sqlWeightKg+" >= ?", filter.GetMinWeightKg())
+	}
+	if filter.GetMaxWeightKg() > 0 {
+		add(sqlWeightKg+" <= ?", filter.GetMaxWeightKg())
+	}
+	if filter.GetMinReleaseYear() > 0 {
+		add("l.release_year >= ?", filter.GetMinReleaseYear())
+	}
+	if filter.GetMaxReleaseYear() > 0 {
+		add("l.release_year <= ?", filter.GetMaxReleaseYear())
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+func stringArgs(values []string) []any {
+	args := make([]any, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+// memoryColumns returns the value and the unit of memory, or NULL if it's nil
+func memoryColumns(memory *pb.Memory) (any, any) {
+	if memory == nil {
+		return nil, nil
+	}
+	return int64(memory.GetValue()), int32(memory.GetUnit())
+}
+
+func memoryFromColumns(value sql.NullInt64, unit sql.NullInt32) *pb.Memory {
+	if !value.Valid {
+		return nil
+	}
+	return &pb.Memory{Value: uint64(value.Int64), Unit: pb.Memory_Unit(unit.Int32)}
+}
+
+func insertLaptop(ctx context.Context, db sqlQueryer, laptop *pb.Laptop, deleted bool) error {
+	ramValue, ramUnit := memoryColumns(laptop.GetRam())
+	var layout, backlit any
+	if keyboard := laptop.GetKeyboard(); keyboard != nil {
+		layout, backlit = int32(keyboard.GetLayout()), keyboard.GetBacklit()
+	}
+	var weightKg, weightLb any
+	switch w := laptop.GetWeight().(type) {
+	case *pb.Laptop_WeightKg:
+		weightKg = w.WeightKg
+	case *pb.Laptop_WeightLb:
+		weightLb = w.WeightLb
+	}
+	var seconds, nanos any
+	if updateAt := laptop.GetUpdateAt(); updateAt != nil {
+		seconds, nanos = updateAt.GetSeconds(), updateAt.GetNanos()
+	}
+
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO laptops (
+			id, brand, name, ram_value, ram_unit, ram_bits, keyboard_layout, keyboard_backlit,
+			weight_kg, weight_lb, price_usd, release_year, update_at_seconds, update_at_nanos, revision, deleted
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		laptop.GetId(), laptop.GetBrand(), laptop.GetName(), ramValue, ramUnit, int64(toBit(laptop.GetRam())), layout, backlit,
+		weightKg, weightLb, laptop.GetPriceUsd(), laptop.GetReleaseYear(), seconds, nanos, int64(laptop.GetRevision()), deleted,
+	)
+	if err != nil {
+		return err
+	}
+
+	if cpu := laptop.GetCpu(); cpu != nil {
+		_, err = db.ExecContext(ctx,
+			`INSERT INTO cpus (laptop_id, brand, name, number_cores, number_threads, min_ghz, max_ghz)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			laptop.GetId(), cpu.GetBrand(), cpu.GetName(), cpu.GetNumberCores(), cpu.GetNumberThreads(), cpu.GetMinGhz(), cpu.GetMaxGhz(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for i, gpu := range laptop.GetGpus() {
+		value, unit := memoryColumns(gpu.GetMemory())
+		_, err = db.ExecContext(ctx,
+			`INSERT INTO gpus (laptop_id, position, brand, name, min_ghz, max_ghz, memory_value, memory_unit, memory_bits)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			laptop.GetId(), i, gpu.GetBrand(), gpu.GetName(), gpu.GetMinGhz(), gpu.GetMaxGhz(), value, unit, int64(toBit(gpu.GetMemory())),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for i, storage := range laptop.GetStorages() {
+		value, unit := memoryColumns(storage.GetMemory())
+		_, err = db.ExecContext(ctx,
+			`INSERT INTO storages (laptop_id, position, driver, memory_value, memory_unit, memory_bits)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			laptop.GetId(), i, int32(storage.GetDriver()), value, unit, int64(toBit(storage.GetMemory())),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if screen := laptop.GetScreen(); screen != nil {
+		var width, height any
+		if resolution := screen.GetResolution(); resolution != nil {
+			width, height = resolution.GetWidth(), resolution.GetHeight()
+		}
+		_, err = db.ExecContext(ctx,
+			`INSERT INTO screens (laptop_id, size_inch, resolution_width, resolution_height, panel, multitouch)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			laptop.GetId(), float64(screen.GetSizeInch()), width, height, int32(screen.GetPanel()), screen.GetMultitouch(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlOrder translates order into an ORDER BY clause on laptopTables and a condition selecting the laptops after the cursor,
+// ok is false if the sort values aren't stored in the tables
+func sqlOrder(order LaptopOrder, after *LaptopCursor) (orderBy string, condition string, args []any, ok bool) {
+	if after == nil {
+		after = &LaptopCursor{}
+	}
+	columns := []string{}
+	switch order.Field {
+	case pb.SortField_ID:
+	case pb.SortField_PRICE:
+		columns = append(columns, "l.price_usd")
+		args = append(args, after.Value)
+	case pb.SortField_RELEASE_YEAR:
+		columns = append(columns, "l.release_year")
+		args = append(args, int64(after.Value))
+	case pb.SortField_UPDATE_AT:
+		//和LaptopOrder.Cursor一样, 没有更新时间的笔记本的值是0
+		columns = append(columns, "COALESCE(l.update_at_seconds, 0)", "COALESCE(l.update_at_nanos, 0)")
+		args = append(args, int64(after.Value), after.Nanos)
+	default:
+		return "", "", nil, false
+	}
+	columns = append(columns, "l.id")
+	args = append(args, after.ID)
+
+	direction, operator := "", ">"
+	if order.Descending {
+		direction, operator = " DESC", "<"
+	}
+	orderBy = strings.Join(columns, direction+", ") + direction
+	condition = fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), operator, placeholders(len(columns)))
+	return orderBy, condition, args, true
+}
+
+// selectLaptops returns the laptops of laptopTables matching the WHERE clause, sorted by ID
+func selectLaptops(ctx context.Context, db sqlQueryer, where string, args ...any) ([]*pb.Laptop, error) {
+	return selectLaptopPage(ctx, db, where, args, "l.id", 0)
+}
+
+// selectLaptopPage returns the first limit laptops of laptopTables matching the WHERE clause in the order of orderBy,
+// or all of them if limit is 0
+func selectLaptopPage(ctx context.Context, db sqlQueryer, where string, args []any, orderBy string, limit int) ([]*pb.Laptop, error) {
+	clauses := " WHERE " + where + " ORDER BY " + orderBy
+	if limit > 0 {
+		clauses += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := db.QueryContext(ctx,
+		`SELECT l.id, l.brand, l.name, l.ram_value, l.ram_unit, l.keyboard_layout, l.keyboard_backlit,
+			l.weight_kg, l.weight_lb, l.price_usd, l.release_year, l.update_at_seconds, l.update_at_nanos, l.revision,
+			c.laptop_id, c.brand, c.name, c.number_cores, c.number_threads, c.min_ghz, c.max_ghz,
+			s.laptop_id, s.size_inch, s.resolution_width, s.resolution_height, s.panel, s.multitouch
+		FROM `+laptopTables+clauses,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	laptops := []*pb.Laptop{}
+	byID := make(map[string]*pb.Laptop)
+	for rows.Next() {
+		var (
+			laptop             pb.Laptop
+			ramValue           sql.NullInt64
+			ramUnit            sql.NullInt32
+			layout             sql.NullInt32
+			backlit            sql.NullBool
+			weightKg, weightLb sql.NullFloat64
+			seconds            sql.NullInt64
+			nanos              sql.NullInt32
+			revision           int64
+			cpuID              sql.NullString
+			cpuBrand, cpuName  sql.NullString
+			cores, threads     sql.NullInt32
+			minGhz, maxGhz     sql.NullFloat64
+			screenID           sql.NullString
+			size               sql.NullFloat64
+			width, height      sql.NullInt32
+			panel              sql.NullInt32
+			multitouch         sql.NullBool
+		)
+		err := rows.Scan(
+			&laptop.Id, &laptop.Brand, &laptop.Name, &ramValue, &ramUnit, &layout, &backlit,
+			&weightKg, &weightLb, &laptop.PriceUsd, &laptop.ReleaseYear, &seconds, &nanos, &revision,
+			&cpuID, &cpuBrand, &cpuName, &cores, &threads, &minGhz, &maxGhz,
+			&screenID, &size, &width, &height, &panel, &multitouch,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		laptop.Ram = memoryFromColumns(ramValue, ramUnit)
+		if layout.Valid {
+			laptop.Keyboard = &pb.Keyboard{Layout: pb.Keyboard_Layout(layout.Int32), Backlit: backlit.Bool}
+		}
+		if weightKg.Valid {
+			laptop.Weight = &pb.Laptop_WeightKg{WeightKg: weightKg.Float64}
+		} else if weightLb.Valid {
+			laptop.Weight = &pb.Laptop_WeightLb{WeightLb: weightLb.Float64}
+		}
+		if seconds.Valid {
+			laptop.UpdateAt = &timestamppb.Timestamp{Seconds: seconds.Int64, Nanos: nanos.Int32}
+		}
+		laptop.Revision = uint64(revision)
+		if cpuID.Valid {
+			laptop.Cpu = &pb.CPU{
+				Brand:         cpuBrand.String,
+				Name:          cpuName.String,
+				NumberCores:   uint32(cores.Int32),
+				NumberThreads: uint32(threads.Int32),
+				MinGhz:        minGhz.Float64,
+				MaxGhz:        maxGhz.Float64,
+			}
+		}
+		if screenID.Valid {
+			laptop.Screen = &pb.Screen{
+				SizeInch:   float32(size.Float64),
+				Panel:      pb.Screen_Panel(panel.Int32),
+				Multitouch: multitouch.Bool,
+			}
+			if width.Valid {
+				laptop.Screen.Resolution = &pb.Screen_Resolution{Width: uint32(width.Int32), Height: uint32(height.Int32)}
+			}
+		}
+		laptops = append(laptops, &laptop)
+		byID[laptop.Id] = &laptop
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(laptops) == 0 {
+		return laptops, nil
+	}
+
+	ids := "SELECT l.id FROM " + laptopTables + clauses
+	err = selectChildren(ctx, db,
+		`SELECT laptop_id, brand, name, min_ghz, max_ghz, memory_value, memory_unit
+		FROM gpus WHERE laptop_id IN (`+ids+`) ORDER BY laptop_id, position`,
+		args,
+		func(rows *sql.Rows) error {
+			var (
+				laptopID string
+				gpu      pb.GPU
+				value    sql.NullInt64
+				unit     sql.NullInt32
+			)
+			err := rows.Scan(&laptopID, &gpu.Brand, &gpu.Name, &gpu.MinGhz, &gpu.MaxGhz, &value, &unit)
+			if err != nil {
+				return err
+			}
+			gpu.Memory = memoryFromColumns(value, unit)
+			if laptop := byID[laptopID]; laptop != nil {
+				laptop.Gpus = append(laptop.Gpus, &gpu)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = selectChildren(ctx, db,
+		`SELECT laptop_id, driver, memory_value, memory_unit
+		FROM storages WHERE laptop_id IN (`+ids+`) ORDER BY laptop_id, position`,
+		args,
+		func(rows *sql.Rows) error {
+			var (
+				laptopID string
+				driver   int32
+				value    sql.NullInt64
+				unit     sql.NullInt32
+			)
+			err := rows.Scan(&laptopID, &driver, &value, &unit)
+			if err != nil {
+				return err
+			}
+			storage := &pb.Storage{Driver: pb.Storage_Driver(driver), Memory: memoryFromColumns(value, unit)}
+			if laptop := byID[laptopID]; laptop != nil {
+				laptop.Storages = append(laptop.Storages, storage)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return laptops, nil
+}
+
+func selectChildren(ctx context.Context, db sqlQueryer, query string, args []any, scan func(rows *sql.Rows) error) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// findLaptop returns the laptop with the ID in the deleted state, or nil
+func findLaptop(ctx context.Context, db sqlQueryer, id string, deleted bool) (*pb.Laptop, error) {
+	laptops, err := selectLaptops(ctx, db, "l.id = ? AND l.deleted = ?", id, deleted)
+	if err != nil || len(laptops) == 0 {
+		return nil, err
+	}
+	return laptops[0], nil
+}
+
+func (store *SQLLaptopStore) Save(laptop *pb.Laptop) error {
+	ctx := context.Background()
+	other, err := deepCopy(laptop)
+	if err != nil {
+		return err
+	}
+	other.Revision = 1
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err = withTx(ctx, store.db, func(tx *sql.Tx) error {
+		exists := 0
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM laptops WHERE id = ?", other.GetId()).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrAlreadyExists
+		}
+		return insertLaptop(ctx, tx, other, false)
+	})
+	if err != nil {
+		return err
+	}
+	store.feed.Publish(pb.LaptopEvent_CREATED, other)
+	return nil
+}
+
+func (store *SQLLaptopStore) SaveAll(laptops []*pb.Laptop) error {
+	ctx := context.Background()
+	others := make([]*pb.Laptop, len(laptops))
+	for i, laptop := range laptops {
+		other, err := deepCopy(laptop)
+		if err != nil {
+			return &BatchError{Index: i, Err: err}
+		}
+		other.Revision = 1
+		others[i] = other
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err := withTx(ctx, store.db, func(tx *sql.Tx) error {
+		for i, other := range others {
+			exists := 0
+			err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM laptops WHERE id = ?", other.GetId()).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if exists > 0 {
+				return &BatchError{Index: i, Err: ErrAlreadyExists}
+			}
+			err = insertLaptop(ctx, tx, other, false)
+			if err != nil {
+				return &BatchError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		store.feed.Publish(pb.LaptopEvent_CREATED, other)
+	}
+	return nil
+}
+
+func (store *SQLLaptopStore) Find(id string) (*pb.Laptop, error) {
+	return findLaptop(context.Background(), store.db, id, false)
+}
+
+func (store *SQLLaptopStore) Update(laptop *pb.Laptop, mask *fieldmaskpb.FieldMask) (*pb.Laptop, error) {
+	err := ValidateUpdateMask(mask)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var old, updated *pb.Laptop
+	err = withTx(ctx, store.db, func(tx *sql.Tx) error {
+		var err error
+		old, err = findLaptop(ctx, tx, laptop.GetId(), false)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return ErrNotFound
+		}
+		updated, err = updateLaptop(old, laptop, mask)
+		if err != nil {
+			return err
+		}
+		//子表通过外键级联删除
+		_, err = tx.ExecContext(ctx, "DELETE FROM laptops WHERE id = ?", old.GetId())
+		if err != nil {
+			return err
+		}
+		return insertLaptop(ctx, tx, updated, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+	store.feed.PublishUpdate(old, updated)
+	return deepCopy(updated)
+}
+
+func (store *SQLLaptopStore) Delete(id string, soft bool) error {
+	ctx := context.Background()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var deleted *pb.Laptop
+	err := withTx(ctx, store.db, func(tx *sql.Tx) error {
+		laptop, err := findLaptop(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if laptop == nil && soft {
+			return ErrNotFound
+		}
+		deleted = laptop
+
+		query := "DELETE FROM laptops WHERE id = ?"
+		if soft {
+			query = "UPDATE laptops SET deleted = 1 WHERE id = ?"
+		}
+		res, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+		//硬删除可以清除已经软删除的laptop
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if deleted != nil {
+		store.feed.Publish(pb.LaptopEvent_DELETED, deleted)
+	}
+	return nil
+}
+
+func (store *SQLLaptopStore) Restore(id string) (*pb.Laptop, error) {
+	ctx := context.Background()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var restored *pb.Laptop
+	err := withTx(ctx, store.db, func(tx *sql.Tx) error {
+		laptop, err := findLaptop(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+		if laptop == nil {
+			return ErrNotFound
+		}
+		laptop.UpdateAt = timestamppb.Now()
+		laptop.Revision++
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE laptops SET deleted = 0, revision = ?, update_at_seconds = ?, update_at_nanos = ? WHERE id = ?",
+			int64(laptop.GetRevision()), laptop.GetUpdateAt().GetSeconds(), laptop.GetUpdateAt().GetNanos(), id,
+		)
+		if err != nil {
+			return err
+		}
+		restored = laptop
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	store.feed.Publish(pb.LaptopEvent_CREATED, restored)
+	return deepCopy(restored)
+}
+
+func (store *SQLLaptopStore) List(
+	ctx context.Context,
+	order LaptopOrder,
+	after *LaptopCursor,
+	limit int,
+) ([]*pb.Laptop, error) {
+	orderBy, condition, args, ok := sqlOrder(order, after)
+	if ok {
+		where := "l.deleted = 0"
+		if after != nil {
+			where += " AND " + condition
+		}
+		return selectLaptopPage(ctx, store.db, where, args, orderBy, limit)
+	}
+
+	// the ratings and the relevance aren't stored with the laptops, they're sorted here
+	laptops, err := selectLaptops(ctx, store.db, "l.deleted = 0")
+	if err != nil {
+		return nil, err
+	}
+
+	selector := newLaptopSelector(order, limit)
+	for _, laptop := range laptops {
+		if after == nil || order.Less(after, order.Cursor(laptop)) {
+			selector.Add(laptop)
+		}
+	}
+	return selector.Laptops(), nil
+}
+
+// Search selects the laptops matching the filter in SQL. without a predicate or a text, the laptops are sorted
+// and limited in SQL too, otherwise they're checked and sorted afterwards
+func (store *SQLLaptopStore) Search(
+	ctx context.Context,
+	query *SearchQuery,
+	found func(laptop *pb.Laptop, score float64) error,
+) error {
+	where, args := sqlFilter(query.Filter)
+	orderBy, _, _, ok := sqlOrder(query.Order, nil)
+	if query.Predicate != nil || query.Text != "" || !ok {
+		laptops, err := selectLaptops(ctx, store.db, where, args...)
+		if err != nil {
+			return err
+		}
+
+		results := newSearchResults(query)
+		for _, laptop := range laptops {
+			results.Add(laptop)
+		}
+		return results.Send(ctx, found)
+	}
+
+	laptops, err := selectLaptopPage(ctx, store.db, where, args, orderBy, query.Limit)
+	if err != nil {
+		return err
+	}
+	for _, laptop := range laptops {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := found(laptop, 0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlHistogramValues are the expressions of histogramValue on laptopTables, they are NULL if the value is unknown
+var sqlHistogramValues = map[pb.Histogram_Field]string{
+	pb.Histogram_PRICE_USD: "l.price_usd",
+	pb.Histogram_RAM_GB:    fmt.Sprintf("CAST(l.ram_bits AS REAL) / %d", gigabyte),
+	pb.Histogram_CPU_CORES: "COALESCE(c.number_cores, 0)",
+	pb.Histogram_CPU_GHZ:   "COALESCE(c.min_ghz, 0)",
+	pb.Histogram_SSD_GB: fmt.Sprintf(
+		"CAST((SELECT COALESCE(SUM(st.memory_bits), 0) FROM storages st WHERE st.laptop_id = l.id AND st.driver = %d) AS REAL) / %d",
+		int32(pb.Storage_SSD), gigabyte,
+	),
+	pb.Histogram_SCREEN_SIZE_INCH: "COALESCE(s.size_inch, 0)",
+	pb.Histogram_WEIGHT_KG:        sqlWeightKg,
+	pb.Histogram_RELEASE_YEAR:     "l.release_year",
+}
+
+// sqlFacet counts the laptops per value of a facet, enum names the values of an enum column
+type sqlFacet struct {
+	counts map[string]uint32
+	query  string
+	enum   func(value int32) string
+}
+
+// Aggregate counts the laptops with GROUP BY queries instead of loading them,
+// the counts are the same as the ones of laptopAggregator.Add
+func (store *SQLLaptopStore) Aggregate(
+	ctx context.Context,
+	filter *pb.Filter,
+	histograms []*pb.HistogramSpec,
+) (*pb.AggregateLaptopsResponse, error) {
+	where, args := sqlFilter(filter)
+	aggregator := newLaptopAggregator(histograms)
+
+	err := store.db.QueryRowContext(ctx,
+		"SELECT COUNT(*), COALESCE(MIN(l.price_usd), 0), COALESCE(MAX(l.price_usd), 0), COALESCE(SUM(l.price_usd), 0) FROM "+
+			laptopTables+" WHERE "+where,
+		args...,
+	).Scan(&aggregator.total, &aggregator.minPrice, &aggregator.maxPrice, &aggregator.sumPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	//gpu和storage每台laptop在每个值上只计数一次
+	matching := "SELECT l.id FROM " + laptopTables + " WHERE " + where
+	facets := []sqlFacet{
+		{counts: aggregator.brands, query: "SELECT l.brand, COUNT(*) FROM " + laptopTables + " WHERE " + where + " GROUP BY 1"},
+		{counts: aggregator.cpuBrands, query: "SELECT COALESCE(c.brand, ''), COUNT(*) FROM " + laptopTables + " WHERE " + where + " GROUP BY 1"},
+		{
+			counts: aggregator.screenPanels,
+			query:  "SELECT COALESCE(s.panel, 0), COUNT(*) FROM " + laptopTables + " WHERE " + where + " GROUP BY 1",
+			enum:   func(value int32) string { return pb.Screen_Panel(value).String() },
+		},
+		{
+			counts: aggregator.keyboardLayouts,
+			query:  "SELECT COALESCE(l.keyboard_layout, 0), COUNT(*) FROM " + laptopTables + " WHERE " + where + " GROUP BY 1",
+			enum:   func(value int32) string { return pb.Keyboard_Layout(value).String() },
+		},
+		{
+			counts: aggregator.gpuBrands,
+			query:  "SELECT g.brand, COUNT(DISTINCT g.laptop_id) FROM gpus g WHERE g.laptop_id IN (" + matching + ") GROUP BY 1",
+		},
+		{
+			counts: aggregator.storageDrivers,
+			query:  "SELECT st.driver, COUNT(DISTINCT st.laptop_id) FROM storages st WHERE st.laptop_id IN (" + matching + ") GROUP BY 1",
+			enum:   func(value int32) string { return pb.Storage_Driver(value).String() },
+		},
+	}
+	for _, facet := range facets {
+		err := selectFacet(ctx, store.db, facet, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, spec := range histograms {
+		err := selectHistogram(ctx, store.db, aggregator, i, spec, where, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return aggregator.Result()
+}
+
+func selectFacet(ctx context.Context, db sqlQueryer, facet sqlFacet, args []any) error {
+	rows, err := db.QueryContext(ctx, facet.query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			value  string
+			number int32
+			count  uint32
+		)
+		target := any(&value)
+		if facet.enum != nil {
+			target = &number
+		}
+		if err := rows.Scan(target, &count); err != nil {
+			return err
+		}
+		if facet.enum != nil {
+			value = facet.enum(number)
+		}
+		facet.counts[value] = count
+	}
+	return rows.Err()
+}
+
+// selectHistogram adds the buckets of the i-th histogram to aggregator,
+// it reads one bucket more than maxHistogramBuckets so that the aggregator reports ErrTooManyBuckets
+func selectHistogram(
+	ctx context.Context,
+	db sqlQueryer,
+	aggregator *laptopAggregator,
+	i int,
+	spec *pb.HistogramSpec,
+	where string,
+	args []any,
+) error {
+	value, ok := sqlHistogramValues[spec.GetField()]
+	if !ok {
+		return nil
+	}
+	rows, err := db.QueryContext(ctx,
+		fmt.Sprintf(
+			"SELECT floor((%s) / ?) AS bucket, COUNT(*) FROM %s WHERE %s AND (%s) IS NOT NULL GROUP BY bucket LIMIT %d",
+			value, laptopTables, where, value, maxHistogramBuckets+1,
+		),
+		append([]any{spec.GetInterval()}, args...)...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			index float64
+			count uint32
+		)
+		if err := rows.Scan(&index, &count); err != nil {
+			return err
+		}
+		aggregator.addBucket(i, index, count)
+	}
+	return rows.Err()
+}
+
+func (store *SQLLaptopStore) Watch(
+	ctx context.Context,
+	resumeToken string,
+	found func(event *pb.LaptopEvent) error,
+) error {
+	return store.feed.Watch(ctx, resumeToken, found)
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"database/sql"
+)
+
+// SQLRatingStore keeps the ratings in the ratings table of a SQLStore
+type SQLRatingStore struct {
+	db *sql.DB
+}
+
+func (store *SQLRatingStore) Add(laptopID string, score float64) (*Rating, error) {
+	rating := &Rating{}
+	err := store.db.QueryRow(
+		`INSERT INTO ratings (laptop_id, count, sum) VALUES (?, 1, ?)
+		ON CONFLICT (laptop_id) DO UPDATE SET count = count + 1, sum = sum + excluded.sum
+		RETURNING count, sum`,
+		laptopID, score,
+	).Scan(&rating.Count, &rating.Sum)
+	if err != nil {
+		return nil, err
+	}
+	return rating, nil
+}
+func (store *SQLRatingStore) Find(laptopID string) (*Rating, error) {
+	rating := &Rating{}
+	err := store.db.QueryRow("SELECT count, sum FROM ratings WHERE laptop_id = ?", laptopID).Scan(&rating.Count, &rating.Sum)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rating, nil
+}
+func (store *SQLRatingStore) Delete(laptopID string) error {
+	_, err := store.db.Exec("DELETE FROM ratings WHERE laptop_id = ?", laptopID)
+	return err
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqlMigrations are applied in order, the version of a migration is its index plus one.
+// a migration must never change once released, add a new one instead
+var sqlMigrations = []string{
+	`CREATE TABLE laptops (
+		id                TEXT PRIMARY KEY,
+		brand             TEXT NOT NULL,
+		name              TEXT NOT NULL,
+		ram_value         INTEGER,
+		ram_unit          INTEGER,
+		ram_bits          INTEGER NOT NULL,
+		keyboard_layout   INTEGER,
+		keyboard_backlit  INTEGER,
+		weight_kg         REAL,
+		weight_lb         REAL,
+		price_usd         REAL NOT NULL,
+		release_year      INTEGER NOT NULL,
+		update_at_seconds INTEGER,
+		update_at_nanos   INTEGER,
+		revision          INTEGER NOT NULL,
+		deleted           INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE cpus (
+		laptop_id      TEXT PRIMARY KEY REFERENCES laptops (id) ON DELETE CASCADE,
+		brand          TEXT NOT NULL,
+		name           TEXT NOT NULL,
+		number_cores   INTEGER NOT NULL,
+		number_threads INTEGER NOT NULL,
+		min_ghz        REAL NOT NULL,
+		max_ghz        REAL NOT NULL
+	);
+	CREATE TABLE gpus (
+		laptop_id    TEXT NOT NULL REFERENCES laptops (id) ON DELETE CASCADE,
+		position     INTEGER NOT NULL,
+		brand        TEXT NOT NULL,
+		name         TEXT NOT NULL,
+		min_ghz      REAL NOT NULL,
+		max_ghz      REAL NOT NULL,
+		memory_value INTEGER,
+		memory_unit  INTEGER,
+		memory_bits  INTEGER NOT NULL,
+		PRIMARY KEY (laptop_id, position)
+	);
+	CREATE TABLE storages (
+		laptop_id    TEXT NOT NULL REFERENCES laptops (id) ON DELETE CASCADE,
+		position     INTEGER NOT NULL,
+		driver       INTEGER NOT NULL,
+		memory_value INTEGER,
+		memory_unit  INTEGER,
+		memory_bits  INTEGER NOT NULL,
+		PRIMARY KEY (laptop_id, position)
+	);
+	CREATE TABLE screens (
+		laptop_id         TEXT PRIMARY KEY REFERENCES laptops (id) ON DELETE CASCADE,
+		size_inch         REAL NOT NULL,
+		resolution_width  INTEGER,
+		resolution_height INTEGER,
+		panel             INTEGER NOT NULL,
+		multitouch        INTEGER NOT NULL
+	);
+	CREATE TABLE ratings (
+		laptop_id TEXT PRIMARY KEY,
+		count     INTEGER NOT NULL,
+		sum       REAL NOT NULL
+	);
+	CREATE TABLE users (
+		username        TEXT PRIMARY KEY,
+		hashed_password TEXT NOT NULL,
+		role            TEXT NOT NULL
+	);`,
+	`CREATE INDEX laptops_price_usd ON laptops (deleted, price_usd);
+	CREATE INDEX laptops_ram_bits ON laptops (deleted, ram_bits);
+	CREATE INDEX cpus_number_cores ON cpus (number_cores);
+	CREATE INDEX cpus_min_ghz ON cpus (min_ghz);`,
+}
+
+// SQLStore is a SQLite database holding the laptops, the ratings and the users.
+// the three stores have methods with the same names, so each one is a separate type
+type SQLStore struct {
+	db      *sql.DB
+	Laptops *SQLLaptopStore
+	Ratings *SQLRatingStore
+	Users   *SQLUserStore
+}
+
+// NewSQLStore opens the database file at path, or a new database in memory if path is ":memory:",
+// and applies the missing migrations
+func NewSQLStore(path string) (*SQLStore, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open database: %w", err)
+	}
+	//SQLite一次只能有一个写入者,内存数据库每个连接都是独立的
+	db.SetMaxOpenConns(1)
+
+	err = migrate(context.Background(), db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLStore{
+		db:      db,
+		Laptops: newSQLLaptopStore(db),
+		Ratings: &SQLRatingStore{db: db},
+		Users:   &SQLUserStore{db: db},
+	}, nil
+}
+
+// Close closes the database
+func (store *SQLStore) Close() error {
+	return store.db.Close()
+}
+
+// SchemaVersion returns the version of the last migration applied
+func (store *SQLStore) SchemaVersion() (int, error) {
+	return schemaVersion(context.Background(), store.db)
+}
+
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	version := 0
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)")
+	if err != nil {
+		return fmt.Errorf("cannot create migration table: %w", err)
+	}
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("cannot read schema version: %w", err)
+	}
+	if version > len(sqlMigrations) {
+		return fmt.Errorf("database schema version %d is newer than %d", version, len(sqlMigrations))
+	}
+
+	for i := version; i < len(sqlMigrations); i++ {
+		err := withTx(ctx, db, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, sqlMigrations[i])
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES (?)", i+1)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("cannot apply migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// withTx runs fn in a transaction, which is committed if fn succeeds
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// placeholders returns n comma separated parameters
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// transientSQLError reports whether err is a busy, locked or full database, or the database is closed
+func transientSQLError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		//扩展错误码的低8位是主错误码
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_FULL:
+			return true
+		}
+		return false
+	}
+	//database/sql没有导出关闭数据库的错误
+	return errors.Is(err, sql.ErrConnDone) || strings.Contains(err.Error(), "sql: database is closed")
+}
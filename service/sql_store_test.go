@@ -0,0 +1,127 @@
+package service_test
+
+import (
+	"path/filepath"
+	"proto_demo/pb"
+	"proto_demo/sample"
+	"proto_demo/service"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestSQLStoreMigrations(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "pcbook.sqlite")
+	store, err := service.NewSQLStore(path)
+	require.NoError(t, err)
+	version, err := store.SchemaVersion()
+	require.NoError(t, err)
+	require.Greater(t, version, 0)
+
+	laptop := sample.NewLaptop()
+	err = store.Laptops.Save(laptop)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// reopening applies no migration and keeps the data
+	store, err = service.NewSQLStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	other, err := store.SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, version, other)
+
+	found, err := store.Laptops.Find(laptop.GetId())
+	require.NoError(t, err)
+	laptop.Revision = 1
+	requireSameLaptop(t, laptop, found)
+}
+
+func TestSQLLaptopStoreRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	store, err := service.NewSQLStore(":memory:")
+	require.NoError(t, err)
+	defer store.Close()
+
+	laptops := []*pb.Laptop{sample.NewLaptop(), {Id: sample.NewLaptop().GetId(), Brand: "Empty"}}
+	withLb := sample.NewLaptop()
+	withLb.Weight = &pb.Laptop_WeightLb{WeightLb: 4.2}
+	withLb.Screen.Resolution = nil
+	withLb.Keyboard = nil
+	withLb.Storages = append(withLb.Storages, &pb.Storage{Driver: pb.Storage_HDD})
+	laptops = append(laptops, withLb)
+
+	for _, laptop := range laptops {
+		err := store.Laptops.Save(laptop)
+		require.NoError(t, err)
+		found, err := store.Laptops.Find(laptop.GetId())
+		require.NoError(t, err)
+		laptop.Revision = 1
+		requireSameLaptop(t, laptop, found)
+	}
+
+	laptop := laptops[0]
+	laptop.Gpus = laptop.Gpus[:0]
+	laptop.Storages = append(laptop.Storages, sample.NewHDD())
+	updated, err := store.Laptops.Update(laptop, &fieldmaskpb.FieldMask{Paths: []string{"gpus", "storages"}})
+	require.NoError(t, err)
+	found, err := store.Laptops.Find(laptop.GetId())
+	require.NoError(t, err)
+	requireSameLaptop(t, updated, found)
+	require.Empty(t, found.GetGpus())
+
+	err = store.Laptops.Delete(laptop.GetId(), true)
+	require.NoError(t, err)
+	found, err = store.Laptops.Find(laptop.GetId())
+	require.NoError(t, err)
+	require.Nil(t, found)
+	err = store.Laptops.Save(laptop)
+	require.ErrorIs(t, err, service.ErrAlreadyExists)
+
+	restored, err := store.Laptops.Restore(laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, updated.GetRevision()+1, restored.GetRevision())
+
+	err = store.Laptops.Delete(laptop.GetId(), false)
+	require.NoError(t, err)
+	err = store.Laptops.Delete(laptop.GetId(), false)
+	require.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestSQLRatingAndUserStores(t *testing.T) {
+	t.Parallel()
+
+	store, err := service.NewSQLStore(":memory:")
+	require.NoError(t, err)
+	defer store.Close()
+
+	laptopID := sample.NewLaptop().GetId()
+	_, err = store.Ratings.Add(laptopID, 8)
+	require.NoError(t, err)
+	rating, err := store.Ratings.Add(laptopID, 9)
+	require.NoError(t, err)
+	require.Equal(t, &service.Rating{Count: 2, Sum: 17}, rating)
+	rating, err = store.Ratings.Find(laptopID)
+	require.NoError(t, err)
+	require.Equal(t, &service.Rating{Count: 2, Sum: 17}, rating)
+	require.NoError(t, store.Ratings.Delete(laptopID))
+	rating, err = store.Ratings.Find(laptopID)
+	require.NoError(t, err)
+	require.Nil(t, rating)
+
+	user, err := service.NewUser("admin1", "secret", "admin")
+	require.NoError(t, err)
+	require.NoError(t, store.Users.Save(user))
+	require.ErrorIs(t, store.Users.Save(user), service.ErrAlreadyExists)
+	found, err := store.Users.Find("admin1")
+	require.NoError(t, err)
+	require.Equal(t, user, found)
+	require.True(t, found.IsCorrectPassword("secret"))
+	found, err = store.Users.Find("nobody")
+	require.NoError(t, err)
+	require.Nil(t, found)
+}
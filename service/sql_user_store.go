@@ -0,0 +1,42 @@
+package service
+
+import (
+	"database/sql"
+)
+
+// SQLUserStore keeps the users in the users table of a SQLStore
+type SQLUserStore struct {
+	db *sql.DB
+}
+
+func (store *SQLUserStore) Save(user *User) error {
+	res, err := store.db.Exec(
+		"INSERT INTO users (username, hashed_password, role) VALUES (?, ?, ?) ON CONFLICT (username) DO NOTHING",
+		user.Username, user.HashedPassword, user.Role,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+func (store *SQLUserStore) Find(username string) (*User, error) {
+	user := &User{}
+	err := store.db.QueryRow(
+		"SELECT username, hashed_password, role FROM users WHERE username = ?",
+		username,
+	).Scan(&user.Username, &user.HashedPassword, &user.Role)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
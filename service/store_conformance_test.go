@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"path/filepath"
+	"proto_demo/service"
+	"proto_demo/service/storetest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// laptopStoreFactories create an empty store of each implementation
+var laptopStoreFactories = []struct {
+	name string
+	new  func(t *testing.T) service.LaptopStore
+}{
+	{"memory", func(t *testing.T) service.LaptopStore {
+		return service.NewInMemoryLaptopStore()
+	}},
+	{"file", func(t *testing.T) service.LaptopStore {
+		store, err := service.NewFileLaptopStore(t.TempDir())
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return store
+	}},
+	{"bolt", func(t *testing.T) service.LaptopStore {
+		store, err := service.NewBoltLaptopStore(filepath.Join(t.TempDir(), "laptops.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return store
+	}},
+	{"sql", func(t *testing.T) service.LaptopStore {
+		return newTestSQLStore(t).Laptops
+	}},
+}
+
+func TestLaptopStoreConformance(t *testing.T) {
+	t.Parallel()
+
+	for i := range laptopStoreFactories {
+		factory := laptopStoreFactories[i]
+
+		t.Run(factory.name, func(t *testing.T) {
+			t.Parallel()
+
+			storetest.RunLaptopStoreTests(t, factory.new)
+		})
+	}
+}
+
+func TestRatingStoreConformance(t *testing.T) {
+	t.Parallel()
+
+	t.Run("memory", func(t *testing.T) {
+		storetest.RunRatingStoreTests(t, func(t *testing.T) service.RatingStore {
+			return service.NewInMemoryRatingStore()
+		})
+	})
+	t.Run("sql", func(t *testing.T) {
+		storetest.RunRatingStoreTests(t, func(t *testing.T) service.RatingStore {
+			return newTestSQLStore(t).Ratings
+		})
+	})
+}
+
+func TestUserStoreConformance(t *testing.T) {
+	t.Parallel()
+
+	t.Run("memory", func(t *testing.T) {
+		storetest.RunUserStoreTests(t, func(t *testing.T) service.UserStore {
+			return service.NewInMemoryUserStore()
+		})
+	})
+	t.Run("sql", func(t *testing.T) {
+		storetest.RunUserStoreTests(t, func(t *testing.T) service.UserStore {
+			return newTestSQLStore(t).Users
+		})
+	})
+}
+
+func TestImageStoreConformance(t *testing.T) {
+	t.Parallel()
+
+	t.Run("disk", func(t *testing.T) {
+		storetest.RunImageStoreTests(t, func(t *testing.T) service.ImageStore {
+			return newTestImageStore(t, t.TempDir())
+		})
+	})
+}
+
+func newTestSQLStore(t *testing.T) *service.SQLStore {
+	store, err := service.NewSQLStore(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
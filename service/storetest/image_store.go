@@ -0,0 +1,200 @@
+package storetest
+
+import (
+	"bytes"
+	"io"
+	"proto_demo/sample"
+	"proto_demo/service"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// ImageStoreFactory returns an empty store, it's called once for each test
+type ImageStoreFactory func(t *testing.T) service.ImageStore
+
+// RunImageStoreTests runs the image store conformance tests on the stores created by newStore
+func RunImageStoreTests(t *testing.T, newStore ImageStoreFactory) {
+	save := func(t *testing.T, store service.ImageStore, laptopID string) string {
+		imageID, err := store.Save(laptopID, ".jpg", bytes.NewBufferString("image of "+laptopID))
+		require.NoError(t, err)
+		require.NotEmpty(t, imageID)
+		return imageID
+	}
+
+	t.Run("SaveAndFindByLaptop", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		laptopID := sample.NewLaptop().GetId()
+		imageIDs := []string{save(t, store, laptopID), save(t, store, laptopID)}
+		save(t, store, sample.NewLaptop().GetId())
+
+		found, err := store.FindByLaptop(laptopID)
+		require.NoError(t, err)
+		require.Equal(t, imageIDs, found)
+
+		found, err = store.FindByLaptop(sample.NewLaptop().GetId())
+		require.NoError(t, err)
+		require.Empty(t, found)
+	})
+
+	t.Run("FindAndOpen", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		laptopID := sample.NewLaptop().GetId()
+		imageID := save(t, store, laptopID)
+
+		info, err := store.Find(imageID)
+		require.NoError(t, err)
+		require.Equal(t, laptopID, info.LaptopID)
+		require.Equal(t, ".jpg", info.Type)
+
+		file, err := store.Open(imageID)
+		require.NoError(t, err)
+		data, err := io.ReadAll(file)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+		require.Equal(t, "image of "+laptopID, string(data))
+
+		info, err = store.Find("missing")
+		require.NoError(t, err)
+		require.Nil(t, info)
+		_, err = store.Open("missing")
+		require.ErrorIs(t, err, service.ErrNotFound)
+
+		require.NoError(t, store.DeleteByLaptop(laptopID))
+		_, err = store.Open(imageID)
+		require.ErrorIs(t, err, service.ErrNotFound)
+	})
+
+	t.Run("CreateAndCommit", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		laptopID := sample.NewLaptop().GetId()
+		writer, err := store.Create(laptopID, ".png")
+		require.NoError(t, err)
+		for _, chunk := range []string{"image ", "in ", "chunks"} {
+			_, err := writer.Write([]byte(chunk))
+			require.NoError(t, err)
+		}
+		found, err := store.FindByLaptop(laptopID)
+		require.NoError(t, err)
+		require.Empty(t, found, "the image isn't stored before it's committed")
+
+		imageID, err := writer.Commit()
+		require.NoError(t, err)
+		require.NoError(t, writer.Abort(), "abort does nothing after commit")
+		_, err = writer.Write([]byte("more"))
+		require.Error(t, err)
+
+		info, err := store.Find(imageID)
+		require.NoError(t, err)
+		require.Equal(t, int64(len("image in chunks")), info.Size)
+		file, err := store.Open(imageID)
+		require.NoError(t, err)
+		data, err := io.ReadAll(file)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+		require.Equal(t, "image in chunks", string(data))
+
+		aborted, err := store.Create(laptopID, ".png")
+		require.NoError(t, err)
+		_, err = aborted.Write([]byte("aborted image"))
+		require.NoError(t, err)
+		require.NoError(t, aborted.Abort())
+		_, err = aborted.Commit()
+		require.Error(t, err)
+		found, err = store.FindByLaptop(laptopID)
+		require.NoError(t, err)
+		require.Equal(t, []string{imageID}, found)
+	})
+
+	t.Run("DeleteAndSetPrimary", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		laptopID := sample.NewLaptop().GetId()
+		first := save(t, store, laptopID)
+		second := save(t, store, laptopID)
+		third := save(t, store, laptopID)
+		requireImages := func(expected ...string) {
+			t.Helper()
+			found, err := store.FindByLaptop(laptopID)
+			require.NoError(t, err)
+			require.Equal(t, expected, found)
+		}
+
+		require.NoError(t, store.SetPrimary(third))
+		requireImages(third, first, second)
+		require.NoError(t, store.SetPrimary(third), "setting the primary image again changes nothing")
+		requireImages(third, first, second)
+
+		require.NoError(t, store.Delete(third))
+		requireImages(first, second)
+		info, err := store.Find(third)
+		require.NoError(t, err)
+		require.Nil(t, info)
+
+		require.ErrorIs(t, store.Delete(third), service.ErrNotFound)
+		require.ErrorIs(t, store.SetPrimary(third), service.ErrNotFound)
+
+		require.NoError(t, store.Delete(first))
+		require.NoError(t, store.Delete(second))
+		found, err := store.FindByLaptop(laptopID)
+		require.NoError(t, err)
+		require.Empty(t, found)
+	})
+
+	t.Run("DeleteByLaptop", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		laptopID := sample.NewLaptop().GetId()
+		otherID := sample.NewLaptop().GetId()
+		save(t, store, laptopID)
+		other := save(t, store, otherID)
+
+		require.NoError(t, store.DeleteByLaptop(laptopID))
+		found, err := store.FindByLaptop(laptopID)
+		require.NoError(t, err)
+		require.Empty(t, found)
+		found, err = store.FindByLaptop(otherID)
+		require.NoError(t, err)
+		require.Equal(t, []string{other}, found)
+		require.NoError(t, store.DeleteByLaptop(laptopID), "deleting the images of a laptop without images isn't an error")
+	})
+
+	t.Run("ConcurrentAccess", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		laptopID := sample.NewLaptop().GetId()
+		const n = 10
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := store.Save(laptopID, ".png", bytes.NewBufferString("image"))
+				if err == nil {
+					_, err = store.FindByLaptop(laptopID)
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		found, err := store.FindByLaptop(laptopID)
+		require.NoError(t, err)
+		require.Len(t, found, n)
+	})
+}
@@ -0,0 +1,741 @@
+// Package storetest checks that store implementations follow the contract of the service store interfaces
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"proto_demo/pb"
+	"proto_demo/sample"
+	"proto_demo/service"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// LaptopStoreFactory returns an empty store, it's called once for each test
+type LaptopStoreFactory func(t *testing.T) service.LaptopStore
+
+// RunLaptopStoreTests runs the laptop store conformance tests on the stores created by newStore
+func RunLaptopStoreTests(t *testing.T, newStore LaptopStoreFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store service.LaptopStore)
+	}{
+		{"SaveAndFind", testSaveAndFind},
+		{"Duplicate", testDuplicate},
+		{"SaveAll", testSaveAll},
+		{"DeepCopy", testDeepCopy},
+		{"Update", testUpdate},
+		{"DeleteAndRestore", testDeleteAndRestore},
+		{"Search", testSearch},
+		{"SearchFilter", testSearchFilter},
+		{"SearchSortAndLimit", testSearchSortAndLimit},
+		{"SearchText", testSearchText},
+		{"SearchIndex", testSearchIndex},
+		{"SearchDoesNotBlockSave", testSearchDoesNotBlockSave},
+		{"List", testList},
+		{"Aggregate", testAggregate},
+		{"Watch", testWatch},
+		{"ContextCancellation", testContextCancellation},
+		{"ConcurrentAccess", testConcurrentAccess},
+	}
+	for i := range tests {
+		tc := tests[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.test(t, newStore(t))
+		})
+	}
+}
+
+// saved returns laptop as it's stored by Save
+func saved(laptop *pb.Laptop) *pb.Laptop {
+	other := proto.Clone(laptop).(*pb.Laptop)
+	other.Revision = 1
+	return other
+}
+
+func requireSameLaptop(t *testing.T, expected *pb.Laptop, actual *pb.Laptop) {
+	t.Helper()
+	require.True(t, proto.Equal(expected, actual), "expected %v, got %v", expected, actual)
+}
+
+func search(t *testing.T, store service.LaptopStore, query *service.SearchQuery) []*pb.Laptop {
+	t.Helper()
+	laptops := []*pb.Laptop{}
+	err := store.Search(context.Background(), query, func(laptop *pb.Laptop, score float64) error {
+		laptops = append(laptops, laptop)
+		return nil
+	})
+	require.NoError(t, err)
+	return laptops
+}
+
+func ids(laptops []*pb.Laptop) []string {
+	result := make([]string, len(laptops))
+	for i, laptop := range laptops {
+		result[i] = laptop.GetId()
+	}
+	return result
+}
+
+func testSaveAndFind(t *testing.T, store service.LaptopStore) {
+	laptop := sample.NewLaptop()
+	require.NoError(t, store.Save(laptop))
+
+	found, err := store.Find(laptop.GetId())
+	require.NoError(t, err)
+	requireSameLaptop(t, saved(laptop), found)
+
+	found, err = store.Find(sample.NewLaptop().GetId())
+	require.NoError(t, err)
+	require.Nil(t, found)
+}
+
+func testDuplicate(t *testing.T, store service.LaptopStore) {
+	laptop := sample.NewLaptop()
+	require.NoError(t, store.Save(laptop))
+	require.ErrorIs(t, store.Save(laptop), service.ErrAlreadyExists)
+
+	require.NoError(t, store.Delete(laptop.GetId(), true))
+	require.ErrorIs(t, store.Save(laptop), service.ErrAlreadyExists, "a soft deleted laptop keeps its ID")
+
+	require.NoError(t, store.Delete(laptop.GetId(), false))
+	require.NoError(t, store.Save(laptop), "a hard deleted laptop frees its ID")
+}
+
+func testSaveAll(t *testing.T, store service.LaptopStore) {
+	existing := sample.NewLaptop()
+	require.NoError(t, store.Save(existing))
+
+	laptops := []*pb.Laptop{sample.NewLaptop(), sample.NewLaptop(), existing}
+	err := store.SaveAll(laptops)
+	var batchErr *service.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Equal(t, 2, batchErr.Index)
+	require.ErrorIs(t, err, service.ErrAlreadyExists)
+	for _, laptop := range laptops[:2] {
+		found, err := store.Find(laptop.GetId())
+		require.NoError(t, err)
+		require.Nil(t, found, "a failed batch saves nothing")
+	}
+
+	laptop := sample.NewLaptop()
+	err = store.SaveAll([]*pb.Laptop{laptop, laptop})
+	require.ErrorAs(t, err, &batchErr)
+	require.Equal(t, 1, batchErr.Index)
+
+	laptops = laptops[:2]
+	require.NoError(t, store.SaveAll(laptops))
+	for _, laptop := range laptops {
+		found, err := store.Find(laptop.GetId())
+		require.NoError(t, err)
+		requireSameLaptop(t, saved(laptop), found)
+	}
+	require.NoError(t, store.SaveAll(nil))
+}
+
+func testDeepCopy(t *testing.T, store service.LaptopStore) {
+	laptop := sample.NewLaptop()
+	expected := saved(laptop)
+	require.NoError(t, store.Save(laptop))
+
+	laptop.Name = "changed after save"
+	laptop.Cpu.Name = "changed after save"
+	found, err := store.Find(laptop.GetId())
+	require.NoError(t, err)
+	requireSameLaptop(t, expected, found)
+
+	found.Name = "changed after find"
+	found.Gpus[0].Name = "changed after find"
+	results := search(t, store, &service.SearchQuery{})
+	require.Len(t, results, 1)
+	requireSameLaptop(t, expected, results[0])
+
+	results[0].Brand = "changed after search"
+	found, err = store.Find(laptop.GetId())
+	require.NoError(t, err)
+	requireSameLaptop(t, expected, found)
+}
+
+func testUpdate(t *testing.T, store service.LaptopStore) {
+	laptop := sample.NewLaptop()
+	require.NoError(t, store.Save(laptop))
+
+	update := &pb.Laptop{Id: laptop.GetId(), PriceUsd: 1234, Revision: 1}
+	updated, err := store.Update(update, &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}})
+	require.NoError(t, err)
+	require.Equal(t, 1234.0, updated.GetPriceUsd())
+	require.Equal(t, laptop.GetName(), updated.GetName())
+	require.Equal(t, uint64(2), updated.GetRevision())
+	require.NotNil(t, updated.GetUpdateAt())
+
+	found, err := store.Find(laptop.GetId())
+	require.NoError(t, err)
+	requireSameLaptop(t, updated, found)
+
+	_, err = store.Update(update, &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}})
+	require.ErrorIs(t, err, service.ErrStaleRevision)
+
+	_, err = store.Update(&pb.Laptop{Id: laptop.GetId()}, &fieldmaskpb.FieldMask{Paths: []string{"id"}})
+	require.Error(t, err)
+
+	_, err = store.Update(sample.NewLaptop(), nil)
+	require.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func testDeleteAndRestore(t *testing.T, store service.LaptopStore) {
+	laptop := sample.NewLaptop()
+	require.NoError(t, store.Save(laptop))
+
+	require.NoError(t, store.Delete(laptop.GetId(), true))
+	found, err := store.Find(laptop.GetId())
+	require.NoError(t, err)
+	require.Nil(t, found)
+	require.Empty(t, search(t, store, &service.SearchQuery{}))
+	require.ErrorIs(t, store.Delete(laptop.GetId(), true), service.ErrNotFound)
+
+	restored, err := store.Restore(laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), restored.GetRevision())
+	found, err = store.Find(laptop.GetId())
+	require.NoError(t, err)
+	requireSameLaptop(t, restored, found)
+	_, err = store.Restore(laptop.GetId())
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	require.NoError(t, store.Delete(laptop.GetId(), false))
+	_, err = store.Restore(laptop.GetId())
+	require.ErrorIs(t, err, service.ErrNotFound)
+	require.ErrorIs(t, store.Delete(laptop.GetId(), false), service.ErrNotFound)
+}
+
+func testSearch(t *testing.T, store service.LaptopStore) {
+	laptops := make([]*pb.Laptop, 6)
+	for i := range laptops {
+		laptop := sample.NewLaptop()
+		laptop.Brand = []string{"Apple", "Dell"}[i%2]
+		laptop.Name = []string{"Alpha", "Bravo", "Charlie", "Delta", "Echo", "Foxtrot"}[i]
+		laptop.PriceUsd = float64(500 * i)
+		laptop.Cpu.NumberCores = uint32(2 + i)
+		laptop.Ram = &pb.Memory{Value: uint64(4 << (i % 3)), Unit: pb.Memory_GIGABYTE}
+		require.NoError(t, store.Save(laptop))
+		laptops[i] = laptop
+	}
+
+	testCases := []struct {
+		name     string
+		query    *service.SearchQuery
+		expected []int
+	}{
+		{"all", &service.SearchQuery{}, []int{0, 1, 2, 3, 4, 5}},
+		{"price", &service.SearchQuery{Filter: &pb.Filter{MinPriceUsd: 500, MaxPriceUsd: proto.Float64(1500)}}, []int{1, 2, 3}},
+		{"min_price", &service.SearchQuery{Filter: &pb.Filter{MinPriceUsd: 2000}}, []int{4, 5}},
+		{"free", &service.SearchQuery{Filter: &pb.Filter{MaxPriceUsd: proto.Float64(0)}}, []int{0}},
+		{"brand", &service.SearchQuery{Filter: &pb.Filter{Brands: []string{"apple"}}}, []int{0, 2, 4}},
+		{"cores_and_ram", &service.SearchQuery{Filter: &pb.Filter{
+			MinCpuCores: 4,
+			MinRam:      &pb.Memory{Value: 16, Unit: pb.Memory_GIGABYTE},
+		}}, []int{2, 5}},
+		{"text", &service.SearchQuery{Text: "dell delta"}, []int{3}},
+		{"none", &service.SearchQuery{Filter: &pb.Filter{MinPriceUsd: 10000}}, []int{}},
+	}
+	for _, tc := range testCases {
+		expected := []string{}
+		for _, i := range tc.expected {
+			expected = append(expected, laptops[i].GetId())
+		}
+		require.ElementsMatch(t, expected, ids(search(t, store, tc.query)), tc.name)
+	}
+}
+
+func testSearchSortAndLimit(t *testing.T, store service.LaptopStore) {
+	for _, i := range rand.Perm(20) {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = float64(1000 + 10*i)
+		require.NoError(t, store.Save(laptop))
+	}
+
+	testCases := []struct {
+		name   string
+		query  *service.SearchQuery
+		prices []float64
+	}{
+		{
+			name: "cheapest",
+			query: &service.SearchQuery{
+				Order: service.LaptopOrder{Field: pb.SortField_PRICE},
+				Limit: 3,
+			},
+			prices: []float64{1000, 1010, 1020},
+		},
+		{
+			name: "most_expensive",
+			query: &service.SearchQuery{
+				Order: service.LaptopOrder{Field: pb.SortField_PRICE, Descending: true},
+				Limit: 3,
+			},
+			prices: []float64{1190, 1180, 1170},
+		},
+		{
+			name: "filtered_without_limit",
+			query: &service.SearchQuery{
+				Filter: &pb.Filter{MinPriceUsd: 1150},
+				Order:  service.LaptopOrder{Field: pb.SortField_PRICE},
+			},
+			prices: []float64{1150, 1160, 1170, 1180, 1190},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			prices := []float64{}
+			err := store.Search(context.Background(), tc.query, func(laptop *pb.Laptop, score float64) error {
+				prices = append(prices, laptop.GetPriceUsd())
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.prices, prices)
+		})
+	}
+}
+
+func testSearchText(t *testing.T, store service.LaptopStore) {
+	newLaptop := func(brand, name, cpu string) *pb.Laptop {
+		laptop := sample.NewLaptop()
+		laptop.Brand = brand
+		laptop.Name = name
+		laptop.Cpu.Name = cpu
+		laptop.Gpus[0].Name = "RTX 2060"
+		require.NoError(t, store.Save(laptop))
+		return laptop
+	}
+	p1 := newLaptop("Lenovo", "Thinkpad P1", "Ryzen 7 PRO 2700U")
+	x1 := newLaptop("Lenovo", "Thinkpad X1", "Core i7-9750H")
+	xps := newLaptop("Dell", "XPS", "Core i9-9980HK")
+
+	search := func(text string) ([]string, []float64) {
+		ids := []string{}
+		scores := []float64{}
+		err := store.Search(context.Background(), &service.SearchQuery{Text: text}, func(laptop *pb.Laptop, score float64) error {
+			ids = append(ids, laptop.GetId())
+			scores = append(scores, score)
+			return nil
+		})
+		require.NoError(t, err)
+		return ids, scores
+	}
+
+	ids, scores := search("thinkpad p1 ryzen")
+	require.Equal(t, []string{p1.Id}, ids)
+	require.Greater(t, scores[0], 0.0)
+
+	ids, _ = search("thinkpad p1")
+	require.Equal(t, []string{p1.Id}, ids)
+
+	ids, scores = search("thinkpd")
+	require.ElementsMatch(t, []string{p1.Id, x1.Id}, ids)
+	require.Equal(t, scores[0], scores[1])
+
+	ids, _ = search("LENOVO x")
+	require.Equal(t, []string{x1.Id}, ids)
+
+	ids, _ = search("rtx")
+	require.Len(t, ids, 3)
+
+	ids, _ = search("core i9")
+	require.Equal(t, []string{xps.Id}, ids)
+
+	ids, _ = search("macbook")
+	require.Empty(t, ids)
+
+	_, err := store.Update(&pb.Laptop{Id: xps.Id, Name: "Precision"}, &fieldmaskpb.FieldMask{Paths: []string{"name"}})
+	require.NoError(t, err)
+	ids, _ = search("xps")
+	require.Empty(t, ids)
+	ids, _ = search("precision")
+	require.Equal(t, []string{xps.Id}, ids)
+
+	require.NoError(t, store.Delete(p1.Id, true))
+	ids, _ = search("ryzen")
+	require.Empty(t, ids)
+}
+
+func testSearchIndex(t *testing.T, store service.LaptopStore) {
+	laptops := make([]*pb.Laptop, 10)
+	for i := range laptops {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = float64(1000 + 100*i)
+		laptop.Cpu.NumberCores = uint32(3 + i%3)
+		laptop.Ram = &pb.Memory{Value: 16, Unit: pb.Memory_GIGABYTE}
+		if i == 1 {
+			laptop.Ram.Value = 4
+		}
+		require.NoError(t, store.Save(laptop))
+		laptops[i] = laptop
+	}
+	filter := &pb.Filter{
+		MaxPriceUsd: proto.Float64(1500),
+		MinCpuCores: 4,
+		MinRam:      &pb.Memory{Value: 8192, Unit: pb.Memory_MEGABYTE},
+	}
+	search := func() []string {
+		ids := []string{}
+		err := store.Search(context.Background(), &service.SearchQuery{Filter: filter}, func(laptop *pb.Laptop, score float64) error {
+			ids = append(ids, laptop.GetId())
+			return nil
+		})
+		require.NoError(t, err)
+		return ids
+	}
+
+	expected := []string{}
+	for _, laptop := range laptops {
+		if laptop.PriceUsd <= 1500 && laptop.Cpu.NumberCores >= 4 && laptop.Ram.Value >= 8 {
+			expected = append(expected, laptop.Id)
+		}
+	}
+	require.Len(t, expected, 3)
+	require.ElementsMatch(t, expected, search())
+
+	_, err := store.Update(&pb.Laptop{Id: expected[0], PriceUsd: 5000}, &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}})
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(expected[1], false))
+	require.ElementsMatch(t, expected[2:], search())
+}
+
+func testSearchDoesNotBlockSave(t *testing.T, store service.LaptopStore) {
+	require.NoError(t, store.Save(sample.NewLaptop()))
+
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- store.Search(context.Background(), &service.SearchQuery{}, func(laptop *pb.Laptop, score float64) error {
+			close(sending)
+			<-release
+			return nil
+		})
+	}()
+
+	<-sending
+	saved := make(chan error)
+	go func() {
+		saved <- store.Save(sample.NewLaptop())
+	}()
+	select {
+	case err := <-saved:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("save is blocked by search")
+	}
+	close(release)
+	require.NoError(t, <-done)
+}
+
+func testSearchFilter(t *testing.T, store service.LaptopStore) {
+	newLaptop := func() *pb.Laptop {
+		laptop := sample.NewLaptop()
+		laptop.Brand = "Lenovo"
+		laptop.Name = "Thinkpad P1"
+		laptop.PriceUsd = 2000
+		laptop.ReleaseYear = 2019
+		laptop.Gpus = []*pb.GPU{{Brand: "NVIDIA", Memory: &pb.Memory{Value: 4, Unit: pb.Memory_GIGABYTE}}}
+		laptop.Storages = []*pb.Storage{
+			{Driver: pb.Storage_SSD, Memory: &pb.Memory{Value: 512, Unit: pb.Memory_GIGABYTE}},
+			{Driver: pb.Storage_SSD, Memory: &pb.Memory{Value: 512, Unit: pb.Memory_GIGABYTE}},
+			{Driver: pb.Storage_HDD, Memory: &pb.Memory{Value: 2, Unit: pb.Memory_TERABYTE}},
+		}
+		laptop.Screen = &pb.Screen{
+			SizeInch:   15.6,
+			Resolution: &pb.Screen_Resolution{Width: 3840, Height: 2160},
+			Panel:      pb.Screen_OLED,
+		}
+		laptop.Keyboard = &pb.Keyboard{Layout: pb.Keyboard_QWERTY, Backlit: true}
+		laptop.Weight = &pb.Laptop_WeightLb{WeightLb: 4}
+		return laptop
+	}
+	backlit := false
+
+	testCases := []struct {
+		name    string
+		filter  *pb.Filter
+		matched bool
+	}{
+		{"empty", &pb.Filter{}, true},
+		{"price_range", &pb.Filter{MinPriceUsd: 1500, MaxPriceUsd: proto.Float64(2000)}, true},
+		{"min_price", &pb.Filter{MinPriceUsd: 2500}, false},
+		{"brands", &pb.Filter{Brands: []string{"dell", "lenovo"}}, true},
+		{"other_brands", &pb.Filter{Brands: []string{"Apple", "Dell"}}, false},
+		{"names", &pb.Filter{Names: []string{"Thinkpad X1"}}, false},
+		{"gpu", &pb.Filter{GpuBrands: []string{"NVIDIA"}, MinGpuMemory: &pb.Memory{Value: 4096, Unit: pb.Memory_MEGABYTE}}, true},
+		{"gpu_brand", &pb.Filter{GpuBrands: []string{"AMD"}}, false},
+		{"gpu_memory", &pb.Filter{MinGpuMemory: &pb.Memory{Value: 8, Unit: pb.Memory_GIGABYTE}}, false},
+		{"total_ssd", &pb.Filter{MinSsd: &pb.Memory{Value: 1, Unit: pb.Memory_TERABYTE}}, true},
+		{"too_small_ssd", &pb.Filter{MinSsd: &pb.Memory{Value: 2, Unit: pb.Memory_TERABYTE}}, false},
+		{"screen", &pb.Filter{
+			MinScreenSizeInch: 15,
+			MaxScreenSizeInch: 16,
+			MinResolution:     &pb.Screen_Resolution{Width: 1920, Height: 1080},
+			Panels:            []pb.Screen_Panel{pb.Screen_IPS, pb.Screen_OLED},
+		}, true},
+		{"screen_size", &pb.Filter{MaxScreenSizeInch: 14}, false},
+		{"screen_resolution", &pb.Filter{MinResolution: &pb.Screen_Resolution{Width: 5120}}, false},
+		{"screen_panel", &pb.Filter{Panels: []pb.Screen_Panel{pb.Screen_IPS}}, false},
+		{"keyboard", &pb.Filter{KeyboardLayouts: []pb.Keyboard_Layout{pb.Keyboard_QWERTY}}, true},
+		{"keyboard_layout", &pb.Filter{KeyboardLayouts: []pb.Keyboard_Layout{pb.Keyboard_AZERTY}}, false},
+		{"keyboard_backlit", &pb.Filter{KeyboardBacklit: &backlit}, false},
+		{"weight_lb_as_kg", &pb.Filter{MinWeightKg: 1.8, MaxWeightKg: 1.9}, true},
+		{"weight", &pb.Filter{MaxWeightKg: 1.5}, false},
+		{"release_year", &pb.Filter{MinReleaseYear: 2018, MaxReleaseYear: 2019}, true},
+		{"old_release_year", &pb.Filter{MaxReleaseYear: 2018}, false},
+	}
+
+	laptop := newLaptop()
+	require.NoError(t, store.Save(laptop))
+	for _, tc := range testCases {
+		found := ids(search(t, store, &service.SearchQuery{Filter: tc.filter}))
+		if tc.matched {
+			require.Equal(t, []string{laptop.GetId()}, found, tc.name)
+		} else {
+			require.Empty(t, found, tc.name)
+		}
+	}
+}
+
+func testList(t *testing.T, store service.LaptopStore) {
+	// more laptops than a store may read at once
+	const count = 250
+	laptops := make([]*pb.Laptop, count)
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+		//价格相同时按ID排序
+		laptops[i].PriceUsd = float64(1000 + i%7*100)
+	}
+	require.NoError(t, store.SaveAll(laptops))
+
+	orders := []service.LaptopOrder{
+		{Field: pb.SortField_ID},
+		{Field: pb.SortField_ID, Descending: true},
+		{Field: pb.SortField_PRICE},
+		{Field: pb.SortField_PRICE, Descending: true},
+		{Field: pb.SortField_RELEASE_YEAR, Descending: true},
+		{Field: pb.SortField_UPDATE_AT},
+	}
+	for _, order := range orders {
+		listed := []*pb.Laptop{}
+		var cursor *service.LaptopCursor
+		for {
+			page, err := store.List(context.Background(), order, cursor, 40)
+			require.NoError(t, err)
+			listed = append(listed, page...)
+			if len(page) < 40 {
+				break
+			}
+			cursor = order.Cursor(page[len(page)-1])
+		}
+
+		require.Len(t, listed, count, "order %v", order.Field)
+		for i := 1; i < len(listed); i++ {
+			require.True(t, order.Less(order.Cursor(listed[i-1]), order.Cursor(listed[i])), "order %v", order.Field)
+		}
+	}
+}
+
+func testAggregate(t *testing.T, store service.LaptopStore) {
+	// reference aggregates the same laptops in memory
+	reference := service.NewInMemoryLaptopStore()
+	save := func(laptop *pb.Laptop) {
+		require.NoError(t, reference.Save(proto.Clone(laptop).(*pb.Laptop)))
+		require.NoError(t, store.Save(laptop))
+	}
+	for i := 0; i < 4; i++ {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = float64(1000 * (i + 1))
+		save(laptop)
+	}
+
+	res, err := store.Aggregate(context.Background(), &pb.Filter{MinPriceUsd: 2000}, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), res.GetTotal())
+	require.Equal(t, 2000.0, res.GetPrice().GetMinUsd())
+	require.Equal(t, 4000.0, res.GetPrice().GetMaxUsd())
+
+	for i := 0; i < 20; i++ {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = float64(100 * i)
+		if i%3 == 0 {
+			laptop.Weight = &pb.Laptop_WeightLb{WeightLb: float64(i)}
+		}
+		if i%4 == 0 {
+			laptop.Gpus = nil
+		}
+		save(laptop)
+	}
+	histograms := []*pb.HistogramSpec{}
+	for field := range pb.Histogram_Field_name {
+		if pb.Histogram_Field(field) != pb.Histogram_UNKNOWN {
+			histograms = append(histograms, &pb.HistogramSpec{Field: pb.Histogram_Field(field), Interval: 0.5})
+		}
+	}
+	sort.Slice(histograms, func(i, j int) bool { return histograms[i].Field < histograms[j].Field })
+	filter := &pb.Filter{MaxPriceUsd: proto.Float64(1500)}
+	res, err = store.Aggregate(context.Background(), filter, histograms)
+	require.NoError(t, err)
+	want, err := reference.Aggregate(context.Background(), filter, histograms)
+	require.NoError(t, err)
+	require.Equal(t, uint32(17), res.GetTotal())
+	require.True(t, proto.Equal(want, res), "want %v, got %v", want, res)
+
+	// an interval too small for the bucket indexes fails
+	_, err = store.Aggregate(context.Background(), nil, []*pb.HistogramSpec{{Field: pb.Histogram_PRICE_USD, Interval: 1e-300}})
+	require.ErrorIs(t, err, service.ErrTooManyBuckets)
+}
+
+func testWatch(t *testing.T, store service.LaptopStore) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan *pb.LaptopEvent, 10)
+	done := make(chan error)
+	go func() {
+		done <- store.Watch(ctx, "", func(event *pb.LaptopEvent) error {
+			events <- event
+			return nil
+		})
+	}()
+
+	// the watch is established once it receives the event of a new laptop
+	var first *pb.LaptopEvent
+	for first == nil {
+		require.NoError(t, store.Save(sample.NewLaptop()))
+		select {
+		case first = <-events:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, store.Save(laptop))
+	_, err := store.Update(&pb.Laptop{Id: laptop.GetId(), PriceUsd: 1}, &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}})
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(laptop.GetId(), true))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	received := []pb.LaptopEvent_Type{}
+	err = store.Watch(ctx, first.GetResumeToken(), func(event *pb.LaptopEvent) error {
+		if event.GetLaptop().GetId() == laptop.GetId() {
+			received = append(received, event.GetType())
+		}
+		if event.GetType() == pb.LaptopEvent_UPDATED {
+			require.Equal(t, laptop.GetPriceUsd(), event.GetPrevious().GetPriceUsd())
+			require.Equal(t, 1.0, event.GetLaptop().GetPriceUsd())
+		}
+		if event.GetType() == pb.LaptopEvent_DELETED {
+			cancel()
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, []pb.LaptopEvent_Type{pb.LaptopEvent_CREATED, pb.LaptopEvent_UPDATED, pb.LaptopEvent_DELETED}, received)
+
+	err = store.Watch(context.Background(), "not a token", func(event *pb.LaptopEvent) error {
+		return nil
+	})
+	require.ErrorIs(t, err, service.ErrInvalidResumeToken)
+
+	// a token of another feed, e.g. before a restart, has expired
+	_, sequence, found := strings.Cut(first.GetResumeToken(), "/")
+	require.True(t, found)
+	err = store.Watch(context.Background(), "another-epoch/"+sequence, func(event *pb.LaptopEvent) error {
+		return nil
+	})
+	require.ErrorIs(t, err, service.ErrResumeTokenExpired)
+}
+
+func testContextCancellation(t *testing.T, store service.LaptopStore) {
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.Save(sample.NewLaptop()))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := store.Search(ctx, &service.SearchQuery{}, func(laptop *pb.Laptop, score float64) error {
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	_, err = store.List(ctx, service.LaptopOrder{}, nil, 10)
+	require.ErrorIs(t, err, context.Canceled)
+	_, err = store.Aggregate(ctx, nil, nil)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// an error returned by found stops the search
+	stop := fmt.Errorf("stop")
+	calls := 0
+	err = store.Search(context.Background(), &service.SearchQuery{}, func(laptop *pb.Laptop, score float64) error {
+		calls++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, calls)
+}
+
+func testConcurrentAccess(t *testing.T, store service.LaptopStore) {
+	const workers = 8
+	const laptopsPerWorker = 5
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < laptopsPerWorker; i++ {
+				laptop := sample.NewLaptop()
+				err := store.Save(laptop)
+				if err == nil {
+					_, err = store.Find(laptop.GetId())
+				}
+				if err == nil {
+					_, err = store.Update(&pb.Laptop{Id: laptop.GetId(), PriceUsd: 1}, &fieldmaskpb.FieldMask{Paths: []string{"price_usd"}})
+				}
+				if err == nil {
+					err = store.Search(context.Background(), &service.SearchQuery{}, func(laptop *pb.Laptop, score float64) error {
+						return nil
+					})
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	laptops := search(t, store, &service.SearchQuery{})
+	require.Len(t, laptops, workers*laptopsPerWorker)
+	for _, laptop := range laptops {
+		require.Equal(t, uint64(2), laptop.GetRevision())
+	}
+}
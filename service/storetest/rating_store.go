@@ -0,0 +1,102 @@
+package storetest
+
+import (
+	"proto_demo/sample"
+	"proto_demo/service"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// RatingStoreFactory returns an empty store, it's called once for each test
+type RatingStoreFactory func(t *testing.T) service.RatingStore
+
+// RunRatingStoreTests runs the rating store conformance tests on the stores created by newStore
+func RunRatingStoreTests(t *testing.T, newStore RatingStoreFactory) {
+	t.Run("AddAndFind", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		laptopID := sample.NewLaptop().GetId()
+		rating, err := store.Find(laptopID)
+		require.NoError(t, err)
+		require.Nil(t, rating)
+
+		rating, err = store.Add(laptopID, 8)
+		require.NoError(t, err)
+		require.Equal(t, &service.Rating{Count: 1, Sum: 8}, rating)
+		rating, err = store.Add(laptopID, 9)
+		require.NoError(t, err)
+		require.Equal(t, &service.Rating{Count: 2, Sum: 17}, rating)
+
+		rating, err = store.Find(laptopID)
+		require.NoError(t, err)
+		require.Equal(t, &service.Rating{Count: 2, Sum: 17}, rating)
+
+		rating, err = store.Find(sample.NewLaptop().GetId())
+		require.NoError(t, err)
+		require.Nil(t, rating)
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		laptopID := sample.NewLaptop().GetId()
+		rating, err := store.Add(laptopID, 5)
+		require.NoError(t, err)
+		rating.Count = 100
+		found, err := store.Find(laptopID)
+		require.NoError(t, err)
+		found.Sum = 100
+
+		found, err = store.Find(laptopID)
+		require.NoError(t, err)
+		require.Equal(t, &service.Rating{Count: 1, Sum: 5}, found)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		laptopID := sample.NewLaptop().GetId()
+		_, err := store.Add(laptopID, 5)
+		require.NoError(t, err)
+		require.NoError(t, store.Delete(laptopID))
+		rating, err := store.Find(laptopID)
+		require.NoError(t, err)
+		require.Nil(t, rating)
+		require.NoError(t, store.Delete(laptopID), "deleting a missing rating isn't an error")
+	})
+
+	t.Run("ConcurrentAccess", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		laptopID := sample.NewLaptop().GetId()
+		const n = 20
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := store.Add(laptopID, 2)
+				if err == nil {
+					_, err = store.Find(laptopID)
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		rating, err := store.Find(laptopID)
+		require.NoError(t, err)
+		require.Equal(t, &service.Rating{Count: n, Sum: 2 * n}, rating)
+	})
+}
@@ -0,0 +1,93 @@
+package storetest
+
+import (
+	"fmt"
+	"proto_demo/service"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// UserStoreFactory returns an empty store, it's called once for each test
+type UserStoreFactory func(t *testing.T) service.UserStore
+
+// RunUserStoreTests runs the user store conformance tests on the stores created by newStore
+func RunUserStoreTests(t *testing.T, newStore UserStoreFactory) {
+	newUser := func(username string) *service.User {
+		// the password isn't checked, a fixed hash avoids the cost of bcrypt
+		return &service.User{Username: username, HashedPassword: "hash-" + username, Role: "user"}
+	}
+
+	t.Run("SaveAndFind", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		user := newUser("user1")
+		require.NoError(t, store.Save(user))
+
+		found, err := store.Find("user1")
+		require.NoError(t, err)
+		require.Equal(t, user, found)
+
+		found, err = store.Find("user2")
+		require.NoError(t, err)
+		require.Nil(t, found)
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		require.NoError(t, store.Save(newUser("user1")))
+		require.ErrorIs(t, store.Save(newUser("user1")), service.ErrAlreadyExists)
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		user := newUser("user1")
+		require.NoError(t, store.Save(user))
+		user.Role = "admin"
+		found, err := store.Find("user1")
+		require.NoError(t, err)
+		found.Role = "admin"
+
+		found, err = store.Find("user1")
+		require.NoError(t, err)
+		require.Equal(t, "user", found.Role)
+	})
+
+	t.Run("ConcurrentAccess", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore(t)
+		const n = 20
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				username := fmt.Sprintf("user%d", i)
+				err := store.Save(newUser(username))
+				if err == nil {
+					_, err = store.Find(username)
+				}
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		for i := 0; i < n; i++ {
+			found, err := store.Find(fmt.Sprintf("user%d", i))
+			require.NoError(t, err)
+			require.NotNil(t, found)
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"proto_demo/pb"
+	"strings"
+	"unicode"
+)
+
+// match quality of a query token against an indexed token
+const (
+	exactMatch  = 1.0
+	prefixMatch = 0.75
+	typoMatch   = 0.5
+)
+
+// textIndex is an inverted index over the brand, name, CPU name and GPU names of laptops
+type textIndex struct {
+	// postings maps a token to the weight of the laptops containing it
+	postings map[string]map[string]float64
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{
+		postings: make(map[string]map[string]float64),
+	}
+}
+
+// laptopTokens returns the tokens of a laptop with the weight of the field they come from
+func laptopTokens(laptop *pb.Laptop) map[string]float64 {
+	tokens := make(map[string]float64)
+	add := func(text string, weight float64) {
+		for _, token := range tokenize(text) {
+			if weight > tokens[token] {
+				tokens[token] = weight
+			}
+		}
+	}
+	add(laptop.GetName(), 3)
+	add(laptop.GetBrand(), 2)
+	add(laptop.GetCpu().GetName(), 1)
+	for _, gpu := range laptop.GetGpus() {
+		add(gpu.GetName(), 1)
+	}
+	return tokens
+}
+
+// tokenize splits text into lower case words of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func (index *textIndex) Add(laptop *pb.Laptop) {
+	for token, weight := range laptopTokens(laptop) {
+		laptops := index.postings[token]
+		if laptops == nil {
+			laptops = make(map[string]float64)
+			index.postings[token] = laptops
+		}
+		laptops[laptop.GetId()] = weight
+	}
+}
+
+func (index *textIndex) Remove(laptop *pb.Laptop) {
+	for token := range laptopTokens(laptop) {
+		laptops := index.postings[token]
+		delete(laptops, laptop.GetId())
+		if len(laptops) == 0 {
+			delete(index.postings, token)
+		}
+	}
+}
+
+// Search returns the relevance score of every laptop matching all words of text,
+// a word matches an indexed token exactly, as a prefix or with a small typo
+func (index *textIndex) Search(text string) map[string]float64 {
+	var scores map[string]float64
+	for _, word := range tokenize(text) {
+		best := make(map[string]float64)
+		for token, laptops := range index.postings {
+			quality := matchQuality(word, token)
+			if quality == 0 {
+				continue
+			}
+			for laptopID, weight := range laptops {
+				if quality*weight > best[laptopID] {
+					best[laptopID] = quality * weight
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = best
+			continue
+		}
+		for laptopID := range scores {
+			if best[laptopID] == 0 {
+				delete(scores, laptopID)
+			} else {
+				scores[laptopID] += best[laptopID]
+			}
+		}
+	}
+	if scores == nil {
+		scores = make(map[string]float64)
+	}
+	return scores
+}
+
+// textScore returns the relevance of laptop for text like textIndex.Search, 0 means no match
+func textScore(text string, laptop *pb.Laptop) float64 {
+	tokens := laptopTokens(laptop)
+	score := 0.0
+	for _, word := range tokenize(text) {
+		best := 0.0
+		for token, weight := range tokens {
+			if quality := matchQuality(word, token); quality*weight > best {
+				best = quality * weight
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		score += best
+	}
+	return score
+}
+
+// matchQuality scores how well a query word matches an indexed token, 0 means no match
+func matchQuality(word string, token string) float64 {
+	switch {
+	case word == token:
+		return exactMatch
+	case strings.HasPrefix(token, word):
+		return prefixMatch
+	}
+
+	maxTypos := 0
+	switch n := len([]rune(word)); {
+	case n >= 8:
+		maxTypos = 2
+	case n >= 4:
+		maxTypos = 1
+	}
+	if maxTypos > 0 && editDistance(word, token, maxTypos) <= maxTypos {
+		return typoMatch
+	}
+	return 0
+}
+
+// editDistance returns the Levenshtein distance between a and b, or limit+1 once it exceeds limit
+func editDistance(a string, b string, limit int) int {
+	s, t := []rune(a), []rune(b)
+	if abs(len(s)-len(t)) > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(t)]
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"proto_demo/pb"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+)
+
+// uploadSessionTimeout is how long an upload is kept after its last request
+const uploadSessionTimeout = time.Hour
+
+// uploadSweepInterval is the least time between two searches of the expired uploads
+const uploadSweepInterval = time.Minute
+
+// uploadSessions are the resumable uploads of a server, they're lost when the server restarts
+type uploadSessions struct {
+	mutex    sync.Mutex
+	sessions map[string]*uploadSession
+	// keys are the uploads started with an idempotency key, a retry of StartUpload gets the same upload
+	keys    map[string]*uploadSession
+	sweptAt time.Time
+}
+
+// uploadSession is an image sent by one or more UploadChunks streams.
+// its fields are protected by its mutex, except expireAt which is protected by the mutex of the uploadSessions
+type uploadSession struct {
+	mutex     sync.Mutex
+	id        string
+	key       string
+	laptopID  string
+	imageType string
+	// writer is nil once the upload is finished or aborted
+	writer ImageWriter
+	hash   hash.Hash
+	// size is the number of bytes committed, the next chunk must start there
+	size int64
+	// response and checksum are set when the upload is finished, to answer the retries of FinishUpload
+	response *pb.UploadImageResponse
+	checksum []byte
+	expireAt time.Time
+}
+
+func newUploadSessions() *uploadSessions {
+	return &uploadSessions{
+		sessions: make(map[string]*uploadSession),
+		keys:     make(map[string]*uploadSession),
+	}
+}
+
+// start registers an upload of an image written by the writer returned by create.
+// an upload started with the same idempotency key is returned instead if it hasn't expired,
+// it fails if that upload is for another laptop or image type
+func (uploads *uploadSessions) start(
+	key string,
+	laptopID string,
+	imageType string,
+	create func() (ImageWriter, error),
+) (*uploadSession, error) {
+	now := time.Now()
+	uploads.mutex.Lock()
+	expired := uploads.sweep(now)
+	session, err := uploads.startLocked(now, key, laptopID, imageType, create)
+	uploads.mutex.Unlock()
+
+	abortAll(expired)
+	return session, err
+}
+
+// startLocked is start once the mutex is locked
+func (uploads *uploadSessions) startLocked(
+	now time.Time,
+	key string,
+	laptopID string,
+	imageType string,
+	create func() (ImageWriter, error),
+) (*uploadSession, error) {
+	if session := uploads.keys[key]; key != "" && session != nil {
+		if session.laptopID != laptopID || session.imageType != imageType {
+			return nil, idempotencyKeyReusedError(key)
+		}
+		session.expireAt = now.Add(uploadSessionTimeout)
+		return session, nil
+	}
+
+	uploadID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, internalError("cannot generate upload id", err)
+	}
+	writer, err := create()
+	if err != nil {
+		return nil, err
+	}
+	session := &uploadSession{
+		id:        uploadID.String(),
+		key:       key,
+		laptopID:  laptopID,
+		imageType: imageType,
+		writer:    writer,
+		hash:      sha256.New(),
+		expireAt:  now.Add(uploadSessionTimeout),
+	}
+	uploads.sessions[session.id] = session
+	if key != "" {
+		uploads.keys[key] = session
+	}
+	return session, nil
+}
+
+// find returns an upload and delays its expiration, or nil if it doesn't exist or has expired
+func (uploads *uploadSessions) find(uploadID string) *uploadSession {
+	now := time.Now()
+	uploads.mutex.Lock()
+	expired := uploads.sweep(now)
+	session := uploads.sessions[uploadID]
+	if session != nil && !session.expireAt.After(now) {
+		//上次清理之后过期的
+		uploads.remove(session)
+		expired = append(expired, session)
+		session = nil
+	}
+	if session != nil {
+		session.expireAt = now.Add(uploadSessionTimeout)
+	}
+	uploads.mutex.Unlock()
+
+	abortAll(expired)
+	return session
+}
+
+// sweep removes the expired uploads at most once per uploadSweepInterval, they must be aborted
+// once the mutex is unlocked. the mutex must be locked
+func (uploads *uploadSessions) sweep(now time.Time) []*uploadSession {
+	if now.Sub(uploads.sweptAt) < uploadSweepInterval {
+		return nil
+	}
+	uploads.sweptAt = now
+
+	expired := []*uploadSession{}
+	for _, session := range uploads.sessions {
+		if !session.expireAt.After(now) {
+			uploads.remove(session)
+			expired = append(expired, session)
+		}
+	}
+	return expired
+}
+
+// remove forgets an upload, the mutex must be locked
+func (uploads *uploadSessions) remove(session *uploadSession) {
+	delete(uploads.sessions, session.id)
+	if session.key != "" && uploads.keys[session.key] == session {
+		delete(uploads.keys, session.key)
+	}
+}
+
+// abortAll aborts the uploads removed from the sessions,
+// the lock order is the uploadSessions before the uploadSession so the mutex of the uploadSessions must be unlocked
+func abortAll(sessions []*uploadSession) {
+	for _, session := range sessions {
+		session.mutex.Lock()
+		session.abort()
+		session.mutex.Unlock()
+	}
+}
+
+// abort removes the data of the upload, the mutex must be locked
+func (session *uploadSession) abort() {
+	if session.writer != nil {
+		session.writer.Abort()
+		session.writer = nil
+	}
+}
+
+// committedSize returns the number of bytes received by the server, it fails if the upload is aborted
+func (session *uploadSession) committedSize() (int64, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.writer == nil && session.response == nil {
+		return 0, uploadNotFoundError(session.id)
+	}
+	return session.size, nil
+}
+
+// write appends a chunk which must start at the committed size.
+// the upload is aborted if the image becomes larger than maxImageSize
+func (session *uploadSession) write(offset int64, chunk []byte, maxImageSize int64) error {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.response != nil {
+		return uploadFinishedError(session.id)
+	}
+	if session.writer == nil {
+		return uploadNotFoundError(session.id)
+	}
+	if offset != session.size {
+		return uploadOffsetError(session.id, offset, session.size)
+	}
+	imageSize := session.size + int64(len(chunk))
+	if imageSize > maxImageSize {
+		session.abort()
+		return logError(imageTooLargeError(session.laptopID, imageSize, maxImageSize))
+	}
+
+	n, err := session.writer.Write(chunk)
+	//写了一部分也算,客户端从新的大小继续
+	session.hash.Write(chunk[:n])
+	session.size += int64(n)
+	if err != nil {
+		return storeError("cannot write chunk data", err)
+	}
+	return nil
+}
+
+// finish stores the image if checksum is the SHA-256 of the data, otherwise the upload is aborted.
+// check is called just before, the upload is kept if it fails so that FinishUpload can be retried.
+// a finished upload returns the same response again
+func (session *uploadSession) finish(checksum []byte, check func() error) (*pb.UploadImageResponse, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.response != nil {
+		if !bytes.Equal(checksum, session.checksum) {
+			return nil, uploadChecksumError(session.id)
+		}
+		return proto.Clone(session.response).(*pb.UploadImageResponse), nil
+	}
+	if session.writer == nil {
+		return nil, uploadNotFoundError(session.id)
+	}
+	if !bytes.Equal(checksum, session.hash.Sum(nil)) {
+		session.abort()
+		return nil, uploadChecksumError(session.id)
+	}
+	err := check()
+	if err != nil {
+		return nil, err
+	}
+
+	imageID, err := session.writer.Commit()
+	if err != nil {
+		session.abort()
+		return nil, storeError("cannot save image to the store", err)
+	}
+	session.writer = nil
+	session.checksum = checksum
+	session.response = &pb.UploadImageResponse{Id: imageID, Size: uint64(session.size)}
+	return proto.Clone(session.response).(*pb.UploadImageResponse), nil
+}